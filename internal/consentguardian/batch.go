@@ -0,0 +1,382 @@
+package consentguardian
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"policyguardian/internal/shared/hashing"
+	"policyguardian/internal/shared/jcs"
+	"policyguardian/internal/shared/sigenv"
+	"policyguardian/internal/shared/timefmt"
+)
+
+// BatchRow is one subject to record. Row is the 1-based JSONL line or CSV
+// record number (the CSV header is not counted).
+type BatchRow struct {
+	Row          int               `json:"-"`
+	Subject      string            `json:"subject"`
+	CreatedAtUTC string            `json:"created_at_utc,omitempty"`
+	Context      map[string]string `json:"context,omitempty"`
+	Evidence     map[string]string `json:"evidence,omitempty"`
+}
+
+// BatchFailure reports why one input row produced no event.
+type BatchFailure struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type BatchOptions struct {
+	// CreatedAtUTC applies to rows without created_at_utc; default is the
+	// time the batch starts.
+	CreatedAtUTC  string
+	TenantSaltHex string
+	PepperHex     string
+
+	// Signer, SignKeyFile, SignKeyPassphrase and SignCertChain are as in
+	// RecordOptions.
+	Signer            Signer
+	SignKeyFile       string
+	SignKeyPassphrase []byte
+	SignCertChain     []*x509.Certificate
+	SignPrivKeyHex    string
+	KeyDescription    string
+	LegalEntityName   string
+
+	// Workers defaults to runtime.NumCPU().
+	Workers int
+
+	// Exactly one output must be set. OutDir receives <consent_event_id>.json
+	// (and .sig.<algorithm>.json) per event; OutJSONL receives one BatchRecord
+	// per line in input order.
+	OutDir   string
+	OutJSONL io.Writer
+}
+
+// BatchRecord is one line of the JSONL output. ConsentEvent holds the exact
+// canonical bytes that would otherwise be written to <id>.json.
+type BatchRecord struct {
+	Row               int             `json:"row"`
+	ConsentEvent      json.RawMessage `json:"consent_event"`
+	SignatureEnvelope json.RawMessage `json:"signature_envelope,omitempty"`
+}
+
+type BatchSummary struct {
+	SnapshotID string         `json:"snapshot_id"`
+	Total      int            `json:"total"`
+	Recorded   int            `json:"recorded"`
+	Failures   []BatchFailure `json:"failures,omitempty"`
+}
+
+// ReadBatchRows reads subjects from JSONL or CSV (format "jsonl" or "csv").
+//
+// JSONL lines are objects with subject, optional created_at_utc, context and
+// evidence; blank lines are skipped. CSV needs a header with a "subject"
+// column, an optional "created_at_utc" column, and "context.<key>" /
+// "evidence.<key>" columns. Malformed rows are returned as failures.
+func ReadBatchRows(r io.Reader, format string) ([]BatchRow, []BatchFailure, error) {
+	switch format {
+	case "jsonl":
+		return readBatchJSONL(r)
+	case "csv":
+		return readBatchCSV(r)
+	}
+	return nil, nil, fmt.Errorf("unsupported batch format %q (jsonl|csv)", format)
+}
+
+func readBatchJSONL(r io.Reader) ([]BatchRow, []BatchFailure, error) {
+	var rows []BatchRow
+	var failures []BatchFailure
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	n := 0
+	for sc.Scan() {
+		n++
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var row BatchRow
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&row); err != nil {
+			failures = append(failures, BatchFailure{Row: n, Error: "invalid json: " + err.Error()})
+			continue
+		}
+		row.Row = n
+		rows = append(rows, row)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	return rows, failures, nil
+}
+
+func readBatchCSV(r io.Reader) ([]BatchRow, []BatchFailure, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("csv header: %w", err)
+	}
+	subjectCol := -1
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		header[i] = h
+		switch {
+		case h == "subject":
+			subjectCol = i
+		case h == "created_at_utc", strings.HasPrefix(h, "context."), strings.HasPrefix(h, "evidence."):
+		default:
+			return nil, nil, fmt.Errorf("csv header: unknown column %q", h)
+		}
+	}
+	if subjectCol < 0 {
+		return nil, nil, errors.New("csv header: missing subject column")
+	}
+	var rows []BatchRow
+	var failures []BatchFailure
+	for n := 1; ; n++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var pe *csv.ParseError
+			if errors.As(err, &pe) {
+				failures = append(failures, BatchFailure{Row: n, Error: err.Error()})
+				continue
+			}
+			return nil, nil, err
+		}
+		if len(rec) != len(header) {
+			failures = append(failures, BatchFailure{Row: n, Error: fmt.Sprintf("expected %d fields, got %d", len(header), len(rec))})
+			continue
+		}
+		row := BatchRow{Row: n}
+		for i, v := range rec {
+			h := header[i]
+			switch {
+			case h == "subject":
+				row.Subject = v
+			case h == "created_at_utc":
+				row.CreatedAtUTC = v
+			case strings.HasPrefix(h, "context."):
+				if row.Context == nil {
+					row.Context = map[string]string{}
+				}
+				row.Context[strings.TrimPrefix(h, "context.")] = v
+			case strings.HasPrefix(h, "evidence."):
+				if row.Evidence == nil {
+					row.Evidence = map[string]string{}
+				}
+				row.Evidence[strings.TrimPrefix(h, "evidence.")] = v
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, failures, nil
+}
+
+type batchResult struct {
+	canonical []byte
+	sig       []byte
+	err       error
+}
+
+// batchEvent is a row's unsigned event, built before dispatch so that rows
+// with the same consent_event_id can be told apart.
+type batchEvent struct {
+	ev        *ConsentEvent
+	signBytes []byte
+	err       error
+}
+
+// RecordConsentBatch records one consent event per row against a snapshot
+// that is resolved and verified once. Rows are hashed and signed by a worker
+// pool; per-row failures are collected in the summary (sorted by row) rather
+// than aborting the batch. A row whose consent_event_id repeats an earlier
+// row's fails. JSONL output is streamed in input order as rows complete.
+func RecordConsentBatch(snapshotZipPathOrID string, rows []BatchRow, opts BatchOptions) (*BatchSummary, error) {
+	if (opts.OutDir == "") == (opts.OutJSONL == nil) {
+		return nil, errors.New("exactly one of OutDir or OutJSONL is required")
+	}
+	if _, err := hex.DecodeString(strings.TrimSpace(opts.PepperHex)); err != nil || opts.PepperHex == "" {
+		return nil, errors.New("invalid pepper hex")
+	}
+	if _, err := hex.DecodeString(strings.TrimSpace(opts.TenantSaltHex)); err != nil || opts.TenantSaltHex == "" {
+		return nil, errors.New("invalid tenant_salt hex")
+	}
+	signer, err := sigenv.ResolveSigner(opts.Signer, opts.SignKeyFile, opts.SignKeyPassphrase, opts.SignPrivKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	// Workers share the key, which is read once.
+	opts.Signer, opts.SignKeyFile, opts.SignPrivKeyHex = signer, "", ""
+	defaultCreated := opts.CreatedAtUTC
+	if defaultCreated == "" {
+		defaultCreated = timefmt.Format(timefmt.NowUTC())
+	}
+	if opts.OutDir != "" {
+		if err := os.MkdirAll(opts.OutDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	snapZipBytes, snapID, policySHA, err := resolveSnapshot(snapshotZipPathOrID)
+	if err != nil {
+		return nil, err
+	}
+	policy := PolicyRef{
+		PolicySHA256:       policySHA,
+		SnapshotID:         snapID,
+		SnapshotPackSHA256: hashing.SHA256Hex(snapZipBytes),
+	}
+
+	// Duplicates would be written to the same files by two workers at once.
+	events := make([]batchEvent, len(rows))
+	firstRow := map[string]int{}
+	for i, row := range rows {
+		events[i] = newBatchEvent(policy, defaultCreated, row, opts)
+		if events[i].err != nil {
+			continue
+		}
+		id := events[i].ev.ConsentEventID
+		if first, ok := firstRow[id]; ok {
+			events[i] = batchEvent{err: fmt.Errorf("duplicate of row %d (consent_event_id %s)", first, id)}
+			continue
+		}
+		firstRow[id] = row.Row
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	type done struct {
+		i   int
+		res batchResult
+	}
+	jobs := make(chan int)
+	results := make(chan done)
+	// window bounds how far workers may run ahead of the oldest row not yet
+	// written, and with it the reorder buffer.
+	window := make(chan struct{}, 4*workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results <- done{i, signBatchEvent(events[i], opts)}
+			}
+		}()
+	}
+	go func() {
+		for i := range rows {
+			window <- struct{}{}
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	sum := &BatchSummary{SnapshotID: snapID, Total: len(rows)}
+	var writeErr error
+	pending := map[int]batchResult{}
+	next := 0
+	for d := range results {
+		pending[d.i] = d.res
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			row := rows[next].Row
+			next++
+			<-window
+			if res.err != nil {
+				sum.Failures = append(sum.Failures, BatchFailure{Row: row, Error: res.err.Error()})
+				continue
+			}
+			if opts.OutJSONL != nil && writeErr == nil {
+				line, err := json.Marshal(BatchRecord{Row: row, ConsentEvent: res.canonical, SignatureEnvelope: res.sig})
+				if err == nil {
+					_, err = opts.OutJSONL.Write(append(line, '\n'))
+				}
+				if err != nil {
+					writeErr = err
+					continue
+				}
+			}
+			sum.Recorded++
+		}
+	}
+	if writeErr != nil {
+		return sum, writeErr
+	}
+	return sum, nil
+}
+
+func newBatchEvent(policy PolicyRef, defaultCreated string, row BatchRow, opts BatchOptions) batchEvent {
+	created := row.CreatedAtUTC
+	if created == "" {
+		created = defaultCreated
+	} else if _, err := timefmt.Parse(created); err != nil {
+		return batchEvent{err: fmt.Errorf("invalid created_at_utc: %w", err)}
+	}
+	ev, signBytes, err := newConsentEvent(policy, created, RecordOptions{
+		SubjectIdentifier: row.Subject,
+		TenantSaltHex:     opts.TenantSaltHex,
+		PepperHex:         opts.PepperHex,
+		Context:           row.Context,
+		Evidence:          row.Evidence,
+	})
+	return batchEvent{ev: ev, signBytes: signBytes, err: err}
+}
+
+func signBatchEvent(be batchEvent, opts BatchOptions) batchResult {
+	if be.err != nil {
+		return batchResult{err: be.err}
+	}
+	ev := be.ev
+	outPath := ""
+	if opts.OutDir != "" {
+		outPath = filepath.Join(opts.OutDir, ev.ConsentEventID+".json")
+	}
+	signing, sigBytes, err := signEvent(be.signBytes, outPath, opts.Signer, opts.SignCertChain, opts.KeyDescription, opts.LegalEntityName)
+	if err != nil {
+		return batchResult{err: err}
+	}
+	if outPath == "" {
+		// JSONL records carry the envelope inline.
+		signing.SignatureFile = ""
+	}
+	ev.Signing = signing
+	raw, err := json.Marshal(ev)
+	if err != nil {
+		return batchResult{err: err}
+	}
+	canonical, err := jcs.CanonicalizeJSON(raw)
+	if err != nil {
+		return batchResult{err: err}
+	}
+	if err := writeEvent(outPath, canonical, signing, sigBytes, nil); err != nil {
+		return batchResult{err: err}
+	}
+	return batchResult{canonical: canonical, sig: sigBytes}
+}
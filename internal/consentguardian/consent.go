@@ -2,7 +2,9 @@ package consentguardian
 
 import (
 	"bytes"
-	"crypto/ed25519"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -15,7 +17,10 @@ import (
 	"policyguardian/internal/policylock"
 	"policyguardian/internal/shared/hashing"
 	"policyguardian/internal/shared/jcs"
+	"policyguardian/internal/shared/sigenv"
 	"policyguardian/internal/shared/timefmt"
+	"policyguardian/internal/shared/tsa"
+	"policyguardian/internal/store"
 )
 
 const (
@@ -34,6 +39,20 @@ type RecordOptions struct {
 	SignPrivKeyHex     string
 	KeyDescription     string
 	LegalEntityName    string
+
+	// Signer or SignKeyFile (any format package keys reads, decrypted with
+	// SignKeyPassphrase) replace SignPrivKeyHex, which puts the key in argv.
+	// At most one of the three may be set.
+	Signer             Signer
+	SignKeyFile        string
+	SignKeyPassphrase  []byte
+	// SignCertChain optionally certifies the signing key (leaf first); it is
+	// embedded in the envelope for VerifyOptions.SignerRoots.
+	SignCertChain      []*x509.Certificate
+
+	// TSAURL is an optional RFC 3161 time-stamping authority. The token is
+	// written beside the consent event as <out>.tst.
+	TSAURL             string
 }
 
 func normalizeIdentifier(s string) (string, error) {
@@ -113,11 +132,12 @@ func resolveSnapshot(arg string) ([]byte, string, string, error) {
 		if err != nil { return nil,"","",err }
 		return b, snap.SnapshotID, bodyHash, nil
 	}
-	store := os.Getenv("POLICYGUARDIAN_STORE")
-	if store == "" { store = ".policyguardian_store" }
-	path := filepath.Join(store, "snapshots", arg+".zip")
-	b, err := os.ReadFile(path)
-	if err != nil { return nil,"","",fmt.Errorf("snapshot not found: %s", arg) }
+	if err := store.ValidateID(arg); err != nil { return nil,"","",fmt.Errorf("snapshot not found: %s (not a file, and not a snapshot_id)", arg) }
+	st, err := store.OpenFS(store.DefaultDir())
+	if err != nil { return nil,"","",err }
+	b, _, err := st.Get(store.KindSnapshot, arg)
+	if errors.Is(err, store.ErrNotFound) { return nil,"","",fmt.Errorf("snapshot not found: %s", arg) }
+	if err != nil { return nil,"","",fmt.Errorf("snapshot %s: %w", arg, err) }
 	status, reason, err := policylock.VerifySnapshotZip(b)
 	if err != nil { return nil,"","",err }
 	if status != "VALID" { return nil,"","",fmt.Errorf("snapshot invalid: %s", reason) }
@@ -133,19 +153,44 @@ func RecordConsent(snapshotZipPathOrID string, outPath string, opts RecordOption
 	snapZipBytes, snapID, policySHA, err := resolveSnapshot(snapshotZipPathOrID)
 	if err != nil { return nil,nil,nil,err }
 
-	packSHA := hashing.SHA256Hex(snapZipBytes)
-	subHash, err := SubjectIDHash(opts.SubjectIdentifier, opts.PepperHex, opts.TenantSaltHex)
+	policy := PolicyRef{
+		PolicySHA256: policySHA,
+		SnapshotID: snapID,
+		SnapshotPackSHA256: hashing.SHA256Hex(snapZipBytes),
+	}
+	ev, signBytes, err := newConsentEvent(policy, created, opts)
+	if err != nil { return nil,nil,nil,err }
+
+	signer, err := sigenv.ResolveSigner(opts.Signer, opts.SignKeyFile, opts.SignKeyPassphrase, opts.SignPrivKeyHex)
+	if err != nil { return nil,nil,nil,err }
+	signing, sigBytes, err := signEvent(signBytes, outPath, signer, opts.SignCertChain, opts.KeyDescription, opts.LegalEntityName)
+	if err != nil { return nil,nil,nil,err }
+	ev.Signing = signing
+	stamp, tokenBytes, err := stampEvent(signBytes, outPath, opts.TSAURL)
 	if err != nil { return nil,nil,nil,err }
+	ev.Timestamp = stamp
+
+	evRaw, err := json.Marshal(ev)
+	if err != nil { return nil,nil,nil,err }
+	evCanonical, err := jcs.CanonicalizeJSON(evRaw)
+	if err != nil { return nil,nil,nil,err }
+
+	if err := writeEvent(outPath, evCanonical, signing, sigBytes, tokenBytes); err != nil { return nil,nil,nil,err }
+
+	return ev, evCanonical, sigBytes, nil
+}
+
+// newConsentEvent builds the event for one subject and fills in its hashes.
+// It returns the event and its JCS sign payload bytes.
+func newConsentEvent(policy PolicyRef, created string, opts RecordOptions) (*ConsentEvent, []byte, error) {
+	subHash, err := SubjectIDHash(opts.SubjectIdentifier, opts.PepperHex, opts.TenantSaltHex)
+	if err != nil { return nil,nil,err }
 
 	ev := &ConsentEvent{
 		Schema: SchemaConsentEvent,
 		SpecURL: SpecURLPolicyGuardian,
 		CreatedAtUTC: created,
-		Policy: PolicyRef{
-			PolicySHA256: policySHA,
-			SnapshotID: snapID,
-			SnapshotPackSHA256: packSHA,
-		},
+		Policy: policy,
 		Subject: SubjectRef{
 			SubjectIDHash: subHash,
 			HashAlgorithm: "sha2-256",
@@ -156,53 +201,11 @@ func RecordConsent(snapshotZipPathOrID string, outPath string, opts RecordOption
 
 	signPayload := BuildConsentSignPayload(*ev)
 	signBytes, err := jcs.CanonicalizeValue(signPayload)
-	if err != nil { return nil,nil,nil,err }
+	if err != nil { return nil,nil,err }
 	expHash := hashing.SHA256Hex(signBytes)
 	ev.Hashes = map[string]string{"sha2-256": expHash}
 	ev.ConsentEventID = expHash
-
-	var sigBytes []byte
-	if opts.SignPrivKeyHex != "" {
-		priv, err := hex.DecodeString(strings.TrimSpace(opts.SignPrivKeyHex))
-		if err != nil { return nil,nil,nil,errors.New("invalid ed25519 private key hex") }
-		if len(priv)!=ed25519.PrivateKeySize { return nil,nil,nil,fmt.Errorf("invalid ed25519 private key length: %d", len(priv)) }
-		pub := ed25519.PrivateKey(priv).Public().(ed25519.PublicKey)
-		sig := ed25519.Sign(ed25519.PrivateKey(priv), signBytes)
-		env := map[string]any{
-			"schema": "policyguardian.signature_envelope.v0.1",
-			"algorithm": "ed25519",
-			"public_key": hex.EncodeToString(pub),
-			"signature": hex.EncodeToString(sig),
-			"payload_hashes": map[string]any{
-				"sha2-256": expHash,
-			},
-		}
-		sigBytes, err = jcs.CanonicalizeValue(env)
-		if err != nil { return nil,nil,nil,err }
-		if ev.Signing == nil { ev.Signing = &SigningInfo{} }
-		ev.Signing.Mode = "ed25519"
-		ev.Signing.Algorithm = "ed25519"
-		ev.Signing.PublicKey = hex.EncodeToString(pub)
-		ev.Signing.KeyDescription = opts.KeyDescription
-		ev.Signing.LegalEntityName = opts.LegalEntityName
-		ev.Signing.SignatureFile = filepath.Base(outPath)+".sig.ed25519.json"
-	} else {
-		ev.Signing = &SigningInfo{Mode:"none"}
-	}
-
-	evRaw, err := json.Marshal(ev)
-	if err != nil { return nil,nil,nil,err }
-	evCanonical, err := jcs.CanonicalizeJSON(evRaw)
-	if err != nil { return nil,nil,nil,err }
-
-	if outPath != "" {
-		if err := os.WriteFile(outPath, evCanonical, 0644); err != nil { return nil,nil,nil,err }
-		if sigBytes != nil {
-			if err := os.WriteFile(outPath+".sig.ed25519.json", sigBytes, 0644); err != nil { return nil,nil,nil,err }
-		}
-	}
-
-	return ev, evCanonical, sigBytes, nil
+	return ev, signBytes, nil
 }
 
 // VerifyConsent verifies a consent event from raw JSON bytes.
@@ -244,22 +247,40 @@ func VerifyConsent(consentJSON []byte, resolveSnapshotStore bool) (string, strin
 	return "VALID","",nil
 }
 
-type signatureEnvelope struct {
-	Schema       string            `json:"schema"`
-	Algorithm    string            `json:"algorithm"`
-	PublicKey    string            `json:"public_key"`
-	Signature    string            `json:"signature"`
-	PayloadHashes map[string]string `json:"payload_hashes"`
+// VerifyOptions tunes VerifyConsentFileWithOptions.
+type VerifyOptions struct {
+	ResolveSnapshot bool
+	// TSARoots, when set, requires an RFC 3161 token whose signer chains to
+	// one of these roots. Without it a present token's imprint and signature
+	// are still checked but its certificate chain is not.
+	TSARoots *x509.CertPool
+	// TrustedKeys, when set, requires a signature by one of its keys that is
+	// valid and not revoked at the event's created_at_utc. Without it any
+	// key that verifies the envelope is accepted.
+	TrustedKeys *Keyring
+	// SignerRoots, when set, requires an envelope certificate chain that
+	// certifies the signing key and chains to these roots at the event's
+	// created_at_utc, with a leaf usable for signing (see
+	// sigenv.VerifyChain). SignerCertificate then returns the verified
+	// signer identity.
+	SignerRoots *x509.CertPool
 }
 
-// VerifyConsentFile verifies a consent.json file and (if signing.mode==ed25519)
-// verifies the companion signature envelope file in the same directory.
+// VerifyConsentFile verifies a consent.json file and (if signing.mode names a
+// signature algorithm) verifies the companion signature envelope file in the
+// same directory.
 // It returns (status, reason, unsignedWarning, error).
 func VerifyConsentFile(consentPath string, resolveSnapshotStore bool) (string, string, bool, error) {
+	return VerifyConsentFileWithOptions(consentPath, VerifyOptions{ResolveSnapshot: resolveSnapshotStore})
+}
+
+// VerifyConsentFileWithOptions is VerifyConsentFile that also verifies the
+// companion <consent>.tst timestamp token when present.
+func VerifyConsentFileWithOptions(consentPath string, opts VerifyOptions) (string, string, bool, error) {
 	b, err := os.ReadFile(consentPath)
 	if err != nil { return "","",false, err }
 	// First verify hashes and optional snapshot resolution.
-	st, reason, err := VerifyConsent(b, resolveSnapshotStore)
+	st, reason, err := VerifyConsent(b, opts.ResolveSnapshot)
 	if err != nil { return "","",false, err }
 	if st != "VALID" {
 		return st, reason, false, nil
@@ -271,67 +292,196 @@ func VerifyConsentFile(consentPath string, resolveSnapshotStore bool) (string, s
 	if err := dec.Decode(&ev); err != nil {
 		return "INVALID","invalid_json",false,nil
 	}
-	unsigned := false
-	if ev.Signing == nil || ev.Signing.Mode == "none" {
-		unsigned = true
-		return "VALID","",unsigned,nil
-	}
-	if ev.Signing.Mode != "ed25519" {
-		return "INVALID","unsupported_signing_mode",false,nil
-	}
 	// Rebuild payload bytes.
 	signPayload := BuildConsentSignPayload(ev)
 	signBytes, err := jcs.CanonicalizeValue(signPayload)
 	if err != nil { return "INVALID","jcs_error",false,nil }
-	expHash := hashing.SHA256Hex(signBytes)
+	if st, reason := verifyTimestamp(consentPath, ev.Timestamp, signBytes, opts.TSARoots); st != "VALID" {
+		return st, reason, false, nil
+	}
+	st, reason, unsigned := verifySignature(consentPath, ev.Signing, signBytes, ev.CreatedAtUTC, opts)
+	return st, reason, unsigned, nil
+}
 
-	// Determine signature file path.
-	sigName := ev.Signing.SignatureFile
+// signEvent signs signBytes when signer is set. The envelope is written
+// beside the event as <out>.sig.<algorithm>.json by writeEvent.
+func signEvent(signBytes []byte, outPath string, signer crypto.Signer, chain []*x509.Certificate, keyDescription, legalEntityName string) (*SigningInfo, []byte, error) {
+	if signer == nil {
+		if len(chain) > 0 { return nil,nil,errors.New("a signer certificate chain requires a signing key") }
+		return &SigningInfo{Mode:"none"}, nil, nil
+	}
+	env, raw, err := sigenv.SignWithChain(signer, chain, signBytes)
+	if err != nil { return nil,nil,err }
+	return &SigningInfo{
+		Mode: env.Algorithm,
+		Algorithm: env.Algorithm,
+		PublicKey: env.PublicKey,
+		KeyID: env.KeyID,
+		KeyDescription: keyDescription,
+		LegalEntityName: legalEntityName,
+		SignatureFile: signatureFileName(outPath, env.Algorithm),
+	}, raw, nil
+}
+
+// stampEvent requests an RFC 3161 token over sha2-256(signBytes) when
+// tsaURL is set. The token is written beside the event as <out>.tst.
+func stampEvent(signBytes []byte, outPath, tsaURL string) (*TimestampInfo, []byte, error) {
+	if tsaURL == "" {
+		return nil, nil, nil
+	}
+	digest := sha256.Sum256(signBytes)
+	token, err := tsa.Request(tsaURL, digest[:])
+	if err != nil { return nil,nil,fmt.Errorf("tsa: %w", err) }
+	info, reason := tsa.Verify(token, digest[:], nil)
+	if reason != "" { return nil,nil,fmt.Errorf("tsa: %s", reason) }
+	return &TimestampInfo{
+		Mode: "rfc3161",
+		GenTimeUTC: timefmt.Format(info.GenTime),
+		TokenFile: filepath.Base(outPath)+".tst",
+	}, token, nil
+}
+
+// signatureFileName is the default envelope file name of an event.
+func signatureFileName(eventPath, algorithm string) string {
+	return filepath.Base(eventPath)+".sig."+algorithm+".json"
+}
+
+// writeEvent writes the canonical event and its optional companion files.
+// An empty outPath writes nothing.
+func writeEvent(outPath string, evCanonical []byte, signing *SigningInfo, sigBytes, tokenBytes []byte) error {
+	if outPath == "" {
+		return nil
+	}
+	if err := os.WriteFile(outPath, evCanonical, 0644); err != nil { return err }
+	if sigBytes != nil {
+		sigPath := filepath.Join(filepath.Dir(outPath), signatureFileName(outPath, signing.Algorithm))
+		if err := os.WriteFile(sigPath, sigBytes, 0644); err != nil { return err }
+	}
+	if tokenBytes != nil {
+		if err := os.WriteFile(outPath+".tst", tokenBytes, 0644); err != nil { return err }
+	}
+	return nil
+}
+
+// readEnvelope loads the companion signature envelope named by signing.
+// It returns a reason code on failure.
+func readEnvelope(eventPath string, signing *SigningInfo) (*sigenv.Envelope, string) {
+	sigName := signing.SignatureFile
 	if sigName == "" {
-		sigName = filepath.Base(consentPath) + ".sig.ed25519.json"
+		sigName = signatureFileName(eventPath, signing.Mode)
 	}
-	sigPath := filepath.Join(filepath.Dir(consentPath), sigName)
-	sigRaw, err := os.ReadFile(sigPath)
+	sigRaw, err := os.ReadFile(filepath.Join(filepath.Dir(eventPath), sigName))
 	if err != nil {
-		return "INVALID","signature_missing",false,nil
-	}
-	var env signatureEnvelope
-	dec2 := json.NewDecoder(bytes.NewReader(sigRaw))
-	dec2.UseNumber()
-	if err := dec2.Decode(&env); err != nil {
-		return "INVALID","invalid_signature_json",false,nil
+		return nil, "signature_missing"
 	}
-	if env.Schema != "policyguardian.signature_envelope.v0.1" {
-		return "INVALID","wrong_signature_schema",false,nil
+	return sigenv.Parse(sigRaw)
+}
+
+// verifySignature checks the companion signature envelope of the event at
+// eventPath and, with a keyring or signer roots, that its key was trusted
+// at createdAtUTC. It returns (status, reason, unsignedWarning).
+func verifySignature(eventPath string, signing *SigningInfo, signBytes []byte, createdAtUTC string, opts VerifyOptions) (string, string, bool) {
+	if signing == nil || signing.Mode == "none" {
+		if opts.TrustedKeys != nil || opts.SignerRoots != nil { return "INVALID","signature_required",false }
+		return "VALID","",true
+	}
+	if !sigenv.Supported(signing.Mode) {
+		return "INVALID","unsupported_signing_mode",false
+	}
+	env, reason := readEnvelope(eventPath, signing)
+	if reason != "" {
+		return "INVALID",reason,false
+	}
+	if reason := sigenv.Verify(env, signBytes); reason != "" {
+		return "INVALID",reason,false
+	}
+	if env.Algorithm != signing.Mode {
+		return "INVALID","signature_algorithm_mismatch",false
+	}
+	if signing.KeyID != "" && signing.KeyID != env.SignerKeyID() {
+		return "INVALID","signer_key_id_mismatch",false
+	}
+	if opts.TrustedKeys == nil && opts.SignerRoots == nil {
+		return "VALID","",false
+	}
+	at, err := timefmt.Parse(createdAtUTC)
+	if err != nil { return "INVALID","invalid_created_at_utc",false }
+	if opts.TrustedKeys != nil {
+		if reason := opts.TrustedKeys.check(env.SignerKeyID(), at); reason != "" {
+			return "INVALID",reason,false
+		}
 	}
-	if env.Algorithm != "ed25519" {
-		return "INVALID","wrong_signature_algorithm",false,nil
+	if opts.SignerRoots != nil {
+		if _, reason := sigenv.VerifyChain(env, opts.SignerRoots, at); reason != "" {
+			return "INVALID",reason,false
+		}
 	}
-	ph, ok := env.PayloadHashes["sha2-256"]
-	if !ok || ph == "" {
-		return "INVALID","missing_signature_payload_hash",false,nil
+	return "VALID","",false
+}
+
+// SignerCertificate returns the leaf of the certificate chain in the
+// signature envelope of the consent event or revocation at eventPath, or
+// nil when the event is unsigned or its envelope has no chain. It does not
+// verify anything: call it after verifying with VerifyOptions.SignerRoots.
+func SignerCertificate(eventPath string) (*x509.Certificate, error) {
+	b, err := os.ReadFile(eventPath)
+	if err != nil { return nil, err }
+	var ev struct {
+		Signing *SigningInfo `json:"signing"`
+	}
+	if err := json.Unmarshal(b, &ev); err != nil { return nil, err }
+	if ev.Signing == nil || ev.Signing.Mode == "none" {
+		return nil, nil
 	}
-	if ph != expHash {
-		return "INVALID","signature_payload_hash_mismatch",false,nil
+	env, reason := readEnvelope(eventPath, ev.Signing)
+	if reason != "" { return nil, errors.New(reason) }
+	chain, err := env.Certificates()
+	if err != nil || len(chain) == 0 { return nil, err }
+	return chain[0], nil
+}
+
+func verifyTimestamp(eventPath string, ts *TimestampInfo, signBytes []byte, roots *x509.CertPool) (string, string) {
+	if ts == nil {
+		if roots != nil { return "INVALID","timestamp_missing" }
+		return "VALID",""
 	}
-	pub, err := hex.DecodeString(strings.TrimSpace(env.PublicKey))
-	if err != nil || len(pub) != ed25519.PublicKeySize {
-		return "INVALID","invalid_public_key",false,nil
+	if ts.Mode != "rfc3161" {
+		return "INVALID","unsupported_timestamp_mode"
 	}
-	sig, err := hex.DecodeString(strings.TrimSpace(env.Signature))
-	if err != nil || len(sig) != ed25519.SignatureSize {
-		return "INVALID","invalid_signature",false,nil
+	name := ts.TokenFile
+	if name == "" {
+		name = filepath.Base(eventPath) + ".tst"
 	}
-	if !ed25519.Verify(ed25519.PublicKey(pub), signBytes, sig) {
-		return "INVALID","signature_verify_failed",false,nil
+	token, err := os.ReadFile(filepath.Join(filepath.Dir(eventPath), filepath.Base(name)))
+	if err != nil {
+		return "INVALID","timestamp_missing"
 	}
-	// Also ensure event hashes match expected, defensively.
-	if ev.Hashes == nil || ev.Hashes["sha2-256"] != expHash {
-		return "INVALID","hash_mismatch",false,nil
+	digest := sha256.Sum256(signBytes)
+	info, reason := tsa.Verify(token, digest[:], roots)
+	if reason != "" {
+		return "INVALID",reason
 	}
-	// consent_event_id is allowed to be empty, but if present must match.
-	if ev.ConsentEventID != "" && ev.ConsentEventID != expHash {
-		return "INVALID","consent_event_id_mismatch",false,nil
+	if timefmt.Format(info.GenTime) != ts.GenTimeUTC {
+		return "INVALID","timestamp_gen_time_mismatch"
 	}
-	return "VALID","",false,nil
+	return "VALID",""
+}
+
+// StoreMeta returns the evidence store index entry for a consent event.
+func StoreMeta(eventJSON []byte) (store.Meta, error) {
+	var ev ConsentEvent
+	if err := json.Unmarshal(eventJSON, &ev); err != nil {
+		return store.Meta{}, err
+	}
+	id := ev.ConsentEventID
+	if id == "" {
+		id = ev.Hashes["sha2-256"]
+	}
+	return store.Meta{
+		Kind:         store.KindConsentEvent,
+		ID:           id,
+		CreatedAtUTC: ev.CreatedAtUTC,
+		PolicySHA256: ev.Policy.PolicySHA256,
+		SnapshotID:   ev.Policy.SnapshotID,
+	}, nil
 }
@@ -1,14 +1,35 @@
 package consentguardian
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"policyguardian/internal/policylock"
 	"policyguardian/internal/shared/hashing"
 	"policyguardian/internal/shared/jcs"
+	"policyguardian/internal/shared/keys"
+	"policyguardian/internal/shared/tsa"
 )
 
 func TestSubjectNormalization(t *testing.T) {
@@ -86,3 +107,683 @@ func TestConsentTamperFails(t *testing.T) {
 		t.Fatalf("expected INVALID, got %s", st)
 	}
 }
+
+func TestTimestampedConsentVerifies(t *testing.T) {
+	srv, err := tsa.LoadOrCreate(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+
+	opts := policylock.SnapshotOptions{CreatedAtUTC: "2026-01-01T00:00:00Z", ToolVersion: "policyguardian/v0.1.0-test", UserAgent: "policyguardian/v0.1.0-test"}
+	zipb, _, err := policylock.SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	snapPath := filepath.Join(dir, "snap.zip")
+	if err := os.WriteFile(snapPath, zipb, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "consent.json")
+	ev, _, _, err := RecordConsent(snapPath, out, RecordOptions{
+		CreatedAtUTC:      "2026-01-01T00:00:01Z",
+		SubjectIdentifier: "alice@example.com",
+		TenantSaltHex:     "bb",
+		PepperHex:         "aa",
+		TSAURL:            hs.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Timestamp == nil || ev.Timestamp.TokenFile != "consent.json.tst" {
+		t.Fatalf("expected timestamp metadata, got %+v", ev.Timestamp)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Cert)
+	st, reason, _, err := VerifyConsentFileWithOptions(out, VerifyOptions{TSARoots: roots})
+	if err != nil || st != "VALID" {
+		t.Fatalf("expected VALID, got %s %s %v", st, reason, err)
+	}
+
+	if err := os.Remove(out + ".tst"); err != nil {
+		t.Fatal(err)
+	}
+	st, reason, _, _ = VerifyConsentFile(out, false)
+	if st != "INVALID" || reason != "timestamp_missing" {
+		t.Fatalf("expected INVALID timestamp_missing, got %s %s", st, reason)
+	}
+}
+
+func TestRevocationEffectiveConsent(t *testing.T) {
+	opts := policylock.SnapshotOptions{CreatedAtUTC: "2026-01-01T00:00:00Z", ToolVersion: "policyguardian/v0.1.0-test", UserAgent: "policyguardian/v0.1.0-test"}
+	zipb, _, err := policylock.SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	snapPath := filepath.Join(dir, "snap.zip")
+	if err := os.WriteFile(snapPath, zipb, 0644); err != nil {
+		t.Fatal(err)
+	}
+	consentPath := filepath.Join(dir, "consent.json")
+	ev, _, _, err := RecordConsent(snapPath, consentPath, RecordOptions{
+		CreatedAtUTC:      "2026-02-01T00:00:00Z",
+		SubjectIdentifier: "alice@example.com",
+		TenantSaltHex:     "bb",
+		PepperHex:         "aa",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := RevokeConsent(consentPath, "", RevokeOptions{CreatedAtUTC: "2026-01-15T00:00:00Z"}); err == nil {
+		t.Fatal("expected error for revocation before consent")
+	}
+	revPath := filepath.Join(dir, "revocation.json")
+	rv, _, _, err := RevokeConsent(consentPath, revPath, RevokeOptions{
+		CreatedAtUTC: "2026-03-01T00:00:00Z",
+		Context:      map[string]string{"reason": "user request"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rv.Revokes.ConsentEventID != ev.ConsentEventID || rv.RevocationEventID == "" {
+		t.Fatalf("unexpected revocation: %+v", rv)
+	}
+	if st, reason, _, _ := VerifyEventFile(revPath, VerifyOptions{}); st != "VALID" {
+		t.Fatalf("expected VALID revocation, got %s %s", st, reason)
+	}
+
+	for _, tc := range []struct{ at, state string }{
+		{"2026-01-20T00:00:00Z", "not_yet_given"},
+		{"2026-02-15T00:00:00Z", "in_force"},
+		{"2026-03-01T00:00:00Z", "revoked"},
+	} {
+		st, reason, eff, err := ResolveEffective([]string{consentPath, revPath}, "", tc.at, VerifyOptions{})
+		if err != nil || st != "VALID" {
+			t.Fatalf("%s: expected VALID, got %s %s %v", tc.at, st, reason, err)
+		}
+		if eff.State != tc.state {
+			t.Fatalf("%s: expected %s, got %s", tc.at, tc.state, eff.State)
+		}
+	}
+
+	// A revocation pointing at the consent with another subject is rejected.
+	b, _ := os.ReadFile(revPath)
+	var forged ConsentRevocation
+	if err := json.Unmarshal(b, &forged); err != nil {
+		t.Fatal(err)
+	}
+	forged.Revokes.Subject.SubjectIDHash = strings.Repeat("3", 64)
+	sb, _ := jcs.CanonicalizeValue(BuildRevocationSignPayload(forged))
+	forged.Hashes["sha2-256"] = hashing.SHA256Hex(sb)
+	forged.RevocationEventID = forged.Hashes["sha2-256"]
+	raw, _ := json.Marshal(forged)
+	forgedPath := filepath.Join(dir, "forged.json")
+	if err := os.WriteFile(forgedPath, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	st, reason, _, err := ResolveEffective([]string{consentPath, forgedPath}, "", "2026-04-01T00:00:00Z", VerifyOptions{})
+	if err != nil || st != "INVALID" || reason != "revocation_subject_mismatch" {
+		t.Fatalf("expected INVALID revocation_subject_mismatch, got %s %s %v", st, reason, err)
+	}
+}
+
+func TestRecordConsentBatch(t *testing.T) {
+	opts := policylock.SnapshotOptions{CreatedAtUTC: "2026-01-01T00:00:00Z", ToolVersion: "policyguardian/v0.1.0-test", UserAgent: "policyguardian/v0.1.0-test"}
+	zipb, _, err := policylock.SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	snapPath := filepath.Join(dir, "snap.zip")
+	if err := os.WriteFile(snapPath, zipb, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	csvIn := "subject,created_at_utc,context.channel\n" +
+		"alice@example.com,,web\n" +
+		"bob@example.com,yesterday,web\n" +
+		"   ,,app\n" +
+		"carol@example.com,2026-01-03T00:00:00Z,\n"
+	rows, failures, err := ReadBatchRows(strings.NewReader(csvIn), "csv")
+	if err != nil || len(failures) != 0 || len(rows) != 4 {
+		t.Fatalf("read csv: %d rows %v %v", len(rows), failures, err)
+	}
+	priv := hex.EncodeToString(ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize)))
+	outDir := filepath.Join(dir, "events")
+	sum, err := RecordConsentBatch(snapPath, rows, BatchOptions{
+		CreatedAtUTC:   "2026-01-02T00:00:00Z",
+		TenantSaltHex:  "bb",
+		PepperHex:      "aa",
+		SignPrivKeyHex: priv,
+		Workers:        3,
+		OutDir:         outDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Recorded != 2 || len(sum.Failures) != 2 || sum.Failures[0].Row != 2 || sum.Failures[1].Row != 3 {
+		t.Fatalf("unexpected summary: %+v", sum)
+	}
+	files, _ := filepath.Glob(filepath.Join(outDir, "*.json"))
+	var events []string
+	for _, f := range files {
+		if !strings.HasSuffix(f, ".sig.ed25519.json") {
+			events = append(events, f)
+		}
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 event files, got %v", files)
+	}
+	for _, f := range events {
+		if st, reason, unsigned, err := VerifyConsentFile(f, false); st != "VALID" || unsigned || err != nil {
+			t.Fatalf("%s: %s %s %v", f, st, reason, err)
+		}
+	}
+
+	// Single-row record and batch record of the same input are identical.
+	single, _, _, err := RecordConsent(snapPath, "", RecordOptions{
+		CreatedAtUTC:      "2026-01-02T00:00:00Z",
+		SubjectIdentifier: "alice@example.com",
+		TenantSaltHex:     "bb",
+		PepperHex:         "aa",
+		Context:           map[string]string{"channel": "web"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, single.ConsentEventID+".json")); err != nil {
+		t.Fatalf("batch event id differs from RecordConsent: %v", err)
+	}
+
+	jsonlIn := `{"subject":"alice@example.com","context":{"channel":"web"}}` + "\n\n" + `{"subject":1}` + "\n"
+	rows, failures, err = ReadBatchRows(strings.NewReader(jsonlIn), "jsonl")
+	if err != nil || len(rows) != 1 || len(failures) != 1 || failures[0].Row != 3 {
+		t.Fatalf("read jsonl: %v %v %v", rows, failures, err)
+	}
+	var buf strings.Builder
+	sum, err = RecordConsentBatch(snapPath, rows, BatchOptions{
+		CreatedAtUTC:  "2026-01-02T00:00:00Z",
+		TenantSaltHex: "bb",
+		PepperHex:     "aa",
+		OutJSONL:      &buf,
+	})
+	if err != nil || sum.Recorded != 1 {
+		t.Fatalf("jsonl batch: %+v %v", sum, err)
+	}
+	var rec BatchRecord
+	if err := json.Unmarshal([]byte(buf.String()), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if st, reason, _ := VerifyConsent(rec.ConsentEvent, false); st != "VALID" || rec.Row != 1 {
+		t.Fatalf("jsonl record: %s %s row %d", st, reason, rec.Row)
+	}
+}
+
+// gatedSigner blocks its gateAt-th signature until the first JSONL line has
+// been written.
+type gatedSigner struct {
+	ed25519.PrivateKey
+	calls   atomic.Int32
+	gateAt  int32
+	written chan struct{}
+}
+
+func (g *gatedSigner) Sign(r io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if g.calls.Add(1) == g.gateAt {
+		select {
+		case <-g.written:
+		case <-time.After(5 * time.Second):
+			return nil, errors.New("output was not streamed")
+		}
+	}
+	return g.PrivateKey.Sign(r, msg, opts)
+}
+
+type signalWriter struct {
+	strings.Builder
+	once    sync.Once
+	written chan struct{}
+}
+
+func (w *signalWriter) Write(p []byte) (int, error) {
+	defer w.once.Do(func() { close(w.written) })
+	return w.Builder.Write(p)
+}
+
+func TestRecordConsentBatchDuplicatesAndStreaming(t *testing.T) {
+	opts := policylock.SnapshotOptions{CreatedAtUTC: "2026-01-01T00:00:00Z", ToolVersion: "policyguardian/v0.1.0-test", UserAgent: "policyguardian/v0.1.0-test"}
+	zipb, _, err := policylock.SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	snapPath := filepath.Join(dir, "snap.zip")
+	if err := os.WriteFile(snapPath, zipb, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var rows []BatchRow
+	for i, subj := range []string{"alice@example.com", "bob@example.com", "ALICE@example.com", "carol@example.com", "dave@example.com"} {
+		rows = append(rows, BatchRow{Row: i + 1, Subject: subj})
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outDir := filepath.Join(dir, "events")
+	sum, err := RecordConsentBatch(snapPath, rows, BatchOptions{
+		CreatedAtUTC:  "2026-01-02T00:00:00Z",
+		TenantSaltHex: "bb",
+		PepperHex:     "aa",
+		Signer:        ecKey,
+		Workers:       4,
+		OutDir:        outDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Subjects are normalized, so row 3 repeats row 1.
+	if sum.Recorded != 4 || len(sum.Failures) != 1 || sum.Failures[0].Row != 3 || !strings.Contains(sum.Failures[0].Error, "duplicate of row 1") {
+		t.Fatalf("unexpected summary: %+v", sum)
+	}
+	files, _ := filepath.Glob(filepath.Join(outDir, "*.json"))
+	var events []string
+	for _, f := range files {
+		if !strings.Contains(f, ".sig.") {
+			events = append(events, f)
+		}
+	}
+	if len(events) != 4 {
+		t.Fatalf("expected 4 event files, got %v", events)
+	}
+	for _, f := range events {
+		if st, reason, _, err := VerifyConsentFile(f, false); st != "VALID" || err != nil {
+			t.Fatalf("%s: %s %s %v", f, st, reason, err)
+		}
+	}
+
+	// With one worker rows are signed in order; the last one is held until
+	// the first line is out.
+	rows = append(rows[:2], rows[3:]...)
+	written := make(chan struct{})
+	var out signalWriter
+	out.written = written
+	sum, err = RecordConsentBatch(snapPath, rows, BatchOptions{
+		CreatedAtUTC:  "2026-01-02T00:00:00Z",
+		TenantSaltHex: "bb",
+		PepperHex:     "aa",
+		Signer:        &gatedSigner{PrivateKey: ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize)), gateAt: int32(len(rows)), written: written},
+		Workers:       1,
+		OutJSONL:      &out,
+	})
+	if err != nil || sum.Recorded != len(rows) || len(sum.Failures) != 0 {
+		t.Fatalf("jsonl batch: %+v %v", sum, err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	for i, line := range lines {
+		var rec BatchRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil || rec.Row != rows[i].Row {
+			t.Fatalf("line %d: row %d %v", i, rec.Row, err)
+		}
+	}
+}
+
+func TestRecordConsentWithKeyFile(t *testing.T) {
+	opts := policylock.SnapshotOptions{CreatedAtUTC: "2026-01-01T00:00:00Z", ToolVersion: "policyguardian/v0.1.0-test", UserAgent: "policyguardian/v0.1.0-test"}
+	zipb, _, err := policylock.SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	snapPath := filepath.Join(dir, "snap.zip")
+	if err := os.WriteFile(snapPath, zipb, 0644); err != nil {
+		t.Fatal(err)
+	}
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{9}, ed25519.SeedSize))
+	keyID, _ := keys.KeyID(key.Public())
+	pem, err := keys.Marshal(key, keys.FormatPKCS8Encrypted, []byte("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "key.pem")
+	if err := keys.WriteFile(keyPath, pem); err != nil {
+		t.Fatal(err)
+	}
+	base := RecordOptions{
+		CreatedAtUTC:      "2026-01-01T00:00:01Z",
+		SubjectIdentifier: "alice@example.com",
+		TenantSaltHex:     "bb",
+		PepperHex:         "aa",
+	}
+
+	fileOpts := base
+	fileOpts.SignKeyFile, fileOpts.SignKeyPassphrase = keyPath, []byte("s3cret")
+	out := filepath.Join(dir, "consent.json")
+	ev, _, _, err := RecordConsent(snapPath, out, fileOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Signing.KeyID != keyID || ev.Signing.PublicKey != hex.EncodeToString(key.Public().(ed25519.PublicKey)) {
+		t.Fatalf("unexpected signing info %+v", ev.Signing)
+	}
+	if st, reason, unsigned, err := VerifyConsentFile(out, false); st != "VALID" || unsigned || err != nil {
+		t.Fatalf("expected VALID, got %s %s %v", st, reason, err)
+	}
+
+	// A crypto.Signer gives the same key ID and signature file.
+	signerOpts := base
+	signerOpts.Signer = key
+	out2 := filepath.Join(dir, "consent2.json")
+	if ev2, _, _, err := RecordConsent(snapPath, out2, signerOpts); err != nil || ev2.Signing.KeyID != keyID {
+		t.Fatalf("signer: %+v %v", ev2, err)
+	}
+	sig1, _ := os.ReadFile(out + ".sig.ed25519.json")
+	sig2, _ := os.ReadFile(out2 + ".sig.ed25519.json")
+	if !bytes.Equal(sig1, sig2) {
+		t.Fatalf("key file and crypto.Signer signatures differ")
+	}
+
+	// The key ID in the event must match the envelope's public key.
+	raw, _ := os.ReadFile(out)
+	tampered := bytes.Replace(raw, []byte(keyID), []byte(strings.Repeat("0", 64)), 1)
+	if err := os.WriteFile(out, tampered, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if st, reason, _, _ := VerifyConsentFile(out, false); st != "INVALID" || reason != "signer_key_id_mismatch" {
+		t.Fatalf("expected INVALID signer_key_id_mismatch, got %s %s", st, reason)
+	}
+
+	wrong := fileOpts
+	wrong.SignKeyPassphrase = []byte("nope")
+	if _, _, _, err := RecordConsent(snapPath, "", wrong); !errors.Is(err, keys.ErrBadPassphrase) {
+		t.Fatalf("expected ErrBadPassphrase, got %v", err)
+	}
+	both := fileOpts
+	both.Signer = key
+	if _, _, _, err := RecordConsent(snapPath, "", both); err == nil {
+		t.Fatalf("expected error for two signing keys")
+	}
+}
+
+func TestConsentSignatureAlgorithms(t *testing.T) {
+	opts := policylock.SnapshotOptions{CreatedAtUTC: "2026-01-01T00:00:00Z", ToolVersion: "policyguardian/v0.1.0-test", UserAgent: "policyguardian/v0.1.0-test"}
+	zipb, _, err := policylock.SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	snapPath := filepath.Join(dir, "snap.zip")
+	if err := os.WriteFile(snapPath, zipb, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for alg, key := range map[string]crypto.Signer{keys.AlgECDSAP256: ecKey, keys.AlgRSAPSS: rsaKey} {
+		out := filepath.Join(dir, alg+".json")
+		ev, _, _, err := RecordConsent(snapPath, out, RecordOptions{
+			CreatedAtUTC:      "2026-01-01T00:00:01Z",
+			SubjectIdentifier: "alice@example.com",
+			TenantSaltHex:     "bb",
+			PepperHex:         "aa",
+			Signer:            key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.Signing.Mode != alg || ev.Signing.SignatureFile != alg+".json.sig."+alg+".json" {
+			t.Fatalf("%s: signing %+v", alg, ev.Signing)
+		}
+		if st, reason, _, err := VerifyConsentFile(out, false); st != "VALID" || err != nil {
+			t.Fatalf("%s: expected VALID, got %s %s %v", alg, st, reason, err)
+		}
+		rv := filepath.Join(dir, alg+"-revocation.json")
+		if _, _, _, err := RevokeConsent(out, rv, RevokeOptions{CreatedAtUTC: "2026-01-02T00:00:00Z", Signer: key}); err != nil {
+			t.Fatal(err)
+		}
+		if st, reason, _, err := VerifyRevocationFile(rv, VerifyOptions{}); st != "VALID" || err != nil {
+			t.Fatalf("%s revocation: expected VALID, got %s %s %v", alg, st, reason, err)
+		}
+
+		// signing.mode is not covered by the signature; a mode that
+		// disagrees with the envelope is rejected.
+		raw, _ := os.ReadFile(out)
+		other := keys.AlgRSAPSS
+		if alg == keys.AlgRSAPSS {
+			other = keys.AlgECDSAP256
+		}
+		tampered := bytes.Replace(raw, []byte(`"mode":"`+alg+`"`), []byte(`"mode":"`+other+`"`), 1)
+		if err := os.WriteFile(out, tampered, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if st, reason, _, _ := VerifyConsentFile(out, false); st != "INVALID" || reason != "signature_algorithm_mismatch" {
+			t.Fatalf("%s: expected INVALID signature_algorithm_mismatch, got %s %s", alg, st, reason)
+		}
+	}
+}
+
+func TestTrustedKeyring(t *testing.T) {
+	opts := policylock.SnapshotOptions{CreatedAtUTC: "2026-01-01T00:00:00Z", ToolVersion: "policyguardian/v0.1.0-test", UserAgent: "policyguardian/v0.1.0-test"}
+	zipb, _, err := policylock.SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	snapPath := filepath.Join(dir, "snap.zip")
+	if err := os.WriteFile(snapPath, zipb, 0644); err != nil {
+		t.Fatal(err)
+	}
+	trusted := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	attacker := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{2}, ed25519.SeedSize))
+	record := func(name string, key ed25519.PrivateKey, created string) string {
+		out := filepath.Join(dir, name)
+		ro := RecordOptions{CreatedAtUTC: created, SubjectIdentifier: "alice@example.com", TenantSaltHex: "bb", PepperHex: "aa"}
+		if key != nil {
+			ro.Signer = key
+		}
+		if _, _, _, err := RecordConsent(snapPath, out, ro); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	good := record("good.json", trusted, "2026-03-01T00:00:00Z")
+	early := record("early.json", trusted, "2025-12-31T23:59:59Z")
+	late := record("late.json", trusted, "2027-01-01T00:00:01Z")
+	forged := record("forged.json", attacker, "2026-03-01T00:00:00Z")
+	unsigned := record("unsigned.json", nil, "2026-03-01T00:00:00Z")
+	// Inside the validity window by byte order, but not a timestamp.
+	dateOnly := record("date-only.json", trusted, "2026-03-01")
+
+	pubHex := hex.EncodeToString(trusted.Public().(ed25519.PublicKey))
+	ringJSON := `{"schema":"consentguardian.trusted_keys.v0.1","keys":[{"public_key":"` + pubHex + `","legal_entity_name":"Example GmbH","not_before_utc":"2026-01-01T00:00:00Z","not_after_utc":"2027-01-01T00:00:00Z"}]}`
+	ring, err := ParseKeyring([]byte(ringJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := keys.KeyID(trusted.Public())
+	if k := ring.Lookup(id); k == nil || k.LegalEntityName != "Example GmbH" {
+		t.Fatalf("lookup %s: %+v", id, k)
+	}
+	vopts := VerifyOptions{TrustedKeys: ring}
+	for _, tc := range []struct{ path, reason string }{
+		{good, ""},
+		{early, "signer_key_not_yet_valid"},
+		{late, "signer_key_expired"},
+		{forged, "signer_key_unknown"},
+		{unsigned, "signature_required"},
+		{dateOnly, "invalid_created_at_utc"},
+	} {
+		st, reason, _, err := VerifyEventFile(tc.path, vopts)
+		if err != nil || reason != tc.reason || (tc.reason == "") != (st == "VALID") {
+			t.Fatalf("%s: got %s %s %v, want reason %q", filepath.Base(tc.path), st, reason, err, tc.reason)
+		}
+		// Without a keyring every signature that verifies is accepted.
+		if st, reason, _, _ := VerifyEventFile(tc.path, VerifyOptions{}); st != "VALID" {
+			t.Fatalf("%s without keyring: %s %s", filepath.Base(tc.path), st, reason)
+		}
+	}
+
+	ring.Keys[0].Revoked = true
+	if st, reason, _, _ := VerifyEventFile(good, vopts); st != "INVALID" || reason != "signer_key_revoked" {
+		t.Fatalf("expected INVALID signer_key_revoked, got %s %s", st, reason)
+	}
+
+	for _, bad := range []string{
+		`{"schema":"consentguardian.trusted_keys.v0.1","keys":[{"public_key":"` + pubHex + `","key_id":"` + strings.Repeat("0", 64) + `"}]}`,
+		`{"schema":"consentguardian.trusted_keys.v0.1","keys":[{"public_key":"` + pubHex + `"},{"public_key":"` + pubHex + `"}]}`,
+		`{"schema":"consentguardian.trusted_keys.v0.1","keys":[{"public_key":"` + pubHex + `","not_after_utc":"2026-01-01"}]}`,
+		`{"schema":"consentguardian.trusted_keys.v0.1","keys":[{"public_key":"` + pubHex + `","revoked_at":"x"}]}`,
+		`{"schema":"consentguardian.trusted_keys.v0.1","keys":[]}`,
+	} {
+		if _, err := ParseKeyring([]byte(bad)); err == nil {
+			t.Fatalf("expected error for keyring %s", bad)
+		}
+	}
+}
+
+// testCert issues a certificate for pub, signed by parent/parentKey (self
+// signed when parent is nil).
+func testCert(t *testing.T, tmpl *x509.Certificate, pub crypto.PublicKey, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+	if parent == nil {
+		parent = tmpl
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSignerCertificates(t *testing.T) {
+	opts := policylock.SnapshotOptions{CreatedAtUTC: "2024-01-01T00:00:00Z", ToolVersion: "policyguardian/v0.1.0-test", UserAgent: "policyguardian/v0.1.0-test"}
+	zipb, _, err := policylock.SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	snapPath := filepath.Join(dir, "snap.zip")
+	if err := os.WriteFile(snapPath, zipb, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	interKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := testCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, caKey.Public(), nil, caKey)
+	inter := testCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Test Issuing CA"},
+		NotBefore:             time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, interKey.Public(), ca, caKey)
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{5}, ed25519.SeedSize))
+	leafTmpl := &x509.Certificate{
+		SerialNumber:       big.NewInt(3),
+		Subject:            pkix.Name{CommonName: "Consent Signing", Organization: []string{"Example GmbH"}},
+		NotBefore:          time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:           time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC),
+		KeyUsage:           x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		UnknownExtKeyUsage: []asn1.ObjectIdentifier{{1, 3, 6, 1, 5, 5, 7, 3, 36}},
+	}
+	leaf := testCert(t, leafTmpl, key.Public(), inter, interKey)
+	leafTmpl.SerialNumber, leafTmpl.KeyUsage = big.NewInt(4), x509.KeyUsageKeyEncipherment
+	encLeaf := testCert(t, leafTmpl, key.Public(), inter, interKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(testCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(9),
+		Subject:               pkix.Name{CommonName: "Other Root"},
+		NotBefore:             time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, caKey.Public(), nil, caKey))
+
+	record := func(name, created string, chain []*x509.Certificate, signed bool) string {
+		t.Helper()
+		ro := RecordOptions{
+			CreatedAtUTC:      created,
+			SubjectIdentifier: "alice@example.com",
+			TenantSaltHex:     "bb",
+			PepperHex:         "aa",
+			SignCertChain:     chain,
+		}
+		if signed {
+			ro.Signer = key
+		}
+		out := filepath.Join(dir, name+".json")
+		if _, _, _, err := RecordConsent(snapPath, out, ro); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	chain := []*x509.Certificate{leaf, inter}
+	good := record("good", "2026-06-01T00:00:00Z", chain, true)
+	cases := []struct {
+		path   string
+		roots  *x509.CertPool
+		status string
+		reason string
+	}{
+		{good, roots, "VALID", ""},
+		{good, otherRoots, "INVALID", "signer_certificate_untrusted"},
+		{record("early", "2025-06-01T00:00:00Z", chain, true), roots, "INVALID", "signer_certificate_not_yet_valid"},
+		{record("late", "2027-06-01T00:00:00Z", chain, true), roots, "INVALID", "signer_certificate_expired"},
+		{record("nointer", "2026-06-01T00:00:00Z", []*x509.Certificate{leaf}, true), roots, "INVALID", "signer_certificate_untrusted"},
+		{record("usage", "2026-06-01T00:00:00Z", []*x509.Certificate{encLeaf, inter}, true), roots, "INVALID", "signer_certificate_key_usage"},
+		{record("nochain", "2026-06-01T00:00:00Z", nil, true), roots, "INVALID", "signer_certificate_missing"},
+		{record("unsigned", "2026-06-01T00:00:00Z", nil, false), roots, "INVALID", "signature_required"},
+		// Without roots the chain is not checked.
+		{record("late2", "2027-06-02T00:00:00Z", chain, true), nil, "VALID", ""},
+	}
+	for _, c := range cases {
+		st, reason, _, err := VerifyEventFile(c.path, VerifyOptions{SignerRoots: c.roots})
+		if err != nil || st != c.status || reason != c.reason {
+			t.Fatalf("%s: expected %s %s, got %s %s %v", filepath.Base(c.path), c.status, c.reason, st, reason, err)
+		}
+	}
+
+	cert, err := SignerCertificate(good)
+	if err != nil || cert == nil || cert.Subject.Organization[0] != "Example GmbH" {
+		t.Fatalf("SignerCertificate: %v %v", cert, err)
+	}
+
+	// The leaf must certify the signing key.
+	other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{6}, ed25519.SeedSize))
+	if _, _, _, err := RecordConsent(snapPath, "", RecordOptions{
+		CreatedAtUTC:      "2026-06-01T00:00:00Z",
+		SubjectIdentifier: "alice@example.com",
+		TenantSaltHex:     "bb",
+		PepperHex:         "aa",
+		Signer:            other,
+		SignCertChain:     chain,
+	}); err == nil {
+		t.Fatalf("expected error for a certificate of another key")
+	}
+}
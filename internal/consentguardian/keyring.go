@@ -0,0 +1,136 @@
+package consentguardian
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"policyguardian/internal/shared/keys"
+	"policyguardian/internal/shared/timefmt"
+)
+
+const SchemaKeyring = "consentguardian.trusted_keys.v0.1"
+
+// Keyring lists the signer keys a verifier trusts
+// (schemas/trusted_keys_v0_1.schema.json).
+type Keyring struct {
+	Schema string       `json:"schema"`
+	Keys   []TrustedKey `json:"keys"`
+}
+
+// TrustedKey is one keyring entry. PublicKey is in any form keys.ParsePublic
+// reads (envelope hex, PEM or an authorized_keys line); KeyID may be omitted
+// and is checked against it when given. A signature is accepted when the
+// event's created_at_utc lies in [NotBeforeUTC, NotAfterUTC] (either bound
+// may be empty) and the key is not revoked.
+type TrustedKey struct {
+	KeyID           string `json:"key_id,omitempty"`
+	PublicKey       string `json:"public_key"`
+	LegalEntityName string `json:"legal_entity_name,omitempty"`
+	KeyDescription  string `json:"key_description,omitempty"`
+	NotBeforeUTC    string `json:"not_before_utc,omitempty"`
+	NotAfterUTC     string `json:"not_after_utc,omitempty"`
+	Revoked         bool   `json:"revoked,omitempty"`
+}
+
+// LoadKeyring reads and checks a keyring file.
+func LoadKeyring(path string) (*Keyring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ring, err := ParseKeyring(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ring, nil
+}
+
+// ParseKeyring decodes a keyring and fills in missing key IDs. Unknown
+// fields, duplicate keys and malformed validity bounds are errors.
+func ParseKeyring(b []byte) (*Keyring, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var ring Keyring
+	if err := dec.Decode(&ring); err != nil {
+		return nil, fmt.Errorf("keyring: %w", err)
+	}
+	if ring.Schema != SchemaKeyring {
+		return nil, fmt.Errorf("keyring: schema must be %s", SchemaKeyring)
+	}
+	if len(ring.Keys) == 0 {
+		return nil, errors.New("keyring: no keys")
+	}
+	seen := map[string]bool{}
+	for i := range ring.Keys {
+		k := &ring.Keys[i]
+		pub, err := keys.ParsePublic([]byte(k.PublicKey))
+		if err != nil {
+			return nil, fmt.Errorf("keyring: key %d: %w", i+1, err)
+		}
+		id, err := keys.KeyID(pub)
+		if err != nil {
+			return nil, fmt.Errorf("keyring: key %d: %w", i+1, err)
+		}
+		if k.KeyID != "" && k.KeyID != id {
+			return nil, fmt.Errorf("keyring: key %d: key_id does not match public_key (%s)", i+1, id)
+		}
+		k.KeyID = id
+		if seen[id] {
+			return nil, fmt.Errorf("keyring: duplicate key %s", id)
+		}
+		seen[id] = true
+		var bounds [2]time.Time
+		for j, ts := range []string{k.NotBeforeUTC, k.NotAfterUTC} {
+			if ts == "" {
+				continue
+			}
+			if bounds[j], err = timefmt.Parse(ts); err != nil {
+				return nil, fmt.Errorf("keyring: key %d: invalid timestamp %q", i+1, ts)
+			}
+		}
+		if k.NotBeforeUTC != "" && k.NotAfterUTC != "" && bounds[1].Before(bounds[0]) {
+			return nil, fmt.Errorf("keyring: key %d: not_after_utc precedes not_before_utc", i+1)
+		}
+	}
+	return &ring, nil
+}
+
+// Lookup returns the entry for a key ID, or nil.
+func (r *Keyring) Lookup(keyID string) *TrustedKey {
+	for i := range r.Keys {
+		if r.Keys[i].KeyID == keyID {
+			return &r.Keys[i]
+		}
+	}
+	return nil
+}
+
+// check returns "" when the key may sign an event created at createdAt,
+// otherwise a reason code. A bound that does not parse (ParseKeyring rejects
+// those) fails closed.
+func (r *Keyring) check(keyID string, createdAt time.Time) string {
+	k := r.Lookup(keyID)
+	switch {
+	case k == nil:
+		return "signer_key_unknown"
+	case k.Revoked:
+		return "signer_key_revoked"
+	}
+	if k.NotBeforeUTC != "" {
+		nb, err := timefmt.Parse(k.NotBeforeUTC)
+		if err != nil || createdAt.Before(nb) {
+			return "signer_key_not_yet_valid"
+		}
+	}
+	if k.NotAfterUTC != "" {
+		na, err := timefmt.Parse(k.NotAfterUTC)
+		if err != nil || createdAt.After(na) {
+			return "signer_key_expired"
+		}
+	}
+	return ""
+}
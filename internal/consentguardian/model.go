@@ -13,6 +13,7 @@ type ConsentEvent struct {
 	Evidence map[string]string `json:"evidence,omitempty"`
 
 	Signing *SigningInfo `json:"signing,omitempty"`
+	Timestamp *TimestampInfo `json:"timestamp,omitempty"`
 }
 
 type PolicyRef struct {
@@ -27,10 +28,38 @@ type SubjectRef struct {
 }
 
 type SigningInfo struct {
-	Mode            string `json:"mode"` // none|ed25519
+	Mode            string `json:"mode"` // none or a signature algorithm (ed25519|ecdsa-p256-sha256|rsa-pss-sha256)
 	Algorithm        string `json:"algorithm,omitempty"`
 	PublicKey        string `json:"public_key,omitempty"`
+	// KeyID is the stable fingerprint of PublicKey (see keys.KeyID).
+	KeyID            string `json:"key_id,omitempty"`
 	KeyDescription   string `json:"key_description,omitempty"`
 	LegalEntityName  string `json:"legal_entity_name,omitempty"`
 	SignatureFile    string `json:"signature_file,omitempty"`
 }
+
+type TimestampInfo struct {
+	Mode        string `json:"mode"` // rfc3161
+	GenTimeUTC  string `json:"gen_time_utc"`
+	TokenFile   string `json:"token_file"`
+}
+
+// ConsentRevocation withdraws a prior consent event (GDPR Art. 7(3)).
+type ConsentRevocation struct {
+	Schema            string            `json:"schema"`
+	SpecURL           string            `json:"spec_url"`
+	CreatedAtUTC      string            `json:"created_at_utc"`
+	Hashes            map[string]string `json:"hashes"`
+	RevocationEventID string            `json:"revocation_event_id,omitempty"`
+
+	Revokes RevokedConsent    `json:"revokes"`
+	Context map[string]string `json:"context,omitempty"`
+
+	Signing   *SigningInfo   `json:"signing,omitempty"`
+	Timestamp *TimestampInfo `json:"timestamp,omitempty"`
+}
+
+type RevokedConsent struct {
+	ConsentEventID string     `json:"consent_event_id"`
+	Subject        SubjectRef `json:"subject"`
+}
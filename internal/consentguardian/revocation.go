@@ -0,0 +1,362 @@
+package consentguardian
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"policyguardian/internal/shared/hashing"
+	"policyguardian/internal/shared/jcs"
+	"policyguardian/internal/shared/sigenv"
+	"policyguardian/internal/shared/timefmt"
+)
+
+const SchemaConsentRevocation = "consentguardian.consent_revocation.v0.1"
+
+type RevokeOptions struct {
+	CreatedAtUTC string
+	Context      map[string]string
+
+	// Signer, SignKeyFile, SignKeyPassphrase and SignCertChain are as in
+	// RecordOptions.
+	Signer            Signer
+	SignKeyFile       string
+	SignKeyPassphrase []byte
+	SignCertChain     []*x509.Certificate
+	SignPrivKeyHex    string
+	KeyDescription    string
+	LegalEntityName   string
+
+	TSAURL string
+}
+
+// BuildRevocationSignPayload returns the JCS signing payload of a revocation.
+// Unlike consent events the schema is part of the payload, so a revocation
+// can never hash to the same ID as any other event type.
+func BuildRevocationSignPayload(rv ConsentRevocation) map[string]any {
+	m := map[string]any{
+		"schema":         rv.Schema,
+		"created_at_utc": rv.CreatedAtUTC,
+		"revokes": map[string]any{
+			"consent_event_id": rv.Revokes.ConsentEventID,
+			"subject": map[string]any{
+				"subject_id_hash": rv.Revokes.Subject.SubjectIDHash,
+				"hash_algorithm":  rv.Revokes.Subject.HashAlgorithm,
+			},
+		},
+	}
+	ctx := map[string]any{}
+	for k, v := range rv.Context {
+		if v != "" {
+			ctx[k] = v
+		}
+	}
+	if len(ctx) > 0 {
+		m["context"] = ctx
+	}
+	return m
+}
+
+// RevokeConsent records a revocation of the consent event at consentPath,
+// which must verify. The revocation is written to outPath (with optional
+// .sig.<algorithm>.json / .tst companions) unless outPath is empty.
+func RevokeConsent(consentPath string, outPath string, opts RevokeOptions) (*ConsentRevocation, []byte, []byte, error) {
+	st, reason, _, err := VerifyConsentFile(consentPath, false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if st != "VALID" {
+		return nil, nil, nil, fmt.Errorf("consent invalid: %s", reason)
+	}
+	ev, err := readConsentEvent(consentPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	created := opts.CreatedAtUTC
+	if created == "" {
+		created = timefmt.Format(timefmt.NowUTC())
+	}
+	if _, err := timefmt.Parse(created); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid created_at_utc: %w", err)
+	}
+	if created < ev.CreatedAtUTC {
+		return nil, nil, nil, errors.New("revocation created_at_utc precedes the consent event")
+	}
+
+	rv := &ConsentRevocation{
+		Schema:       SchemaConsentRevocation,
+		SpecURL:      SpecURLPolicyGuardian,
+		CreatedAtUTC: created,
+		Revokes: RevokedConsent{
+			ConsentEventID: ev.ConsentEventID,
+			Subject:        ev.Subject,
+		},
+	}
+	if len(opts.Context) > 0 {
+		rv.Context = opts.Context
+	}
+	signBytes, err := jcs.CanonicalizeValue(BuildRevocationSignPayload(*rv))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	id := hashing.SHA256Hex(signBytes)
+	rv.Hashes = map[string]string{"sha2-256": id}
+	rv.RevocationEventID = id
+
+	signer, err := sigenv.ResolveSigner(opts.Signer, opts.SignKeyFile, opts.SignKeyPassphrase, opts.SignPrivKeyHex)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	signing, sigBytes, err := signEvent(signBytes, outPath, signer, opts.SignCertChain, opts.KeyDescription, opts.LegalEntityName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rv.Signing = signing
+	stamp, tokenBytes, err := stampEvent(signBytes, outPath, opts.TSAURL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rv.Timestamp = stamp
+
+	raw, err := json.Marshal(rv)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	canonical, err := jcs.CanonicalizeJSON(raw)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := writeEvent(outPath, canonical, signing, sigBytes, tokenBytes); err != nil {
+		return nil, nil, nil, err
+	}
+	return rv, canonical, sigBytes, nil
+}
+
+// VerifyRevocation checks the hashes of a revocation from raw JSON bytes.
+func VerifyRevocation(revocationJSON []byte) (string, string, error) {
+	rv, err := decodeRevocation(revocationJSON)
+	if err != nil {
+		return "INVALID", "invalid_json", nil
+	}
+	if rv.Schema != SchemaConsentRevocation {
+		return "INVALID", "wrong_schema", nil
+	}
+	if rv.Revokes.ConsentEventID == "" || rv.Revokes.Subject.SubjectIDHash == "" {
+		return "INVALID", "missing_revoked_consent", nil
+	}
+	signBytes, err := jcs.CanonicalizeValue(BuildRevocationSignPayload(*rv))
+	if err != nil {
+		return "INVALID", "jcs_error", nil
+	}
+	exp := hashing.SHA256Hex(signBytes)
+	claimed := rv.Hashes["sha2-256"]
+	if claimed == "" {
+		return "INVALID", "missing_sha2_256", nil
+	}
+	if claimed != exp {
+		return "INVALID", "hash_mismatch", nil
+	}
+	if rv.RevocationEventID != "" && rv.RevocationEventID != exp {
+		return "INVALID", "revocation_event_id_mismatch", nil
+	}
+	return "VALID", "", nil
+}
+
+// VerifyRevocationFile verifies a revocation file plus its companion
+// signature envelope and timestamp token.
+// It returns (status, reason, unsignedWarning, error).
+func VerifyRevocationFile(path string, opts VerifyOptions) (string, string, bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", false, err
+	}
+	st, reason, err := VerifyRevocation(b)
+	if err != nil || st != "VALID" {
+		return st, reason, false, err
+	}
+	rv, _ := decodeRevocation(b)
+	signBytes, err := jcs.CanonicalizeValue(BuildRevocationSignPayload(*rv))
+	if err != nil {
+		return "INVALID", "jcs_error", false, nil
+	}
+	if st, reason := verifyTimestamp(path, rv.Timestamp, signBytes, opts.TSARoots); st != "VALID" {
+		return st, reason, false, nil
+	}
+	st, reason, unsigned := verifySignature(path, rv.Signing, signBytes, rv.CreatedAtUTC, opts)
+	return st, reason, unsigned, nil
+}
+
+// VerifyEventFile verifies a consent event or a revocation, chosen by its
+// schema. It returns (status, reason, unsignedWarning, error).
+func VerifyEventFile(path string, opts VerifyOptions) (string, string, bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", false, err
+	}
+	var head struct {
+		Schema string `json:"schema"`
+	}
+	if err := json.Unmarshal(b, &head); err != nil {
+		return "INVALID", "invalid_json", false, nil
+	}
+	if head.Schema == SchemaConsentRevocation {
+		return VerifyRevocationFile(path, opts)
+	}
+	return VerifyConsentFileWithOptions(path, opts)
+}
+
+// Effective is the outcome of ResolveEffective.
+// State is one of in_force|revoked|not_yet_given.
+type Effective struct {
+	ConsentEventID    string
+	AtUTC             string
+	State             string
+	RevocationEventID string
+	RevokedAtUTC      string
+	// InvalidFile names the event file that failed verification, if any.
+	InvalidFile string
+	// UnsignedFiles lists verified events that carry no signature.
+	UnsignedFiles []string
+}
+
+// ResolveEffective verifies every consent event and revocation in paths and
+// reports whether the consent identified by consentEventID (which may be
+// empty when paths hold exactly one consent event) was in force at atUTC
+// (default: now). A consent is in force from its created_at_utc until the
+// earliest revocation of it whose created_at_utc is at or before atUTC.
+// It returns (status, reason, effective, error); status is INVALID when any
+// event fails verification or a revocation does not match its consent.
+func ResolveEffective(paths []string, consentEventID, atUTC string, opts VerifyOptions) (string, string, *Effective, error) {
+	if atUTC == "" {
+		atUTC = timefmt.Format(timefmt.NowUTC())
+	}
+	if _, err := timefmt.Parse(atUTC); err != nil {
+		return "", "", nil, fmt.Errorf("invalid at_utc: %w", err)
+	}
+	eff := &Effective{AtUTC: atUTC}
+	status := "VALID"
+	partialReason := ""
+	consents := map[string]*ConsentEvent{}
+	var revocations []*ConsentRevocation
+
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return "", "", nil, err
+		}
+		var head struct {
+			Schema string `json:"schema"`
+		}
+		if err := json.Unmarshal(b, &head); err != nil {
+			eff.InvalidFile = p
+			return "INVALID", "invalid_json", eff, nil
+		}
+		var st, reason string
+		var unsigned bool
+		switch head.Schema {
+		case SchemaConsentEvent:
+			st, reason, unsigned, err = VerifyConsentFileWithOptions(p, opts)
+			if err == nil && st != "INVALID" {
+				ev, derr := readConsentEvent(p)
+				if derr != nil {
+					return "", "", nil, derr
+				}
+				consents[ev.ConsentEventID] = ev
+			}
+		case SchemaConsentRevocation:
+			st, reason, unsigned, err = VerifyRevocationFile(p, opts)
+			if err == nil && st == "VALID" {
+				rv, _ := decodeRevocation(b)
+				revocations = append(revocations, rv)
+			}
+		default:
+			st, reason = "INVALID", "wrong_schema"
+		}
+		if err != nil {
+			return "", "", nil, err
+		}
+		if st == "INVALID" {
+			eff.InvalidFile = p
+			return "INVALID", reason, eff, nil
+		}
+		if st == "PARTIAL" && status == "VALID" {
+			status, partialReason = "PARTIAL", reason
+		}
+		if unsigned {
+			eff.UnsignedFiles = append(eff.UnsignedFiles, p)
+		}
+	}
+
+	if consentEventID == "" {
+		if len(consents) != 1 {
+			return "", "", nil, fmt.Errorf("expected exactly one consent event, found %d (select one by consent_event_id)", len(consents))
+		}
+		for id := range consents {
+			consentEventID = id
+		}
+	}
+	ev, ok := consents[consentEventID]
+	if !ok {
+		return "", "", nil, fmt.Errorf("consent event %s not among the given events", consentEventID)
+	}
+	eff.ConsentEventID = consentEventID
+
+	sort.Slice(revocations, func(i, j int) bool { return revocations[i].CreatedAtUTC < revocations[j].CreatedAtUTC })
+	for _, rv := range revocations {
+		if rv.Revokes.ConsentEventID != consentEventID {
+			continue
+		}
+		if rv.Revokes.Subject != ev.Subject {
+			return "INVALID", "revocation_subject_mismatch", eff, nil
+		}
+		if rv.CreatedAtUTC < ev.CreatedAtUTC {
+			return "INVALID", "revocation_precedes_consent", eff, nil
+		}
+		if eff.RevocationEventID == "" && rv.CreatedAtUTC <= atUTC {
+			eff.RevocationEventID = rv.RevocationEventID
+			eff.RevokedAtUTC = rv.CreatedAtUTC
+		}
+	}
+	switch {
+	case atUTC < ev.CreatedAtUTC:
+		eff.State = "not_yet_given"
+	case eff.RevocationEventID != "":
+		eff.State = "revoked"
+	default:
+		eff.State = "in_force"
+	}
+	return status, partialReason, eff, nil
+}
+
+func readConsentEvent(path string) (*ConsentEvent, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var ev ConsentEvent
+	if err := dec.Decode(&ev); err != nil {
+		return nil, err
+	}
+	// consent_event_id is optional on disk; the verified hash is the ID.
+	if ev.ConsentEventID == "" {
+		ev.ConsentEventID = ev.Hashes["sha2-256"]
+	}
+	return &ev, nil
+}
+
+func decodeRevocation(b []byte) (*ConsentRevocation, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var rv ConsentRevocation
+	if err := dec.Decode(&rv); err != nil {
+		return nil, err
+	}
+	return &rv, nil
+}
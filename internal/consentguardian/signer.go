@@ -0,0 +1,17 @@
+package consentguardian
+
+import "crypto"
+
+// Signer signs consent events and revocations in place of a key file. Its
+// public key selects the algorithm (keys.Algorithm). Sign receives the
+// sha2-256 digest of the JCS sign payload for ECDSA and RSA-PSS keys and
+// the payload itself for Ed25519; a signer that must see the payload for
+// every algorithm (an ssh-agent) also implements sigenv.PayloadSigner.
+// Signatures are checked against the public key before they are written.
+//
+// Package extsigner provides signers backed by a plugin executable and by
+// ssh-agent; any in-process crypto.Signer (an ed25519.PrivateKey, a KMS
+// client) works as well.
+type Signer interface {
+	crypto.Signer
+}
@@ -0,0 +1,242 @@
+package policylock
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"policyguardian/internal/shared/hashing"
+	"policyguardian/internal/shared/zipdet"
+	"policyguardian/internal/translog"
+)
+
+const (
+	// BundleManifestEntry replaces policy_body.bin in bundle packs; it lists
+	// every document and policy.bytes describes it.
+	BundleManifestEntry  = "bundle_manifest.json"
+	BundleBodiesDir      = "bodies/"
+	SchemaBundleManifest = "policylock.bundle_manifest.v0.1"
+)
+
+// BundleManifest is the bundle_manifest.json entry. MerkleRoot is the
+// RFC 6962 tree hash over the document bodies in manifest order, so a single
+// document can later be proven part of the bundle with an inclusion path.
+type BundleManifest struct {
+	Schema     string           `json:"schema"`
+	Documents  []BundleDocument `json:"documents"`
+	MerkleRoot string           `json:"merkle_root"`
+}
+
+// BundleDocument is one body, stored as bodies/<name>.
+type BundleDocument struct {
+	Name   string `json:"name"`
+	Role   string `json:"role,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Length int    `json:"length"`
+	SHA256 string `json:"sha2-256"`
+}
+
+// BundleInput is one document to snapshot.
+type BundleInput struct {
+	Name  string
+	Role  string
+	Path  string
+	Bytes []byte
+}
+
+// validBundleName accepts slash-separated UTF-8 names (dir and git snapshots
+// use the relative path, which may contain spaces or non-ASCII letters). It
+// rejects empty, "." and ".." segments, backslashes and control characters.
+func validBundleName(name string) bool {
+	if name == "" || len(name) > 1024 || !utf8.ValidString(name) {
+		return false
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || r == '\\' {
+			return false
+		}
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadBundleManifest reads an input manifest
+//
+//	{"documents": [{"name": "tos", "role": "terms_of_service", "path": "tos.html"}, ...]}
+//
+// Paths are relative to the manifest; name defaults to the file name.
+func LoadBundleManifest(path string) ([]BundleInput, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var in struct {
+		Documents []struct {
+			Name string `json:"name"`
+			Role string `json:"role"`
+			Path string `json:"path"`
+		} `json:"documents"`
+	}
+	if err := json.Unmarshal(b, &in); err != nil {
+		return nil, fmt.Errorf("bundle manifest: %w", err)
+	}
+	docs := make([]BundleInput, 0, len(in.Documents))
+	for i, d := range in.Documents {
+		if d.Path == "" {
+			return nil, fmt.Errorf("bundle manifest: document %d has no path", i+1)
+		}
+		body, err := os.ReadFile(filepath.Join(filepath.Dir(path), d.Path))
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, BundleInput{Name: d.Name, Role: d.Role, Path: d.Path, Bytes: body})
+	}
+	return docs, nil
+}
+
+// BundleInputsFromFiles names each file after its base name.
+func BundleInputsFromFiles(paths []string) ([]BundleInput, error) {
+	docs := make([]BundleInput, 0, len(paths))
+	for _, p := range paths {
+		body, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, BundleInput{Path: p, Bytes: body})
+	}
+	return docs, nil
+}
+
+// SnapshotBundle snapshots several documents that are agreed to together.
+// The pack holds bodies/<name> per document and bundle_manifest.json; the
+// manifest hash (policy.bytes) and Merkle root are in the sign payload.
+func SnapshotBundle(docs []BundleInput, opts SnapshotOptions) ([]byte, *PolicySnapshot, error) {
+	manifest, bodies, err := buildBundle(docs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return buildSnapshot(manifest, PolicyInput{Mode: "bundle"}, nil, opts, bodies...)
+}
+
+// buildBundle returns bundle_manifest.json and the bodies/ entries.
+func buildBundle(docs []BundleInput) ([]byte, []zipdet.Entry, error) {
+	if len(docs) == 0 {
+		return nil, nil, errors.New("bundle has no documents")
+	}
+	m := BundleManifest{Schema: SchemaBundleManifest}
+	seen := map[string]bool{}
+	var leaves [][]byte
+	var extra []zipdet.Entry
+	for _, d := range docs {
+		name := d.Name
+		if name == "" {
+			name = filepath.Base(d.Path)
+		}
+		if !validBundleName(name) {
+			return nil, nil, fmt.Errorf("invalid bundle document name %q", name)
+		}
+		if seen[name] {
+			return nil, nil, fmt.Errorf("duplicate bundle document name %q", name)
+		}
+		seen[name] = true
+		m.Documents = append(m.Documents, BundleDocument{
+			Name:   name,
+			Role:   d.Role,
+			Path:   d.Path,
+			Length: len(d.Bytes),
+			SHA256: hashing.SHA256Hex(d.Bytes),
+		})
+		leaves = append(leaves, translog.LeafHash(d.Bytes))
+		extra = append(extra, zipdet.Entry{Name: BundleBodiesDir + name, Data: d.Bytes})
+	}
+	m.MerkleRoot = hex.EncodeToString(translog.RootHash(leaves))
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(manifest, '\n'), extra, nil
+}
+
+// parseBundleManifest decodes bundle_manifest.json.
+func parseBundleManifest(b []byte) (*BundleManifest, error) {
+	var m BundleManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	if m.Schema != SchemaBundleManifest || len(m.Documents) == 0 {
+		return nil, errors.New("not a bundle manifest")
+	}
+	return &m, nil
+}
+
+// verifyBundle checks every body against the manifest and the manifest root
+// against the snapshot. bodies maps entry names under bodies/ to their bytes.
+func verifyBundle(snap *PolicySnapshot, manifest []byte, bodies map[string][]byte) string {
+	m, err := parseBundleManifest(manifest)
+	if err != nil || snap.Policy.Bundle == nil {
+		return "bundle_manifest_invalid"
+	}
+	var leaves [][]byte
+	seen := map[string]bool{}
+	for _, d := range m.Documents {
+		body, ok := bodies[d.Name]
+		if !ok || seen[d.Name] {
+			return "bundle_document_missing"
+		}
+		seen[d.Name] = true
+		if len(body) != d.Length || hashing.SHA256Hex(body) != d.SHA256 {
+			return "bundle_document_hash_mismatch"
+		}
+		leaves = append(leaves, translog.LeafHash(body))
+	}
+	if len(bodies) != len(m.Documents) {
+		return "bundle_unexpected_document"
+	}
+	root := hex.EncodeToString(translog.RootHash(leaves))
+	if root != m.MerkleRoot || root != snap.Policy.Bundle.MerkleRoot || len(m.Documents) != snap.Policy.Bundle.DocumentCount {
+		return "bundle_root_mismatch"
+	}
+	return ""
+}
+
+// ReadBundleManifest returns the manifest of a bundle pack.
+func ReadBundleManifest(zipBytes []byte) (*BundleManifest, error) {
+	b, err := readPackEntry(zipBytes, BundleManifestEntry)
+	if err != nil {
+		return nil, err
+	}
+	return parseBundleManifest(b)
+}
+
+// FormatBundleDocument renders a document on one line:
+// "<name> <sha2-256> [role=<role>]".
+func FormatBundleDocument(d BundleDocument) string {
+	s := d.Name + " " + d.SHA256
+	if d.Role != "" {
+		s += " role=" + d.Role
+	}
+	return s
+}
+
+// isBundleMode reports whether packs of an input mode hold bodies/ and
+// bundle_manifest.json instead of policy_body.bin.
+func isBundleMode(mode string) bool {
+	return mode == "bundle" || mode == "dir" || mode == "git"
+}
+
+// bodyEntry names the entry that policy.bytes describes.
+func bodyEntry(s *PolicySnapshot) string {
+	if isBundleMode(s.Policy.Input.Mode) {
+		return BundleManifestEntry
+	}
+	return "policy_body.bin"
+}
@@ -0,0 +1,418 @@
+package policylock
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// FieldDiff is one metadata field that differs between two snapshots.
+// Paths are dotted JSON paths into policy_snapshot.json; an absent side is omitted.
+type FieldDiff struct {
+	Field string `json:"field"`
+	A     string `json:"a,omitempty"`
+	B     string `json:"b,omitempty"`
+}
+
+// SnapshotDiff is a derived view of two snapshot packs. The packs themselves
+// are never modified.
+type SnapshotDiff struct {
+	SnapshotIDA     string      `json:"snapshot_id_a"`
+	SnapshotIDB     string      `json:"snapshot_id_b"`
+	PolicySHA256A   string      `json:"policy_sha256_a"`
+	PolicySHA256B   string      `json:"policy_sha256_b"`
+	BodyIdentical   bool        `json:"body_identical"`
+	Metadata        []FieldDiff `json:"metadata,omitempty"`
+	BodyDiff        string      `json:"body_diff,omitempty"`
+	BodyDiffSkipped string      `json:"body_diff_skipped,omitempty"`
+}
+
+// Identical reports whether neither metadata nor body differ.
+func (d *SnapshotDiff) Identical() bool {
+	return d.BodyIdentical && len(d.Metadata) == 0
+}
+
+// DiffSnapshots compares two snapshot packs. labelA/labelB name the sides in
+// the unified diff header.
+func DiffSnapshots(a, b []byte, labelA, labelB string) (*SnapshotDiff, error) {
+	snapA, hashA, err := ReadSnapshotInfo(a)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", labelA, err)
+	}
+	snapB, hashB, err := ReadSnapshotInfo(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", labelB, err)
+	}
+	bodyA, err := readPackEntry(a, bodyEntry(snapA))
+	if err != nil {
+		return nil, err
+	}
+	bodyB, err := readPackEntry(b, bodyEntry(snapB))
+	if err != nil {
+		return nil, err
+	}
+	d := &SnapshotDiff{
+		SnapshotIDA:   snapA.SnapshotID,
+		SnapshotIDB:   snapB.SnapshotID,
+		PolicySHA256A: hashA,
+		PolicySHA256B: hashB,
+		BodyIdentical: hashA == hashB,
+	}
+
+	fa, err := flattenSnapshot(snapA)
+	if err != nil {
+		return nil, err
+	}
+	fb, err := flattenSnapshot(snapB)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]bool{}
+	for k := range fa {
+		keys[k] = true
+	}
+	for k := range fb {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		// snapshot_id is derived from everything else; it is reported separately.
+		if k != "snapshot_id" {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		if fa[k] != fb[k] {
+			d.Metadata = append(d.Metadata, FieldDiff{Field: k, A: fa[k], B: fb[k]})
+		}
+	}
+
+	if d.BodyIdentical {
+		return d, nil
+	}
+	if !isTextLike(snapA, bodyA) || !isTextLike(snapB, bodyB) {
+		d.BodyDiffSkipped = "binary_content"
+		return d, nil
+	}
+	d.BodyDiff = unifiedDiff(string(bodyA), string(bodyB), labelA, labelB, 3)
+	return d, nil
+}
+
+func readPackEntry(zipBytes []byte, name string) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("missing %s", name)
+}
+
+// flattenSnapshot maps dotted JSON paths of policy_snapshot.json to scalar values.
+func flattenSnapshot(s *PolicySnapshot) (map[string]string, error) {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	out := map[string]string{}
+	var walk func(prefix string, v any)
+	walk = func(prefix string, v any) {
+		switch x := v.(type) {
+		case map[string]any:
+			for k, vv := range x {
+				p := k
+				if prefix != "" {
+					p = prefix + "." + k
+				}
+				walk(p, vv)
+			}
+		case []any:
+			for i, vv := range x {
+				walk(fmt.Sprintf("%s[%d]", prefix, i), vv)
+			}
+		case nil:
+		default:
+			out[prefix] = fmt.Sprint(x)
+		}
+	}
+	walk("", v)
+	return out, nil
+}
+
+// isTextLike decides whether a body may be rendered as a line diff. URL
+// snapshots use the recorded content_type; other inputs are sniffed.
+func isTextLike(s *PolicySnapshot, body []byte) bool {
+	ct := ""
+	if s.Policy.Fetch != nil {
+		ct = s.Policy.Fetch.ContentType
+	}
+	if ct == "" {
+		ct = http.DetectContentType(body)
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mt, "text/"):
+		return true
+	case strings.HasSuffix(mt, "+json"), strings.HasSuffix(mt, "+xml"):
+		return true
+	}
+	switch mt {
+	case "application/json", "application/xml", "application/javascript", "application/x-www-form-urlencoded":
+		return true
+	}
+	return false
+}
+
+type lineEdit struct {
+	op   byte // ' ', '-', '+'
+	line string
+}
+
+// diffLines computes a shortest edit script with Myers' O(ND) algorithm in
+// its linear-space form: the middle snake of each subproblem splits it in
+// two, so memory stays O(N+M) however far apart the inputs are.
+func diffLines(a, b []string) []lineEdit {
+	// Compare small integers instead of strings.
+	ids := map[string]int{}
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, l := range lines {
+			id, ok := ids[l]
+			if !ok {
+				id = len(ids)
+				ids[l] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	d := &differ{a: a, b: b, ai: intern(a), bi: intern(b)}
+	d.compare(0, len(a), 0, len(b))
+	return d.out
+}
+
+type differ struct {
+	a, b   []string
+	ai, bi []int
+	out    []lineEdit
+	vf, vb []int
+}
+
+// compare appends the edits turning a[a0:a1] into b[b0:b1].
+func (d *differ) compare(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.ai[a0] == d.bi[b0] {
+		d.out = append(d.out, lineEdit{' ', d.a[a0]})
+		a0++
+		b0++
+	}
+	suffix := a1
+	for a1 > a0 && b1 > b0 && d.ai[a1-1] == d.bi[b1-1] {
+		a1--
+		b1--
+	}
+	switch {
+	case a0 == a1 || b0 == b1 || !d.shareLine(a0, a1, b0, b1):
+		for _, l := range d.a[a0:a1] {
+			d.out = append(d.out, lineEdit{'-', l})
+		}
+		for _, l := range d.b[b0:b1] {
+			d.out = append(d.out, lineEdit{'+', l})
+		}
+	default:
+		x, y, u, v := d.middleSnake(a0, a1, b0, b1)
+		d.compare(a0, x, b0, y)
+		for _, l := range d.a[x:u] {
+			d.out = append(d.out, lineEdit{' ', l})
+		}
+		d.compare(u, a1, v, b1)
+	}
+	for _, l := range d.a[a1:suffix] {
+		d.out = append(d.out, lineEdit{' ', l})
+	}
+}
+
+// shareLine reports whether a[a0:a1] and b[b0:b1] have a line in common;
+// when they do not, the edit script is a plain replacement.
+func (d *differ) shareLine(a0, a1, b0, b1 int) bool {
+	seen := make(map[int]bool, a1-a0)
+	for _, id := range d.ai[a0:a1] {
+		seen[id] = true
+	}
+	for _, id := range d.bi[b0:b1] {
+		if seen[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// middleSnake finds the middle snake of an optimal path from (a0,b0) to
+// (a1,b1) (Myers 1986, section 4b) and returns its start (x,y) and end
+// (u,v). Both ends differ, so the edit distance is at least 2 and each
+// half is strictly cheaper than the whole.
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta&1 != 0
+	max := (n + m + 1) / 2
+	off := max + 1
+	if size := 2*max + 3; cap(d.vf) < size {
+		d.vf, d.vb = make([]int, size), make([]int, size)
+	}
+	vf, vb := d.vf[:2*max+3], d.vb[:2*max+3]
+	vf[off+1], vb[off+1] = 0, 0
+	for dd := 0; dd <= max; dd++ {
+		// Forward paths, as x offsets from (a0,b0).
+		for k := -dd; k <= dd; k += 2 {
+			var px int
+			if k == -dd || (k != dd && vf[off+k-1] < vf[off+k+1]) {
+				px = vf[off+k+1]
+			} else {
+				px = vf[off+k-1] + 1
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < n && py < m && d.ai[a0+px] == d.bi[b0+py] {
+				px++
+				py++
+			}
+			vf[off+k] = px
+			if kr := delta - k; odd && kr >= -(dd-1) && kr <= dd-1 && px+vb[off+kr] >= n {
+				return a0 + sx, b0 + sy, a0 + px, b0 + py
+			}
+		}
+		// Reverse paths, as x offsets back from (a1,b1).
+		for k := -dd; k <= dd; k += 2 {
+			var px int
+			if k == -dd || (k != dd && vb[off+k-1] < vb[off+k+1]) {
+				px = vb[off+k+1]
+			} else {
+				px = vb[off+k-1] + 1
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < n && py < m && d.ai[a1-px-1] == d.bi[b1-py-1] {
+				px++
+				py++
+			}
+			vb[off+k] = px
+			if kf := delta - k; !odd && kf >= -dd && kf <= dd && px+vf[off+kf] >= n {
+				return a1 - px, b1 - py, a1 - sx, b1 - sy
+			}
+		}
+	}
+	panic("policylock: no middle snake")
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// unifiedDiff renders a unified diff with the given number of context lines.
+func unifiedDiff(a, b, labelA, labelB string, context int) string {
+	edits := diffLines(splitLines(a), splitLines(b))
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", labelA, labelB)
+
+	// Line numbers (1-based) of each edit in a and b.
+	type pos struct{ ai, bi int }
+	at := make([]pos, len(edits))
+	ai, bi := 1, 1
+	for i, e := range edits {
+		at[i] = pos{ai, bi}
+		if e.op != '+' {
+			ai++
+		}
+		if e.op != '-' {
+			bi++
+		}
+	}
+
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for {
+			for end < len(edits) && edits[end].op != ' ' {
+				end++
+			}
+			next := end
+			for next < len(edits) && edits[next].op == ' ' {
+				next++
+			}
+			if next < len(edits) && next-end <= 2*context {
+				end = next
+				continue
+			}
+			end += context
+			if end > len(edits) {
+				end = len(edits)
+			}
+			break
+		}
+		na, nb := 0, 0
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				na++
+			}
+			if e.op != '-' {
+				nb++
+			}
+		}
+		sa, sb2 := at[start].ai, at[start].bi
+		if na == 0 {
+			sa--
+		}
+		if nb == 0 {
+			sb2--
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", sa, na, sb2, nb)
+		for _, e := range edits[start:end] {
+			sb.WriteByte(e.op)
+			sb.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return sb.String()
+}
@@ -0,0 +1,177 @@
+package policylock
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"policyguardian/internal/shared/hashing"
+)
+
+// RequestHeader is an extra header sent with a URL fetch. Secret values (and
+// values of SensitiveRequestHeaders) are recorded in request_headers as
+// RedactHeaderValue(salt, value) instead of the value itself.
+type RequestHeader struct {
+	Name   string
+	Value  string
+	Secret bool
+}
+
+// SensitiveRequestHeaders are always redacted, however they were supplied.
+var SensitiveRequestHeaders = []string{"authorization", "proxy-authorization", "cookie", "x-api-key", "x-auth-token"}
+
+// RedactHeaderValue returns "sha2-256:<hex>" of salt || value. Anyone holding
+// the credential and the recorded request_header_salt can recompute it.
+func RedactHeaderValue(saltHex, value string) (string, error) {
+	salt, err := hex.DecodeString(strings.TrimSpace(saltHex))
+	if err != nil || len(salt) == 0 {
+		return "", errors.New("invalid redaction salt hex")
+	}
+	return "sha2-256:" + hashing.SHA256Hex(append(salt, value...)), nil
+}
+
+func isSensitiveHeader(name string) bool {
+	for _, s := range SensitiveRequestHeaders {
+		if strings.EqualFold(s, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretHeaderNames returns the canonical names of the headers in hs whose
+// values are redacted in request_headers.
+func secretHeaderNames(hs []RequestHeader) []string {
+	var names []string
+	for _, h := range hs {
+		if h.Secret || isSensitiveHeader(h.Name) {
+			names = append(names, http.CanonicalHeaderKey(strings.TrimSpace(h.Name)))
+		}
+	}
+	return names
+}
+
+// applyRequestHeaders adds hs to req and returns the request_headers record
+// (lowercase names; repeated names joined with ", ") and the salt used, which
+// is empty when nothing needed redaction.
+func applyRequestHeaders(req *http.Request, hs []RequestHeader, saltHex string) (map[string]string, string, error) {
+	values := map[string][]string{}
+	secret := map[string]bool{}
+	var order []string
+	for _, h := range hs {
+		name := strings.TrimSpace(h.Name)
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") || strings.ContainsAny(h.Value, "\r\n") {
+			return nil, "", fmt.Errorf("invalid request header %q", h.Name)
+		}
+		req.Header.Add(name, h.Value)
+		k := strings.ToLower(name)
+		if _, ok := values[k]; !ok {
+			order = append(order, k)
+		}
+		values[k] = append(values[k], h.Value)
+		secret[k] = secret[k] || h.Secret || isSensitiveHeader(k)
+	}
+	rec := map[string]string{}
+	usedSalt := ""
+	for _, k := range order {
+		v := strings.Join(values[k], ", ")
+		if secret[k] {
+			if saltHex == "" {
+				salt := make([]byte, 16)
+				if _, err := rand.Read(salt); err != nil {
+					return nil, "", err
+				}
+				saltHex = hex.EncodeToString(salt)
+			}
+			r, err := RedactHeaderValue(saltHex, v)
+			if err != nil {
+				return nil, "", err
+			}
+			v = r
+			usedSalt = saltHex
+		}
+		rec[k] = v
+	}
+	return rec, usedSalt, nil
+}
+
+// ParseHeaderLine parses "Name: value".
+func ParseHeaderLine(s string) (RequestHeader, error) {
+	name, value, ok := strings.Cut(s, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return RequestHeader{}, fmt.Errorf("invalid header %q (want \"Name: value\")", s)
+	}
+	return RequestHeader{Name: name, Value: strings.TrimSpace(value)}, nil
+}
+
+// ParseHeaderFile reads one "Name: value" per line; blank lines and lines
+// starting with # are skipped. Every value is marked secret.
+func ParseHeaderFile(b []byte) ([]RequestHeader, error) {
+	var out []RequestHeader
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		h, err := ParseHeaderLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		h.Secret = true
+		out = append(out, h)
+	}
+	return out, sc.Err()
+}
+
+// ParseCookieFile returns the Cookie header value for host. The file is
+// either Netscape cookies.txt (tab-separated, as written by curl and browser
+// exporters; only cookies whose domain matches host are kept) or a single
+// "name=value; name2=value2" line.
+func ParseCookieFile(b []byte, host string) (string, error) {
+	host = strings.ToLower(host)
+	var pairs []string
+	netscape := false
+	var raw []string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "#HttpOnly_") {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+		} else if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Split(line, "\t")
+		if len(f) != 7 {
+			raw = append(raw, line)
+			continue
+		}
+		netscape = true
+		domain := strings.ToLower(strings.TrimPrefix(f[0], "."))
+		if host == domain || (strings.EqualFold(f[1], "TRUE") && strings.HasSuffix(host, "."+domain)) {
+			pairs = append(pairs, f[5]+"="+f[6])
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", err
+	}
+	if netscape {
+		if len(raw) > 0 {
+			return "", errors.New("cookie file mixes cookies.txt and raw lines")
+		}
+		if len(pairs) == 0 {
+			return "", fmt.Errorf("cookie file has no cookies for %s", host)
+		}
+		return strings.Join(pairs, "; "), nil
+	}
+	if len(raw) != 1 {
+		return "", errors.New("cookie file must hold cookies.txt lines or one name=value; ... line")
+	}
+	return strings.TrimPrefix(raw[0], "Cookie: "), nil
+}
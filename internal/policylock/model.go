@@ -9,18 +9,79 @@ type PolicySnapshot struct {
 	// SnapshotID is derived from sha2-256(JCS(sign_payload_bytes)).
 	// It MUST NOT be included in the signing payload.
 	SnapshotID string `json:"snapshot_id"`
+	// Signing describes the optional signature_envelope.json entry.
+	// It MUST NOT be included in the signing payload.
+	Signing *SnapshotSigning `json:"signing,omitempty"`
+
+	// Timestamp describes the optional RFC 3161 token entry over the
+	// sha2-256 of the JCS sign payload. It MUST NOT be included in the
+	// signing payload.
+	Timestamp *SnapshotTimestamp `json:"timestamp,omitempty"`
+}
+
+type SnapshotSigning struct {
+	Mode          string `json:"mode"` // ed25519|ecdsa-p256-sha256|rsa-pss-sha256
+	Algorithm     string `json:"algorithm,omitempty"`
+	PublicKey     string `json:"public_key,omitempty"`
+	KeyID         string `json:"key_id,omitempty"`
+	SignatureFile string `json:"signature_file,omitempty"`
+}
+
+type SnapshotTimestamp struct {
+	Mode       string `json:"mode"` // rfc3161
+	GenTimeUTC string `json:"gen_time_utc"`
+	TokenFile  string `json:"token_file"`
 }
 
 type PolicySection struct {
 	Input PolicyInput  `json:"input"`
 	Fetch *PolicyFetch `json:"fetch,omitempty"`
 	Bytes PolicyBytes  `json:"bytes"`
+	// Bundle summarizes bundle_manifest.json for the bundle, dir and git
+	// input modes (v0.2);
+	// Bytes then describes the manifest rather than policy_body.bin.
+	Bundle *PolicyBundle `json:"bundle,omitempty"`
+}
+
+type PolicyBundle struct {
+	DocumentCount int    `json:"document_count"`
+	MerkleRoot    string `json:"merkle_root"`
 }
 
 type PolicyInput struct {
-	Mode string `json:"mode"` // file|url|stdin
+	Mode string `json:"mode"` // file|url|stdin|bundle|dir|git|warc
 	Path string `json:"path,omitempty"`
 	URL  string `json:"url,omitempty"`
+	// Git is the provenance of a git snapshot (v0.2).
+	Git *GitSource `json:"git,omitempty"`
+	// WARC is the provenance of a snapshot imported from a WARC response
+	// record (v0.2); URL is the record's target URI.
+	WARC *WARCSource `json:"warc,omitempty"`
+}
+
+// WARCSource identifies the WARC record a snapshot was imported from.
+// Date is WARC-Date as written in the record; SnapshotID is set when the
+// record was exported from a snapshot pack.
+type WARCSource struct {
+	File          string `json:"file"`
+	RecordID      string `json:"record_id"`
+	TargetURI     string `json:"target_uri"`
+	Date          string `json:"date"`
+	BlockDigest   string `json:"block_digest,omitempty"`
+	PayloadDigest string `json:"payload_digest,omitempty"`
+	SnapshotID    string `json:"snapshot_id,omitempty"`
+}
+
+// GitSource identifies the commit a git snapshot was taken from. Author and
+// Committer are "Name <email>"; CommitTimeUTC is the committer time.
+type GitSource struct {
+	Repo          string `json:"repo"`
+	Rev           string `json:"rev"`
+	Commit        string `json:"commit"`
+	Tree          string `json:"tree"`
+	Author        string `json:"author"`
+	Committer     string `json:"committer"`
+	CommitTimeUTC string `json:"commit_time_utc"`
 }
 
 type PolicyFetch struct {
@@ -38,6 +99,62 @@ type PolicyFetch struct {
 	TLSLeafCertSHA256   string            `json:"tls_leaf_cert_sha256,omitempty"`
 	TLSSubjectCNSAN     string            `json:"tls_subject_cn_san,omitempty"`
 	CrossDomainRedirect *bool             `json:"cross_domain_redirect,omitempty"`
+	// RequestHeaderSalt is the hex salt of redacted request_headers values
+	// (v0.2); see RedactHeaderValue.
+	RequestHeaderSalt string `json:"request_header_salt,omitempty"`
+	// Connection details of the final response, captured with httptrace
+	// (v0.2). RemoteAddr is the ip:port actually connected to, and
+	// ResolvedIP its IP.
+	RemoteAddr       string `json:"remote_addr,omitempty"`
+	HTTPProtocol     string `json:"http_protocol,omitempty"`
+	TLSALPN          string `json:"tls_alpn,omitempty"`
+	TLSCipherSuite   string `json:"tls_cipher_suite,omitempty"`
+	ConnectionReused *bool  `json:"connection_reused,omitempty"`
+	// TLSChain and TLSOCSPStaple reference the optional tls_chain.pem and
+	// tls_ocsp_staple.der pack entries (v0.2); their hashes are part of the
+	// sign payload.
+	TLSChain      *PackEntry `json:"tls_chain,omitempty"`
+	TLSOCSPStaple *PackEntry `json:"tls_ocsp_staple,omitempty"`
+	// ResponseHeaders references the response_headers.json entry (v0.2).
+	ResponseHeaders *PackEntry `json:"response_headers,omitempty"`
+	// ResourceManifest references resource_manifest.json when same-origin
+	// subresources were captured (v0.2).
+	ResourceManifest *PackEntry `json:"resource_manifest,omitempty"`
+	// Transport records the effective fetch settings (v0.2).
+	Transport *FetchTransport `json:"transport,omitempty"`
+	// RedirectChain lists every request of the fetch in order, the last
+	// being the response that supplied the body. Present only in
+	// policylock.policy_snapshot.v0.2 packs.
+	RedirectChain []RedirectHop `json:"redirect_chain,omitempty"`
+}
+
+// RedirectHop is one request/response pair of a URL fetch.
+type RedirectHop struct {
+	URL               string `json:"url"`
+	HTTPStatus        int    `json:"http_status"`
+	Location          string `json:"location,omitempty"`
+	ResolvedIP        string `json:"resolved_ip,omitempty"`
+	TLSVersion        string `json:"tls_version,omitempty"`
+	TLSLeafCertSHA256 string `json:"tls_leaf_cert_sha256,omitempty"`
+	TLSSubjectCNSAN   string `json:"tls_subject_cn_san,omitempty"`
+}
+
+// FetchTransport is the non-secret part of the transport configuration of a
+// URL fetch. Files are recorded by hash: the CA bundle as read, the client
+// certificate as its leaf DER. Proxy is scheme://host:port without
+// credentials.
+type FetchTransport struct {
+	TimeoutMS        int64  `json:"timeout_ms"`
+	TLSMinVersion    string `json:"tls_min_version,omitempty"`
+	CABundleSHA256   string `json:"ca_bundle_sha256,omitempty"`
+	ClientCertSHA256 string `json:"client_cert_sha256,omitempty"`
+	Proxy            string `json:"proxy,omitempty"`
+}
+
+// PackEntry references an extra pack entry by name and sha2-256.
+type PackEntry struct {
+	File   string `json:"file"`
+	SHA256 string `json:"sha2-256"`
 }
 
 type PolicyBytes struct {
@@ -3,16 +3,19 @@ package policylock
 import (
 	"archive/zip"
 	"bytes"
+	"crypto"
 	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
 	"sort"
@@ -21,13 +24,40 @@ import (
 
 	"policyguardian/internal/shared/hashing"
 	"policyguardian/internal/shared/jcs"
+	"policyguardian/internal/shared/sigenv"
 	"policyguardian/internal/shared/timefmt"
+	"policyguardian/internal/shared/tsa"
 	"policyguardian/internal/shared/zipdet"
+	"policyguardian/internal/store"
 )
 
 const (
 	SchemaPolicySnapshot  = "policylock.policy_snapshot.v0.1"
 	SpecURLPolicyGuardian = "SPEC_POLICY_GUARDIAN_V0_1_FROZEN.md"
+
+	// SchemaPolicySnapshotV02 adds policy.fetch.redirect_chain and binds the
+	// schema name into the sign payload. URL snapshots are written as v0.2;
+	// file and stdin snapshots stay v0.1.
+	SchemaPolicySnapshotV02 = "policylock.policy_snapshot.v0.2"
+
+	// SignatureEnvelopeEntry is the optional pack entry holding the
+	// signature envelope over the JCS sign payload.
+	SignatureEnvelopeEntry = "signature_envelope.json"
+
+	// TimestampTokenEntry is the optional pack entry holding the DER RFC 3161
+	// TimeStampToken over the sha2-256 of the JCS sign payload.
+	TimestampTokenEntry = "timestamp_token.tst"
+
+	// TLSChainEntry holds the peer certificate chain of the final response
+	// as PEM, leaf first; TLSOCSPStapleEntry holds the stapled OCSP response
+	// (DER). Both are optional (SnapshotOptions.CaptureTLSChain).
+	TLSChainEntry      = "tls_chain.pem"
+	TLSOCSPStapleEntry = "tls_ocsp_staple.der"
+
+	// ResponseHeadersEntry holds the final response's headers as JCS JSON:
+	// lowercase names mapped to their values in received order, minus the
+	// deny-listed names.
+	ResponseHeadersEntry = "response_headers.json"
 )
 
 type SnapshotOptions struct {
@@ -36,8 +66,82 @@ type SnapshotOptions struct {
 	RetrievedAtUTC string
 	UserAgent      string
 	MaxBytes       int64
+
+	// Signer, SignKeyFile (a key file read with package keys, decrypted with
+	// SignKeyPassphrase) or the legacy SignPrivKeyHex (a 64-byte Ed25519
+	// private key in hex) selects an optional signing key; at most one may
+	// be set. When set, the pack carries signature_envelope.json.
+	Signer            crypto.Signer
+	SignKeyFile       string
+	SignKeyPassphrase []byte
+	SignPrivKeyHex    string
+
+	// TSAURL is an optional RFC 3161 time-stamping authority. When set, the
+	// pack carries timestamp_token.tst.
+	TSAURL string
+
+	// IfNoneMatch / IfModifiedSince make URL fetches conditional. A 304
+	// response is reported as ErrNotModified and produces no pack.
+	IfNoneMatch     string
+	IfModifiedSince string
+
+	// CaptureTLSChain stores the peer certificate chain and any stapled OCSP
+	// response of an https fetch as pack entries.
+	CaptureTLSChain bool
+
+	// RequestHeaders are sent with URL fetches and recorded (names, with
+	// secret values redacted) in policy.fetch.request_headers.
+	RequestHeaders []RequestHeader
+	// RedactionSaltHex salts redacted header values; a random 16-byte salt
+	// is used when empty.
+	RedactionSaltHex string
+
+	// Transport settings for URL fetches; see FetchTransport for what is
+	// recorded. ProxyURL may be http, https, socks5 or socks5h; without it
+	// HTTP(S)_PROXY from the environment applies. Timeout defaults to
+	// DefaultFetchTimeout.
+	ClientCertFile string
+	ClientKeyFile  string
+	CABundleFile   string
+	ProxyURL       string
+	Timeout        time.Duration
+	TLSMinVersion  uint16
+
+	// Transport, when set, replaces the per-fetch clone of
+	// http.DefaultTransport used for URL fetches. It cannot be combined with
+	// the settings above other than Timeout.
+	Transport http.RoundTripper
+
+	// ResponseHeaderDenyList names headers (case-insensitive) left out of
+	// response_headers.json. Nil means DefaultResponseHeaderDenyList.
+	ResponseHeaderDenyList []string
+
+	// WithResources captures the same-origin stylesheets, scripts, frames
+	// and images of an HTML page; see ResourceManifest. Zero limits mean
+	// DefaultResourceMaxDepth, DefaultResourceMaxBytes and
+	// DefaultResourceMaxCount.
+	WithResources    bool
+	ResourceMaxDepth int
+	ResourceMaxBytes int64
+	ResourceMaxCount int
+}
+
+// DefaultResponseHeaderDenyList drops headers that carry session secrets,
+// and headers that change on every request (the clock, cache age, request
+// and trace IDs of servers and CDNs), which would make otherwise identical
+// fetches differ (retrieved_at_utc records the fetch time).
+var DefaultResponseHeaderDenyList = []string{
+	"set-cookie", "set-cookie2", "authorization", "proxy-authorization",
+	"date", "age", "expires",
+	"x-request-id", "request-id", "x-correlation-id", "traceparent", "server-timing",
+	"cf-ray", "x-amz-cf-id", "x-amz-cf-pop", "x-amz-request-id", "x-amz-id-2",
+	"x-cache", "x-cache-hits", "x-served-by", "x-timer",
 }
 
+// ErrNotModified is returned by SnapshotFromURL when a conditional request
+// was answered with 304 Not Modified.
+var ErrNotModified = errors.New("not_modified: server returned 304")
+
 func (o SnapshotOptions) ua() string {
 	if o.UserAgent != "" {
 		return o.UserAgent
@@ -73,30 +177,63 @@ func SnapshotFromURL(rawurl string, opts SnapshotOptions) ([]byte, *PolicySnapsh
 	}
 
 	firstHost := u.Hostname()
+	firstScheme := u.Scheme
 	finalURL := rawurl
 	redirCount := 0
+	dropSecrets := false
 	var tlsInfo *tls.ConnectionState
 
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	base, transport, release, err := fetchTransport(opts, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+	hops := newHopRecorder(base)
 	client := &http.Client{
+		Transport: hops,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			redirCount = len(via)
 			finalURL = req.URL.String()
+			// net/http only drops Authorization and Cookie on a cross-host
+			// redirect; drop every redacted header on a change of host or
+			// scheme (https to http would send them in cleartext), and keep
+			// them dropped for the rest of the chain.
+			if !strings.EqualFold(req.URL.Hostname(), firstHost) || !strings.EqualFold(req.URL.Scheme, firstScheme) {
+				dropSecrets = true
+			}
+			if dropSecrets {
+				for _, name := range secretHeaderNames(opts.RequestHeaders) {
+					req.Header.Del(name)
+				}
+			}
 			return nil
 		},
-		Timeout: 30 * time.Second,
+		Timeout: time.Duration(transport.TimeoutMS) * time.Millisecond,
 	}
-
-	req, err := http.NewRequest("GET", rawurl, nil)
+	req.Header.Set("User-Agent", opts.ua())
+	if opts.IfNoneMatch != "" {
+		req.Header.Set("If-None-Match", opts.IfNoneMatch)
+	}
+	if opts.IfModifiedSince != "" {
+		req.Header.Set("If-Modified-Since", opts.IfModifiedSince)
+	}
+	reqHeaders, headerSalt, err := applyRequestHeaders(req, opts.RequestHeaders, opts.RedactionSaltHex)
 	if err != nil {
 		return nil, nil, err
 	}
-	req.Header.Set("User-Agent", opts.ua())
 
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil, ErrNotModified
+	}
 
 	if resp.TLS != nil {
 		tmp := *resp.TLS
@@ -134,31 +271,176 @@ func SnapshotFromURL(rawurl string, opts SnapshotOptions) ([]byte, *PolicySnapsh
 		ETag:           resp.Header.Get("ETag"),
 		LastModified:   resp.Header.Get("Last-Modified"),
 		RetrievedAtUTC: opts.RetrievedAtUTC,
+		RedirectChain:  hops.hops,
+
+		RequestHeaders:    reqHeaders,
+		RequestHeaderSalt: headerSalt,
+		Transport:         transport,
 	}
 	// Note: retrieved_at_utc is finalized in buildSnapshot.
 	// If the caller pins --created-at (and does not set --retrieved-at), we
 	// intentionally pin retrieved_at_utc to created_at_utc to make URL snapshots
 	// byte-identical across runs for the same content.
-	if ip, _ := resolveIP(firstHost); ip != "" {
-		fetch.ResolvedIP = ip
+	if c := hops.conn; c.remote != "" {
+		fetch.RemoteAddr = c.remote
+		fetch.ResolvedIP = hostOf(c.remote)
+		reused := c.reused
+		fetch.ConnectionReused = &reused
 	}
+	fetch.HTTPProtocol = resp.Proto
 	b := strings.ToLower(firstHost) != strings.ToLower(parseHost(finalURL))
 	fetch.CrossDomainRedirect = &b
 	if tlsInfo != nil {
 		fetch.TLSVersion = tlsVersionString(tlsInfo.Version)
+		fetch.TLSALPN = tlsInfo.NegotiatedProtocol
+		fetch.TLSCipherSuite = tls.CipherSuiteName(tlsInfo.CipherSuite)
 		if len(tlsInfo.PeerCertificates) > 0 {
 			leaf := tlsInfo.PeerCertificates[0]
 			fetch.TLSLeafCertSHA256 = sha256Hex(leaf.Raw)
 			fetch.TLSSubjectCNSAN = subjectCNSAN(leaf)
 		}
 	}
+	headersJSON, err := responseHeadersJSON(resp.Header, opts.ResponseHeaderDenyList)
+	if err != nil {
+		return nil, nil, err
+	}
+	extra := []zipdet.Entry{{Name: ResponseHeadersEntry, Data: headersJSON}}
+	fetch.ResponseHeaders = &PackEntry{File: ResponseHeadersEntry, SHA256: hashing.SHA256Hex(headersJSON)}
+	if opts.CaptureTLSChain && tlsInfo != nil && len(tlsInfo.PeerCertificates) > 0 {
+		var chain bytes.Buffer
+		for _, c := range tlsInfo.PeerCertificates {
+			_ = pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+		}
+		extra = append(extra, zipdet.Entry{Name: TLSChainEntry, Data: chain.Bytes()})
+		fetch.TLSChain = &PackEntry{File: TLSChainEntry, SHA256: hashing.SHA256Hex(chain.Bytes())}
+		if len(tlsInfo.OCSPResponse) > 0 {
+			extra = append(extra, zipdet.Entry{Name: TLSOCSPStapleEntry, Data: tlsInfo.OCSPResponse})
+			fetch.TLSOCSPStaple = &PackEntry{File: TLSOCSPStapleEntry, SHA256: hashing.SHA256Hex(tlsInfo.OCSPResponse)}
+		}
+	}
+	if opts.WithResources && isHTMLType(fetch.ContentType) {
+		manifest, resources, err := captureResources(base, client.Timeout, rawurl, finalURL, body, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		extra = append(extra, zipdet.Entry{Name: ResourceManifestEntry, Data: manifest})
+		extra = append(extra, resources...)
+		fetch.ResourceManifest = &PackEntry{File: ResourceManifestEntry, SHA256: hashing.SHA256Hex(manifest)}
+	}
 	in := PolicyInput{Mode: "url", URL: rawurl}
-	return buildSnapshot(body, in, fetch, opts)
+	return buildSnapshot(body, in, fetch, opts, extra...)
+}
+
+// responseHeadersJSON renders h for response_headers.json.
+func responseHeadersJSON(h http.Header, deny []string) ([]byte, error) {
+	if deny == nil {
+		deny = DefaultResponseHeaderDenyList
+	}
+	drop := map[string]bool{}
+	for _, d := range deny {
+		drop[strings.ToLower(strings.TrimSpace(d))] = true
+	}
+	m := map[string]any{}
+	for k, vs := range h {
+		k = strings.ToLower(k)
+		if drop[k] {
+			continue
+		}
+		vals, _ := m[k].([]any)
+		for _, v := range vs {
+			vals = append(vals, v)
+		}
+		m[k] = vals
+	}
+	return jcs.CanonicalizeValue(m)
+}
+
+// hopRecorder is the fetch transport; it records one RedirectHop per
+// round trip, so the redirects followed by the client appear in order.
+// The remote address comes from the connection the request was sent on
+// (httptrace), not from a separate DNS lookup.
+type hopRecorder struct {
+	base http.RoundTripper
+	// proxy is the transport's proxy selection. A proxied request connects
+	// to the proxy, so its address says nothing about the origin server and
+	// is not recorded.
+	proxy func(*http.Request) (*url.URL, error)
+	hops  []RedirectHop
+	// conn describes the connection of the latest round trip.
+	conn connInfo
+}
+
+type connInfo struct {
+	remote string
+	reused bool
+}
+
+// newHopRecorder wraps rt, taking the proxy selection from an
+// *http.Transport.
+func newHopRecorder(rt http.RoundTripper) *hopRecorder {
+	h := &hopRecorder{base: rt}
+	if t, ok := rt.(*http.Transport); ok {
+		h.proxy = t.Proxy
+	}
+	return h
+}
+
+func (h *hopRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var c connInfo
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			c = connInfo{remote: info.Conn.RemoteAddr().String(), reused: info.Reused}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := h.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if h.proxy != nil {
+		if pu, _ := h.proxy(req); pu != nil {
+			c = connInfo{}
+		}
+	}
+	h.conn = c
+	hop := RedirectHop{URL: req.URL.String(), HTTPStatus: resp.StatusCode, ResolvedIP: hostOf(c.remote)}
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		hop.Location = resp.Header.Get("Location")
+	}
+	if resp.TLS != nil {
+		hop.TLSVersion = tlsVersionString(resp.TLS.Version)
+		if len(resp.TLS.PeerCertificates) > 0 {
+			leaf := resp.TLS.PeerCertificates[0]
+			hop.TLSLeafCertSHA256 = sha256Hex(leaf.Raw)
+			hop.TLSSubjectCNSAN = subjectCNSAN(leaf)
+		}
+	}
+	h.hops = append(h.hops, hop)
+	return resp, nil
+}
+
+// FormatRedirectHop renders hop n (1-based) of a redirect chain on one line:
+// "<n> <status> <url> [-> <location>] [ip=..] [tls=..]".
+func FormatRedirectHop(n int, h RedirectHop) string {
+	s := fmt.Sprintf("%d %d %s", n, h.HTTPStatus, h.URL)
+	if h.Location != "" {
+		s += " -> " + h.Location
+	}
+	if h.ResolvedIP != "" {
+		s += " ip=" + h.ResolvedIP
+	}
+	if h.TLSVersion != "" {
+		s += " tls=" + h.TLSVersion
+	}
+	return s
 }
 
 func validateModeInvariants(input PolicyInput, fetch *PolicyFetch) error {
+	if (input.Mode != "git" && input.Git != nil) || (input.Mode != "warc" && input.WARC != nil) {
+		return errors.New("invalid mode invariants")
+	}
 	switch input.Mode {
-	case "file":
+	case "file", "dir":
 		if input.Path == "" || input.URL != "" || fetch != nil {
 			return errors.New("invalid mode invariants")
 		}
@@ -166,17 +448,29 @@ func validateModeInvariants(input PolicyInput, fetch *PolicyFetch) error {
 		if input.URL == "" || input.Path != "" || fetch == nil {
 			return errors.New("invalid mode invariants")
 		}
-	case "stdin":
+	case "stdin", "bundle":
 		if input.Path != "" || input.URL != "" || fetch != nil {
 			return errors.New("invalid mode invariants")
 		}
+	case "git":
+		g := input.Git
+		if g == nil || g.Repo == "" || g.Commit == "" || g.Tree == "" || input.Path != "" || input.URL != "" || fetch != nil {
+			return errors.New("invalid mode invariants")
+		}
+	case "warc":
+		w := input.WARC
+		if w == nil || w.TargetURI == "" || input.URL != w.TargetURI || input.Path != "" || fetch == nil {
+			return errors.New("invalid mode invariants")
+		}
 	default:
-		return errors.New("invalid mode: must be file|url|stdin")
+		return errors.New("invalid mode: must be file|url|stdin|bundle|dir|git|warc")
 	}
 	return nil
 }
 
-func buildSnapshot(policyBytes []byte, input PolicyInput, fetch *PolicyFetch, opts SnapshotOptions) ([]byte, *PolicySnapshot, error) {
+// buildSnapshot assembles the pack; extra entries (already referenced from
+// fetch) are stored after the fixed ones.
+func buildSnapshot(policyBytes []byte, input PolicyInput, fetch *PolicyFetch, opts SnapshotOptions, extra ...zipdet.Entry) ([]byte, *PolicySnapshot, error) {
 	if strings.TrimSpace(opts.ToolVersion) == "" {
 		return nil, nil, fmt.Errorf("tool_version required")
 	}
@@ -197,8 +491,12 @@ func buildSnapshot(policyBytes []byte, input PolicyInput, fetch *PolicyFetch, op
 		}
 	}
 	pHash := hashing.SHA256Hex(policyBytes)
+	schema := SchemaPolicySnapshot
+	if (fetch != nil && len(fetch.RedirectChain) > 0) || isBundleMode(input.Mode) || input.Mode == "warc" {
+		schema = SchemaPolicySnapshotV02
+	}
 	snap := &PolicySnapshot{
-		Schema:       SchemaPolicySnapshot,
+		Schema:       schema,
 		SpecURL:      SpecURLPolicyGuardian,
 		ToolVersion:  opts.ToolVersion,
 		CreatedAtUTC: created,
@@ -212,8 +510,20 @@ func buildSnapshot(policyBytes []byte, input PolicyInput, fetch *PolicyFetch, op
 		},
 		SnapshotID: "",
 	}
+	if isBundleMode(input.Mode) {
+		m, err := parseBundleManifest(policyBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		snap.Policy.Bundle = &PolicyBundle{DocumentCount: len(m.Documents), MerkleRoot: m.MerkleRoot}
+	}
 	if input.Mode == "url" {
-		fetch.RequestHeaders = map[string]string{"user-agent": opts.ua()}
+		if fetch.RequestHeaders == nil {
+			fetch.RequestHeaders = map[string]string{}
+		}
+		if _, ok := fetch.RequestHeaders["user-agent"]; !ok {
+			fetch.RequestHeaders["user-agent"] = opts.ua()
+		}
 	}
 
 	payload, err := BuildSignPayload(*snap)
@@ -226,14 +536,60 @@ func buildSnapshot(policyBytes []byte, input PolicyInput, fetch *PolicyFetch, op
 	}
 	snap.SnapshotID = hashing.SHA256Hex(signBytes)
 
+	var envBytes []byte
+	signer, err := sigenv.ResolveSigner(opts.Signer, opts.SignKeyFile, opts.SignKeyPassphrase, opts.SignPrivKeyHex)
+	if err != nil {
+		return nil, nil, err
+	}
+	if signer != nil {
+		env, raw, err := sigenv.Sign(signer, signBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		envBytes = raw
+		snap.Signing = &SnapshotSigning{
+			Mode:          env.Algorithm,
+			Algorithm:     env.Algorithm,
+			PublicKey:     env.PublicKey,
+			KeyID:         env.KeyID,
+			SignatureFile: SignatureEnvelopeEntry,
+		}
+	}
+
+	var tokenBytes []byte
+	if opts.TSAURL != "" {
+		digest := sha256.Sum256(signBytes)
+		token, err := tsa.Request(opts.TSAURL, digest[:])
+		if err != nil {
+			return nil, nil, fmt.Errorf("tsa: %w", err)
+		}
+		info, reason := tsa.Verify(token, digest[:], nil)
+		if reason != "" {
+			return nil, nil, fmt.Errorf("tsa: %s", reason)
+		}
+		tokenBytes = token
+		snap.Timestamp = &SnapshotTimestamp{
+			Mode:       "rfc3161",
+			GenTimeUTC: timefmt.Format(info.GenTime),
+			TokenFile:  TimestampTokenEntry,
+		}
+	}
+
 	snapJSON, err := json.MarshalIndent(snap, "", "  ")
 	if err != nil {
 		return nil, nil, err
 	}
 	entries := []zipdet.Entry{
-		{Name: "policy_body.bin", Data: policyBytes},
+		{Name: bodyEntry(snap), Data: policyBytes},
 		{Name: "policy_snapshot.json", Data: snapJSON},
 	}
+	if envBytes != nil {
+		entries = append(entries, zipdet.Entry{Name: SignatureEnvelopeEntry, Data: envBytes})
+	}
+	if tokenBytes != nil {
+		entries = append(entries, zipdet.Entry{Name: TimestampTokenEntry, Data: tokenBytes})
+	}
+	entries = append(entries, extra...)
 	zipBytes, err := zipdet.WriteDeterministicZip(entries)
 	if err != nil {
 		return nil, nil, err
@@ -255,13 +611,51 @@ func BuildSignPayload(s PolicySnapshot) (map[string]any, error) {
 			},
 		},
 	}
+	if s.Schema == SchemaPolicySnapshotV02 {
+		p["schema"] = s.Schema
+	}
 	inm := p["policy"].(map[string]any)["input"].(map[string]any)
-	if s.Policy.Input.Mode == "file" && s.Policy.Input.Path != "" {
+	if (s.Policy.Input.Mode == "file" || s.Policy.Input.Mode == "dir") && s.Policy.Input.Path != "" {
 		inm["path"] = s.Policy.Input.Path
 	}
-	if s.Policy.Input.Mode == "url" && s.Policy.Input.URL != "" {
+	if g := s.Policy.Input.Git; g != nil {
+		inm["git"] = map[string]any{
+			"repo":            g.Repo,
+			"rev":             g.Rev,
+			"commit":          g.Commit,
+			"tree":            g.Tree,
+			"author":          g.Author,
+			"committer":       g.Committer,
+			"commit_time_utc": g.CommitTimeUTC,
+		}
+	}
+	if (s.Policy.Input.Mode == "url" || s.Policy.Input.Mode == "warc") && s.Policy.Input.URL != "" {
 		inm["url"] = s.Policy.Input.URL
 	}
+	if w := s.Policy.Input.WARC; w != nil {
+		wm := map[string]any{
+			"file":       w.File,
+			"record_id":  w.RecordID,
+			"target_uri": w.TargetURI,
+			"date":       w.Date,
+		}
+		for k, v := range map[string]string{
+			"block_digest":   w.BlockDigest,
+			"payload_digest": w.PayloadDigest,
+			"snapshot_id":    w.SnapshotID,
+		} {
+			if v != "" {
+				wm[k] = v
+			}
+		}
+		inm["warc"] = wm
+	}
+	if b := s.Policy.Bundle; b != nil {
+		p["policy"].(map[string]any)["bundle"] = map[string]any{
+			"document_count": b.DocumentCount,
+			"merkle_root":    b.MerkleRoot,
+		}
+	}
 	if s.Policy.Fetch != nil {
 		f := map[string]any{}
 		addStr := func(k, v string) {
@@ -285,6 +679,38 @@ func BuildSignPayload(s PolicySnapshot) (map[string]any, error) {
 		addStr("tls_version", s.Policy.Fetch.TLSVersion)
 		addStr("tls_leaf_cert_sha256", s.Policy.Fetch.TLSLeafCertSHA256)
 		addStr("tls_subject_cn_san", s.Policy.Fetch.TLSSubjectCNSAN)
+		addStr("request_header_salt", s.Policy.Fetch.RequestHeaderSalt)
+		addStr("remote_addr", s.Policy.Fetch.RemoteAddr)
+		addStr("http_protocol", s.Policy.Fetch.HTTPProtocol)
+		addStr("tls_alpn", s.Policy.Fetch.TLSALPN)
+		addStr("tls_cipher_suite", s.Policy.Fetch.TLSCipherSuite)
+		if s.Policy.Fetch.ConnectionReused != nil {
+			f["connection_reused"] = *s.Policy.Fetch.ConnectionReused
+		}
+		if t := s.Policy.Fetch.Transport; t != nil {
+			tm := map[string]any{"timeout_ms": t.TimeoutMS}
+			for k, v := range map[string]string{
+				"tls_min_version":    t.TLSMinVersion,
+				"ca_bundle_sha256":   t.CABundleSHA256,
+				"client_cert_sha256": t.ClientCertSHA256,
+				"proxy":              t.Proxy,
+			} {
+				if v != "" {
+					tm[k] = v
+				}
+			}
+			f["transport"] = tm
+		}
+		for k, e := range map[string]*PackEntry{
+			"tls_chain":         s.Policy.Fetch.TLSChain,
+			"tls_ocsp_staple":   s.Policy.Fetch.TLSOCSPStaple,
+			"response_headers":  s.Policy.Fetch.ResponseHeaders,
+			"resource_manifest": s.Policy.Fetch.ResourceManifest,
+		} {
+			if e != nil {
+				f[k] = map[string]any{"file": e.File, "sha2-256": e.SHA256}
+			}
+		}
 		if s.Policy.Fetch.CrossDomainRedirect != nil {
 			f["cross_domain_redirect"] = *s.Policy.Fetch.CrossDomainRedirect
 		}
@@ -306,22 +732,79 @@ func BuildSignPayload(s PolicySnapshot) (map[string]any, error) {
 				f["request_headers"] = rh
 			}
 		}
+		if len(s.Policy.Fetch.RedirectChain) > 0 {
+			chain := make([]any, 0, len(s.Policy.Fetch.RedirectChain))
+			for _, h := range s.Policy.Fetch.RedirectChain {
+				hm := map[string]any{"url": h.URL, "http_status": h.HTTPStatus}
+				for k, v := range map[string]string{
+					"location":             h.Location,
+					"resolved_ip":          h.ResolvedIP,
+					"tls_version":          h.TLSVersion,
+					"tls_leaf_cert_sha256": h.TLSLeafCertSHA256,
+					"tls_subject_cn_san":   h.TLSSubjectCNSAN,
+				} {
+					if v != "" {
+						hm[k] = v
+					}
+				}
+				chain = append(chain, hm)
+			}
+			f["redirect_chain"] = chain
+		}
 		p["policy"].(map[string]any)["fetch"] = f
 	}
 	return p, nil
 }
 
+// VerifyOptions tunes VerifySnapshotZipWithOptions.
+type VerifyOptions struct {
+	// TSARoots, when set, requires a timestamp token whose signer chains to
+	// one of these roots. Without it a present token's imprint and signature
+	// are still checked but its certificate chain is not.
+	TSARoots *x509.CertPool
+
+	// TLSRoots, when set, requires a tls_chain.pem entry that chains to one
+	// of these roots for the final URL's host as of retrieved_at_utc.
+	TLSRoots *x509.CertPool
+}
+
+// VerifySnapshotZip checks a snapshot pack. When the pack carries a
+// signature envelope it is verified as well, and the envelope public key must
+// match signing.public_key in policy_snapshot.json.
 func VerifySnapshotZip(zipBytes []byte) (string, string, error) {
+	return VerifySnapshotZipWithOptions(zipBytes, VerifyOptions{})
+}
+
+// VerifySnapshotZipWithOptions is VerifySnapshotZip with RFC 3161 trust roots.
+func VerifySnapshotZipWithOptions(zipBytes []byte, opts VerifyOptions) (string, string, error) {
 	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
 	if err != nil {
 		return "", "", err
 	}
 	var snapJSON []byte
 	var body []byte
+	var envJSON []byte
+	var token []byte
+	var tlsChain, ocspStaple, respHeaders []byte
+	var manifest, resManifest []byte
+	bundleBodies := map[string][]byte{}
+	resources := map[string][]byte{}
 	for _, f := range zr.File {
 		if strings.Contains(f.Name, "..") || strings.HasPrefix(f.Name, "/") || strings.Contains(f.Name, `\`) {
 			return "INVALID", "zip_slip_path", nil
 		}
+		if name, ok := strings.CutPrefix(f.Name, BundleBodiesDir); ok {
+			rc, _ := f.Open()
+			bundleBodies[name], _ = io.ReadAll(rc)
+			rc.Close()
+			continue
+		}
+		if strings.HasPrefix(f.Name, ResourcesDir) {
+			rc, _ := f.Open()
+			resources[f.Name], _ = io.ReadAll(rc)
+			rc.Close()
+			continue
+		}
 		switch f.Name {
 		case "policy_snapshot.json":
 			rc, _ := f.Open()
@@ -331,15 +814,65 @@ func VerifySnapshotZip(zipBytes []byte) (string, string, error) {
 			rc, _ := f.Open()
 			body, _ = io.ReadAll(rc)
 			rc.Close()
+		case SignatureEnvelopeEntry:
+			rc, _ := f.Open()
+			envJSON, _ = io.ReadAll(rc)
+			rc.Close()
+		case TimestampTokenEntry:
+			rc, _ := f.Open()
+			token, _ = io.ReadAll(rc)
+			rc.Close()
+		case TLSChainEntry:
+			rc, _ := f.Open()
+			tlsChain, _ = io.ReadAll(rc)
+			rc.Close()
+		case TLSOCSPStapleEntry:
+			rc, _ := f.Open()
+			ocspStaple, _ = io.ReadAll(rc)
+			rc.Close()
+		case ResponseHeadersEntry:
+			rc, _ := f.Open()
+			respHeaders, _ = io.ReadAll(rc)
+			rc.Close()
+		case BundleManifestEntry:
+			rc, _ := f.Open()
+			manifest, _ = io.ReadAll(rc)
+			rc.Close()
+		case ResourceManifestEntry:
+			rc, _ := f.Open()
+			resManifest, _ = io.ReadAll(rc)
+			rc.Close()
 		}
 	}
-	if snapJSON == nil || body == nil {
+	if snapJSON == nil || (body == nil && manifest == nil) {
 		return "INVALID", "missing_required_files", nil
 	}
 	var snap PolicySnapshot
 	if err := json.Unmarshal(snapJSON, &snap); err != nil {
 		return "INVALID", "invalid_policy_snapshot_json", nil
 	}
+	isBundle := isBundleMode(snap.Policy.Input.Mode)
+	if isBundle {
+		body = manifest
+	}
+	if body == nil {
+		return "INVALID", "missing_required_files", nil
+	}
+	switch snap.Schema {
+	case SchemaPolicySnapshot:
+		if snap.Policy.Fetch != nil && len(snap.Policy.Fetch.RedirectChain) > 0 {
+			return "INVALID", "redirect_chain_requires_v0_2", nil
+		}
+		if isBundle || snap.Policy.Bundle != nil || snap.Policy.Input.Git != nil {
+			return "INVALID", "bundle_requires_v0_2", nil
+		}
+		if snap.Policy.Input.Mode == "warc" || snap.Policy.Input.WARC != nil {
+			return "INVALID", "warc_requires_v0_2", nil
+		}
+	case SchemaPolicySnapshotV02:
+	default:
+		return "INVALID", "unsupported_schema", nil
+	}
 	bodyHash := hashing.SHA256Hex(body)
 	if snap.Policy.Bytes.Hashes == nil || snap.Policy.Bytes.Hashes["sha2-256"] != bodyHash {
 		return "INVALID", "policy_body_hash_mismatch", nil
@@ -356,16 +889,160 @@ func VerifySnapshotZip(zipBytes []byte) (string, string, error) {
 	if snap.SnapshotID != exp {
 		return "INVALID", "snapshot_id_mismatch", nil
 	}
+	if snap.Signing != nil || envJSON != nil {
+		if snap.Signing == nil || !sigenv.Supported(snap.Signing.Mode) {
+			return "INVALID", "unsupported_signing_mode", nil
+		}
+		if envJSON == nil {
+			return "INVALID", "signature_missing", nil
+		}
+		env, reason := sigenv.Parse(envJSON)
+		if reason != "" {
+			return "INVALID", reason, nil
+		}
+		if reason := sigenv.Verify(env, signBytes); reason != "" {
+			return "INVALID", reason, nil
+		}
+		if env.Algorithm != snap.Signing.Mode {
+			return "INVALID", "signature_algorithm_mismatch", nil
+		}
+		if env.PublicKey != snap.Signing.PublicKey {
+			return "INVALID", "signer_public_key_mismatch", nil
+		}
+		if snap.Signing.KeyID != "" && snap.Signing.KeyID != env.SignerKeyID() {
+			return "INVALID", "signer_key_id_mismatch", nil
+		}
+	}
+	if snap.Timestamp != nil || token != nil {
+		if snap.Timestamp == nil || snap.Timestamp.Mode != "rfc3161" {
+			return "INVALID", "unsupported_timestamp_mode", nil
+		}
+		if token == nil {
+			return "INVALID", "timestamp_missing", nil
+		}
+		digest := sha256.Sum256(signBytes)
+		info, reason := tsa.Verify(token, digest[:], opts.TSARoots)
+		if reason != "" {
+			return "INVALID", reason, nil
+		}
+		if timefmt.Format(info.GenTime) != snap.Timestamp.GenTimeUTC {
+			return "INVALID", "timestamp_gen_time_mismatch", nil
+		}
+	} else if opts.TSARoots != nil {
+		return "INVALID", "timestamp_missing", nil
+	}
+	var headersRef, resourcesRef *PackEntry
+	if snap.Policy.Fetch != nil {
+		headersRef = snap.Policy.Fetch.ResponseHeaders
+		resourcesRef = snap.Policy.Fetch.ResourceManifest
+	}
+	if reason := checkPackEntry("response_headers", headersRef, ResponseHeadersEntry, respHeaders); reason != "" {
+		return "INVALID", reason, nil
+	}
+	if reason := checkPackEntry("resource_manifest", resourcesRef, ResourceManifestEntry, resManifest); reason != "" {
+		return "INVALID", reason, nil
+	}
+	if reason := verifyResources(snap.Policy.Fetch, resManifest, resources); reason != "" {
+		return "INVALID", reason, nil
+	}
+	if reason := verifyTLSEntries(snap.Policy.Fetch, tlsChain, ocspStaple, opts.TLSRoots); reason != "" {
+		return "INVALID", reason, nil
+	}
+	if isBundle {
+		if reason := verifyBundle(&snap, manifest, bundleBodies); reason != "" {
+			return "INVALID", reason, nil
+		}
+	} else if snap.Policy.Bundle != nil || len(bundleBodies) > 0 {
+		return "INVALID", "bundle_unexpected_document", nil
+	}
 	return "VALID", "", nil
 }
 
+// checkPackEntry checks that an optional entry and its reference are either
+// both absent or present with matching sha2-256. Reasons are prefixed with
+// field: <field>_missing, <field>_hash_mismatch.
+func checkPackEntry(field string, ref *PackEntry, name string, data []byte) string {
+	if ref == nil && data == nil {
+		return ""
+	}
+	if ref == nil || ref.File != name || data == nil {
+		return field + "_missing"
+	}
+	if hashing.SHA256Hex(data) != ref.SHA256 {
+		return field + "_hash_mismatch"
+	}
+	return ""
+}
+
+// verifyTLSEntries checks the TLS chain and OCSP staple entries against
+// their references and, with roots, re-validates the chain as of
+// retrieved_at_utc. It returns a reason code, or "" when they check out.
+func verifyTLSEntries(f *PolicyFetch, chain, staple []byte, roots *x509.CertPool) string {
+	var chainRef, stapleRef *PackEntry
+	if f != nil {
+		chainRef, stapleRef = f.TLSChain, f.TLSOCSPStaple
+	}
+	if reason := checkPackEntry("tls_ocsp_staple", stapleRef, TLSOCSPStapleEntry, staple); reason != "" {
+		return reason
+	}
+	if chainRef == nil && chain == nil {
+		if roots != nil {
+			return "tls_chain_missing"
+		}
+		return ""
+	}
+	if reason := checkPackEntry("tls_chain", chainRef, TLSChainEntry, chain); reason != "" {
+		return reason
+	}
+	var certs []*x509.Certificate
+	for rest := chain; ; {
+		var blk *pem.Block
+		blk, rest = pem.Decode(rest)
+		if blk == nil {
+			break
+		}
+		c, err := x509.ParseCertificate(blk.Bytes)
+		if blk.Type != "CERTIFICATE" || err != nil {
+			return "tls_chain_invalid"
+		}
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return "tls_chain_invalid"
+	}
+	if sha256Hex(certs[0].Raw) != f.TLSLeafCertSHA256 {
+		return "tls_chain_leaf_mismatch"
+	}
+	if roots == nil {
+		return ""
+	}
+	at, err := timefmt.Parse(f.RetrievedAtUTC)
+	if err != nil {
+		return "tls_chain_untrusted"
+	}
+	inter := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		inter.AddCert(c)
+	}
+	_, err = certs[0].Verify(x509.VerifyOptions{
+		DNSName:       parseHost(f.FinalURL),
+		Roots:         roots,
+		Intermediates: inter,
+		CurrentTime:   at,
+	})
+	if err != nil {
+		return "tls_chain_untrusted"
+	}
+	return ""
+}
+
 func ReadSnapshotInfo(zipBytes []byte) (*PolicySnapshot, string, error) {
 	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
 	if err != nil {
 		return nil, "", err
 	}
 	var snapJSON []byte
-	var body []byte
+	var body, manifest []byte
 	for _, f := range zr.File {
 		switch f.Name {
 		case "policy_snapshot.json":
@@ -376,55 +1053,164 @@ func ReadSnapshotInfo(zipBytes []byte) (*PolicySnapshot, string, error) {
 			rc, _ := f.Open()
 			body, _ = io.ReadAll(rc)
 			rc.Close()
+		case BundleManifestEntry:
+			rc, _ := f.Open()
+			manifest, _ = io.ReadAll(rc)
+			rc.Close()
 		}
 	}
-	if snapJSON == nil || body == nil {
+	if snapJSON == nil {
 		return nil, "", fmt.Errorf("missing required files")
 	}
 	var snap PolicySnapshot
 	if err := json.Unmarshal(snapJSON, &snap); err != nil {
 		return nil, "", err
 	}
+	if isBundleMode(snap.Policy.Input.Mode) {
+		body = manifest
+	}
+	if body == nil {
+		return nil, "", fmt.Errorf("missing required files")
+	}
 	return &snap, hashing.SHA256Hex(body), nil
 }
 
+// StoreMeta returns the evidence store index entry for a snapshot pack.
+func StoreMeta(zipBytes []byte) (store.Meta, error) {
+	snap, bodyHash, err := ReadSnapshotInfo(zipBytes)
+	if err != nil {
+		return store.Meta{}, err
+	}
+	return store.Meta{
+		Kind:         store.KindSnapshot,
+		ID:           snap.SnapshotID,
+		CreatedAtUTC: snap.CreatedAtUTC,
+		PolicySHA256: bodyHash,
+		URL:          snap.Policy.Input.URL,
+	}, nil
+}
+
+// ShowField is one "key: value" line of ShowSnapshot.
+type ShowField struct {
+	Key   string
+	Value string
+}
+
+// ShowSnapshotFields returns the human-readable summary of a pack as ordered
+// fields.
+func ShowSnapshotFields(zipBytes []byte) ([]ShowField, error) {
+	snap, bodyHash, err := ReadSnapshotInfo(zipBytes)
+	if err != nil {
+		return nil, err
+	}
+	fields := []ShowField{
+		{"schema", snap.Schema},
+		{"created_at_utc", snap.CreatedAtUTC},
+		{"snapshot_id", snap.SnapshotID},
+		{"policy_sha256", bodyHash},
+	}
+	if snap.Policy.Input.Mode == "file" {
+		fields = append(fields, ShowField{"input_file", snap.Policy.Input.Path})
+	}
+	if snap.Policy.Input.Mode == "dir" {
+		fields = append(fields, ShowField{"input_dir", snap.Policy.Input.Path})
+	}
+	if g := snap.Policy.Input.Git; g != nil {
+		fields = append(fields,
+			ShowField{"git_repo", g.Repo},
+			ShowField{"git_rev", g.Rev},
+			ShowField{"git_commit", g.Commit},
+			ShowField{"git_tree", g.Tree},
+			ShowField{"git_author", g.Author},
+			ShowField{"git_committer", g.Committer},
+			ShowField{"git_commit_time_utc", g.CommitTimeUTC},
+		)
+	}
+	if isBundleMode(snap.Policy.Input.Mode) {
+		m, err := ReadBundleManifest(zipBytes)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, ShowField{"bundle_merkle_root", m.MerkleRoot})
+		for _, d := range m.Documents {
+			fields = append(fields, ShowField{"document", FormatBundleDocument(d)})
+		}
+	}
+	if w := snap.Policy.Input.WARC; w != nil {
+		fields = append(fields,
+			ShowField{"warc_file", w.File},
+			ShowField{"warc_record_id", w.RecordID},
+			ShowField{"warc_date", w.Date},
+		)
+		if w.SnapshotID != "" {
+			fields = append(fields, ShowField{"warc_source_snapshot_id", w.SnapshotID})
+		}
+	}
+	if snap.Policy.Input.Mode == "url" || snap.Policy.Input.Mode == "warc" {
+		fields = append(fields, ShowField{"input_url", snap.Policy.Input.URL})
+		if snap.Policy.Fetch != nil {
+			for i, h := range snap.Policy.Fetch.RedirectChain {
+				fields = append(fields, ShowField{"redirect_hop", FormatRedirectHop(i+1, h)})
+			}
+			if e := snap.Policy.Fetch.ResponseHeaders; e != nil {
+				fields = append(fields, ShowField{"response_headers", e.File + " sha2-256=" + e.SHA256})
+			}
+			if e := snap.Policy.Fetch.TLSChain; e != nil {
+				fields = append(fields, ShowField{"tls_chain", e.File + " sha2-256=" + e.SHA256})
+			}
+			if e := snap.Policy.Fetch.TLSOCSPStaple; e != nil {
+				fields = append(fields, ShowField{"tls_ocsp_staple", e.File + " sha2-256=" + e.SHA256})
+			}
+			if e := snap.Policy.Fetch.ResourceManifest; e != nil {
+				fields = append(fields, ShowField{"resource_manifest", e.File + " sha2-256=" + e.SHA256})
+				m, err := ReadResourceManifest(zipBytes)
+				if err != nil {
+					return nil, err
+				}
+				for _, r := range m.Resources {
+					fields = append(fields, ShowField{"resource", FormatResource(r)})
+				}
+				for _, s := range m.Skipped {
+					fields = append(fields, ShowField{"resource_skipped", FormatSkippedResource(s)})
+				}
+			}
+		}
+	}
+	if snap.Signing != nil {
+		fields = append(fields, ShowField{"signing_mode", snap.Signing.Mode}, ShowField{"signer_public_key", snap.Signing.PublicKey})
+		if snap.Signing.KeyID != "" {
+			fields = append(fields, ShowField{"signer_key_id", snap.Signing.KeyID})
+		}
+	}
+	if snap.Timestamp != nil {
+		fields = append(fields, ShowField{"timestamp_mode", snap.Timestamp.Mode}, ShowField{"timestamp_gen_time_utc", snap.Timestamp.GenTimeUTC})
+	}
+	return fields, nil
+}
+
 func ShowSnapshot(zipPath string) (string, error) {
 	b, err := os.ReadFile(zipPath)
 	if err != nil {
 		return "", err
 	}
-	snap, bodyHash, err := ReadSnapshotInfo(b)
+	fields, err := ShowSnapshotFields(b)
 	if err != nil {
 		return "", err
 	}
 	var sb strings.Builder
-	fmt.Fprintf(&sb, "schema: %s\n", snap.Schema)
-	fmt.Fprintf(&sb, "created_at_utc: %s\n", snap.CreatedAtUTC)
-	fmt.Fprintf(&sb, "snapshot_id: %s\n", snap.SnapshotID)
-	fmt.Fprintf(&sb, "policy_sha256: %s\n", bodyHash)
-	if snap.Policy.Input.Mode == "file" {
-		fmt.Fprintf(&sb, "input_file: %s\n", snap.Policy.Input.Path)
-	}
-	if snap.Policy.Input.Mode == "url" {
-		fmt.Fprintf(&sb, "input_url: %s\n", snap.Policy.Input.URL)
+	for _, f := range fields {
+		fmt.Fprintf(&sb, "%s: %s\n", f.Key, f.Value)
 	}
 	return sb.String(), nil
 }
 
-func resolveIP(host string) (string, error) {
-	if host == "" {
-		return "", nil
-	}
-	ips, err := net.LookupIP(host)
-	if err != nil || len(ips) == 0 {
-		return "", err
-	}
-	for _, ip := range ips {
-		if ip.To4() != nil {
-			return ip.String(), nil
-		}
+// hostOf returns the IP of an ip:port remote address.
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
 	}
-	return ips[0].String(), nil
+	return host
 }
 
 func parseHost(u string) string {
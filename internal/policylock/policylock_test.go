@@ -3,13 +3,38 @@ package policylock
 import (
 	"archive/zip"
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	mrand "math/rand"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"policyguardian/internal/shared/hashing"
 	"policyguardian/internal/shared/jcs"
+	"policyguardian/internal/shared/keys"
+	"policyguardian/internal/shared/tsa"
+	"policyguardian/internal/shared/warc"
+	"policyguardian/internal/shared/zipdet"
+	"policyguardian/internal/translog"
 )
 
 func TestSnapshotDeterminism(t *testing.T) {
@@ -128,6 +153,876 @@ func TestURLSnapshotTriStatePreserved(t *testing.T) {
 	}
 }
 
+func TestURLSnapshotRedirectChain(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tos", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/track?to=policy", http.StatusFound)
+	})
+	mux.HandleFunc("/track", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/policy", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/policy", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	zipBytes, snap, err := SnapshotFromURL(srv.URL+"/tos", SnapshotOptions{
+		CreatedAtUTC: "2026-01-01T00:00:00Z",
+		ToolVersion:  "policyguardian/v0.1.0-test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Schema != SchemaPolicySnapshotV02 {
+		t.Fatalf("schema=%s", snap.Schema)
+	}
+	chain := snap.Policy.Fetch.RedirectChain
+	if len(chain) != 3 {
+		t.Fatalf("expected 3 hops, got %+v", chain)
+	}
+	want := []struct {
+		path, location string
+		status         int
+	}{
+		{"/tos", "/track?to=policy", 302},
+		{"/track?to=policy", "/policy", 301},
+		{"/policy", "", 200},
+	}
+	for i, w := range want {
+		h := chain[i]
+		if h.URL != srv.URL+w.path || h.Location != w.location || h.HTTPStatus != w.status || h.ResolvedIP != "127.0.0.1" {
+			t.Fatalf("hop %d: %+v", i, h)
+		}
+	}
+	f := snap.Policy.Fetch
+	if f.RemoteAddr != srv.Listener.Addr().String() || f.ResolvedIP != "127.0.0.1" || f.HTTPProtocol != "HTTP/1.1" || f.ConnectionReused == nil {
+		t.Fatalf("connection details: remote_addr=%q resolved_ip=%q http_protocol=%q connection_reused=%v", f.RemoteAddr, f.ResolvedIP, f.HTTPProtocol, f.ConnectionReused)
+	}
+	if status, reason, err := VerifySnapshotZip(zipBytes); err != nil || status != "VALID" {
+		t.Fatalf("verify: %s %s %v", status, reason, err)
+	}
+
+	// The chain is bound into snapshot_id.
+	var root map[string]any
+	if err := json.Unmarshal(readZipEntry(t, zipBytes, "policy_snapshot.json"), &root); err != nil {
+		t.Fatal(err)
+	}
+	hop := root["policy"].(map[string]any)["fetch"].(map[string]any)["redirect_chain"].([]any)[1].(map[string]any)
+	hop["location"] = "/elsewhere"
+	tampered, _ := json.Marshal(root)
+	if status, reason, _ := VerifySnapshotZip(replaceZipEntry(t, zipBytes, "policy_snapshot.json", tampered)); status != "INVALID" || reason != "snapshot_id_mismatch" {
+		t.Fatalf("tampered hop: %s %s", status, reason)
+	}
+
+	// A v0.1 pack cannot carry a chain.
+	hop["location"] = "/policy"
+	root["schema"] = SchemaPolicySnapshot
+	downgraded, _ := json.Marshal(root)
+	if status, reason, _ := VerifySnapshotZip(replaceZipEntry(t, zipBytes, "policy_snapshot.json", downgraded)); status != "INVALID" || reason != "redirect_chain_requires_v0_2" {
+		t.Fatalf("downgraded: %s %s", status, reason)
+	}
+}
+
+func TestURLSnapshotTLSChain(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	zipBytes, snap, err := SnapshotFromURL(srv.URL, SnapshotOptions{
+		CreatedAtUTC:    "2026-01-01T00:00:00Z",
+		ToolVersion:     "policyguardian/v0.1.0-test",
+		CaptureTLSChain: true,
+		Transport:       srv.Client().Transport,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := snap.Policy.Fetch
+	if f.TLSChain == nil || f.TLSOCSPStaple != nil || f.TLSVersion == "" || f.TLSCipherSuite == "" {
+		t.Fatalf("fetch: %+v", f)
+	}
+	chain := readZipEntry(t, zipBytes, TLSChainEntry)
+	if hashing.SHA256Hex(chain) != f.TLSChain.SHA256 {
+		t.Fatalf("tls_chain sha2-256 mismatch")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	for _, tc := range []struct {
+		name   string
+		zip    []byte
+		roots  *x509.CertPool
+		status string
+		reason string
+	}{
+		{"no roots", zipBytes, nil, "VALID", ""},
+		{"trusted", zipBytes, roots, "VALID", ""},
+		{"untrusted", zipBytes, x509.NewCertPool(), "INVALID", "tls_chain_untrusted"},
+		{"tampered", replaceZipEntry(t, zipBytes, TLSChainEntry, append(chain, '\n')), nil, "INVALID", "tls_chain_hash_mismatch"},
+	} {
+		status, reason, err := VerifySnapshotZipWithOptions(tc.zip, VerifyOptions{TLSRoots: tc.roots})
+		if err != nil || status != tc.status || reason != tc.reason {
+			t.Fatalf("%s: %s %s %v", tc.name, status, reason, err)
+		}
+	}
+
+	// Roots require a chain.
+	plain, _, err := SnapshotFromURL(srv.URL, SnapshotOptions{
+		CreatedAtUTC: "2026-01-01T00:00:00Z",
+		ToolVersion:  "policyguardian/v0.1.0-test",
+		Transport:    srv.Client().Transport,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, reason, _ := VerifySnapshotZipWithOptions(plain, VerifyOptions{TLSRoots: roots}); status != "INVALID" || reason != "tls_chain_missing" {
+		t.Fatalf("without chain: %s %s", status, reason)
+	}
+}
+
+func TestURLSnapshotResponseHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Type", "text/plain")
+		h.Set("Content-Language", "en")
+		h.Add("Link", "<https://example.com/tos>; rel=canonical")
+		h.Add("Link", "<https://example.com/tos.de>; rel=alternate")
+		h.Set("X-Policy-Version", "7")
+		h.Set("Set-Cookie", "session=secret")
+		// Per-request headers of servers and CDNs.
+		now := time.Now().Format(time.RFC3339Nano)
+		h.Set("Age", now)
+		h.Set("Expires", now)
+		h.Set("X-Request-Id", now)
+		h.Set("CF-Ray", now)
+		h.Set("X-Amz-Cf-Id", now)
+		h.Set("Server-Timing", "app;dur="+now)
+		h.Set("X-Cache", now)
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	opts := SnapshotOptions{
+		CreatedAtUTC: "2026-01-01T00:00:00Z",
+		ToolVersion:  "policyguardian/v0.1.0-test",
+	}
+	zipBytes, snap, err := SnapshotFromURL(srv.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(readZipEntry(t, zipBytes, ResponseHeadersEntry))
+	want := `{"content-language":["en"],"content-length":["5"],"content-type":["text/plain"],` +
+		`"link":["<https://example.com/tos>; rel=canonical","<https://example.com/tos.de>; rel=alternate"],"x-policy-version":["7"]}`
+	if got != want {
+		t.Fatalf("response_headers.json:\n%s\nwant:\n%s", got, want)
+	}
+	if snap.Policy.Fetch.ResponseHeaders.SHA256 != hashing.SHA256Hex([]byte(got)) {
+		t.Fatalf("response_headers sha2-256 mismatch")
+	}
+
+	// Date and per-request headers are denied by default, so a repeat fetch
+	// is byte-identical.
+	again, _, err := SnapshotFromURL(srv.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(zipBytes, again) {
+		t.Fatalf("repeat URL snapshot differs")
+	}
+
+	tampered := replaceZipEntry(t, zipBytes, ResponseHeadersEntry, []byte(`{}`))
+	if status, reason, _ := VerifySnapshotZip(tampered); status != "INVALID" || reason != "response_headers_hash_mismatch" {
+		t.Fatalf("tampered: %s %s", status, reason)
+	}
+
+	opts.ResponseHeaderDenyList = []string{"X-Policy-Version"}
+	zipBytes, _, err = SnapshotFromURL(srv.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hdrs map[string][]string
+	if err := json.Unmarshal(readZipEntry(t, zipBytes, ResponseHeadersEntry), &hdrs); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hdrs["x-policy-version"]; ok || hdrs["set-cookie"] == nil || hdrs["date"] == nil {
+		t.Fatalf("custom deny-list: %v", hdrs)
+	}
+}
+
+func TestURLSnapshotWithResources(t *testing.T) {
+	pages := map[string]struct{ ct, body string }{
+		"/tos": {"text/html; charset=utf-8", `<html><head>
+<link rel="stylesheet" href="/s.css"><script src="app.js"></script>
+<!-- <img src="/commented.png"> -->
+<style>h1 { background: url('hero.png') }</style>
+</head><body><img src="https://cdn.example.net/logo.png"><img src="data:image/png;base64,AA==">
+<iframe src="/frame"></iframe><img src="/missing.png"></body></html>`},
+		"/s.css":        {"text/css", `@import "/base.css"; body { background: url(bg.png) }`},
+		"/base.css":     {"text/css", `p { background: url(/too-deep.png) }`},
+		"/bg.png":       {"image/png", "bg"},
+		"/hero.png":     {"image/png", "hero"},
+		"/app.js":       {"application/javascript", `document.write("<img src='/js.png'>")`},
+		"/frame":        {"text/html", `<img src="/frame.png">`},
+		"/frame.png":    {"image/png", "frame"},
+		"/too-deep.png": {"image/png", "deep"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", p.ct)
+		_, _ = w.Write([]byte(p.body))
+	}))
+	defer srv.Close()
+
+	opts := SnapshotOptions{
+		CreatedAtUTC:  "2026-01-01T00:00:00Z",
+		ToolVersion:   "policyguardian/v0.1.0-test",
+		WithResources: true,
+	}
+	zipBytes, snap, err := SnapshotFromURL(srv.URL+"/tos", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadResourceManifest(zipBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range m.Resources {
+		got = append(got, fmt.Sprintf("%s %s %d %s", r.Entry, r.Kind, r.HTTPStatus, strings.TrimPrefix(r.URL, srv.URL)))
+	}
+	want := []string{
+		"resources/0001 css_url 200 /hero.png",
+		"resources/0002 stylesheet 200 /s.css",
+		"resources/0003 script 200 /app.js",
+		"resources/0004 frame 200 /frame",
+		"resources/0005 image 404 /missing.png",
+		"resources/0006 stylesheet 200 /base.css",
+		"resources/0007 css_url 200 /bg.png",
+		"resources/0008 image 200 /frame.png",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("resources:\n%s", strings.Join(got, "\n"))
+	}
+	if len(m.Skipped) != 1 || m.Skipped[0].Reason != "cross_origin" || m.Skipped[0].URL != "https://cdn.example.net/logo.png" {
+		t.Fatalf("skipped: %+v", m.Skipped)
+	}
+	if r := m.Resources[6]; r.Depth != 2 || r.Parent != srv.URL+"/s.css" || r.RetrievedAtUTC != "2026-01-01T00:00:00Z" || r.SHA256 != hashing.SHA256Hex([]byte("bg")) {
+		t.Fatalf("resource metadata: %+v", r)
+	}
+	if string(readZipEntry(t, zipBytes, "resources/0008")) != "frame" {
+		t.Fatalf("resource body not stored")
+	}
+	if e := snap.Policy.Fetch.ResourceManifest; e == nil || e.SHA256 != hashing.SHA256Hex(readZipEntry(t, zipBytes, ResourceManifestEntry)) {
+		t.Fatalf("resource_manifest reference: %+v", e)
+	}
+	again, _, _ := SnapshotFromURL(srv.URL+"/tos", opts)
+	if !bytes.Equal(zipBytes, again) {
+		t.Fatalf("repeat snapshot with resources differs")
+	}
+
+	for _, tc := range []struct {
+		name   string
+		zip    []byte
+		reason string
+	}{
+		{"intact", zipBytes, ""},
+		{"tampered resource", replaceZipEntry(t, zipBytes, "resources/0003", []byte("evil()")), "resource_hash_mismatch"},
+		{"missing resource", replaceZipEntry(t, zipBytes, "resources/0001", nil), "resource_missing"},
+		{"extra resource", replaceZipEntry(t, zipBytes, "resources/0009", []byte("x")), "resource_unexpected"},
+		{"tampered manifest", replaceZipEntry(t, zipBytes, ResourceManifestEntry, []byte("{}")), "resource_manifest_hash_mismatch"},
+		{"missing manifest", replaceZipEntry(t, zipBytes, ResourceManifestEntry, nil), "resource_manifest_missing"},
+	} {
+		_, reason, err := VerifySnapshotZip(tc.zip)
+		if err != nil || reason != tc.reason {
+			t.Fatalf("%s: %s %v", tc.name, reason, err)
+		}
+	}
+
+	opts.ResourceMaxCount = 2
+	small, _, err := SnapshotFromURL(srv.URL+"/tos", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ = ReadResourceManifest(small)
+	if len(m.Resources) != 2 || m.Skipped[len(m.Skipped)-1].Reason != "budget_exceeded" {
+		t.Fatalf("budget: %+v", m)
+	}
+
+	// Non-HTML responses have no subresources.
+	plain, snap, err := SnapshotFromURL(srv.URL+"/bg.png", opts)
+	if err != nil || snap.Policy.Fetch.ResourceManifest != nil {
+		t.Fatalf("non-HTML: %+v %v", snap, err)
+	}
+	if _, err := ReadResourceManifest(plain); err == nil {
+		t.Fatalf("unexpected resource manifest")
+	}
+}
+
+func TestURLSnapshotRequestHeadersRedacted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" || r.Header.Get("X-Tenant") != "acme" || r.Header.Get("Cookie") != "sid=abc" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	cookie, err := ParseCookieFile([]byte("# Netscape HTTP Cookie File\n#HttpOnly_127.0.0.1\tFALSE\t/\tFALSE\t0\tsid\tabc\nother.example\tTRUE\t/\tFALSE\t0\tx\ty\n"), "127.0.0.1")
+	if err != nil || cookie != "sid=abc" {
+		t.Fatalf("cookie file: %q %v", cookie, err)
+	}
+	zipBytes, snap, err := SnapshotFromURL(srv.URL, SnapshotOptions{
+		CreatedAtUTC: "2026-01-01T00:00:00Z",
+		ToolVersion:  "policyguardian/v0.1.0-test",
+		RequestHeaders: []RequestHeader{
+			{Name: "X-Tenant", Value: "acme"},
+			{Name: "Authorization", Value: "Bearer s3cret"},
+			{Name: "Cookie", Value: cookie, Secret: true},
+		},
+		RedactionSaltHex: "00112233",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := snap.Policy.Fetch
+	if f.HTTPStatus != 200 {
+		t.Fatalf("server did not receive the headers: %d", f.HTTPStatus)
+	}
+	wantAuth, _ := RedactHeaderValue("00112233", "Bearer s3cret")
+	if f.RequestHeaderSalt != "00112233" || f.RequestHeaders["x-tenant"] != "acme" || f.RequestHeaders["authorization"] != wantAuth || !strings.HasPrefix(f.RequestHeaders["cookie"], "sha2-256:") {
+		t.Fatalf("request_headers: %v salt=%s", f.RequestHeaders, f.RequestHeaderSalt)
+	}
+	if sj := string(readZipEntry(t, zipBytes, "policy_snapshot.json")); strings.Contains(sj, "s3cret") || strings.Contains(sj, "sid=abc") {
+		t.Fatalf("secret leaked into policy_snapshot.json")
+	}
+	if status, reason, err := VerifySnapshotZip(zipBytes); err != nil || status != "VALID" {
+		t.Fatalf("verify: %s %s %v", status, reason, err)
+	}
+}
+
+func TestURLSnapshotRedirectDropsSecretHeaders(t *testing.T) {
+	var got http.Header
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer other.Close()
+	// The same server under another host name.
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+
+	var sameHost http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/moved", http.StatusFound)
+			return
+		}
+		sameHost = r.Header.Clone()
+		http.Redirect(w, r, otherURL+"/policy", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	_, snap, err := SnapshotFromURL(srv.URL+"/", SnapshotOptions{
+		CreatedAtUTC: "2026-01-01T00:00:00Z",
+		ToolVersion:  "policyguardian/v0.1.0-test",
+		RequestHeaders: []RequestHeader{
+			{Name: "X-Tenant", Value: "acme"},
+			{Name: "X-Api-Key", Value: "s3cret"},
+			{Name: "X-Session", Value: "from-file", Secret: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *snap.Policy.Fetch.RedirectCount != 2 || !*snap.Policy.Fetch.CrossDomainRedirect {
+		t.Fatalf("unexpected redirects: %+v", snap.Policy.Fetch)
+	}
+	if sameHost.Get("X-Api-Key") != "s3cret" || sameHost.Get("X-Session") != "from-file" {
+		t.Fatalf("same-host redirect lost the secret headers: %v", sameHost)
+	}
+	if got.Get("X-Api-Key") != "" || got.Get("X-Session") != "" || got.Get("X-Tenant") != "acme" {
+		t.Fatalf("cross-host redirect received %v", got)
+	}
+
+	// https to http on the same host name would send them in cleartext.
+	got = nil
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL+"/policy", http.StatusFound)
+	}))
+	defer tlsSrv.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsSrv.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = SnapshotFromURL(tlsSrv.URL+"/", SnapshotOptions{
+		CreatedAtUTC: "2026-01-01T00:00:00Z",
+		ToolVersion:  "policyguardian/v0.1.0-test",
+		CABundleFile: caFile,
+		RequestHeaders: []RequestHeader{
+			{Name: "X-Tenant", Value: "acme"},
+			{Name: "Authorization", Value: "Bearer s3cret"},
+			{Name: "X-Session", Value: "from-file", Secret: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("Authorization") != "" || got.Get("X-Session") != "" || got.Get("X-Tenant") != "acme" {
+		t.Fatalf("https to http redirect received %v", got)
+	}
+}
+
+func TestURLSnapshotResourcesAfterRedirectDropSecretHeaders(t *testing.T) {
+	auth := map[string]string{}
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth[r.URL.Path] = r.Header.Get("Authorization") + "|" + r.Header.Get("X-Tenant")
+		if r.URL.Path == "/page" {
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<link rel="stylesheet" href="/s.css">`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/css")
+		_, _ = w.Write([]byte("p {}"))
+	}))
+	defer other.Close()
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, otherURL+"/page", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	zipBytes, _, err := SnapshotFromURL(srv.URL+"/", SnapshotOptions{
+		CreatedAtUTC:  "2026-01-01T00:00:00Z",
+		ToolVersion:   "policyguardian/v0.1.0-test",
+		WithResources: true,
+		RequestHeaders: []RequestHeader{
+			{Name: "Authorization", Value: "Bearer s3cret"},
+			{Name: "X-Tenant", Value: "acme"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, err := ReadResourceManifest(zipBytes); err != nil || len(m.Resources) != 1 {
+		t.Fatalf("unexpected resource manifest %+v %v", m, err)
+	}
+	if auth["/page"] != "|acme" || auth["/s.css"] != "|acme" {
+		t.Fatalf("redirected host received %v", auth)
+	}
+}
+
+func TestURLSnapshotTransportOptions(t *testing.T) {
+	dir := t.TempDir()
+
+	// Client certificate, trusted by the server as its own CA.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "policyguardian client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	certFile, keyFile, caFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key"), filepath.Join(dir, "ca.pem")
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	defer srv.Close()
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	_ = os.WriteFile(caFile, caPEM, 0600)
+
+	opts := SnapshotOptions{
+		CreatedAtUTC:  "2026-01-01T00:00:00Z",
+		ToolVersion:   "policyguardian/v0.1.0-test",
+		CABundleFile:  caFile,
+		TLSMinVersion: tls.VersionTLS13,
+		Timeout:       5 * time.Second,
+	}
+	if _, _, err := SnapshotFromURL(srv.URL, opts); err == nil {
+		t.Fatalf("expected failure without a client certificate")
+	}
+	opts.ClientCertFile, opts.ClientKeyFile = certFile, keyFile
+	zipBytes, snap, err := SnapshotFromURL(srv.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := FetchTransport{
+		TimeoutMS:        5000,
+		TLSMinVersion:    "TLS1.3",
+		CABundleSHA256:   hashing.SHA256Hex(caPEM),
+		ClientCertSHA256: hashing.SHA256Hex(der),
+	}
+	if got := snap.Policy.Fetch.Transport; got == nil || *got != want {
+		t.Fatalf("transport: %+v", got)
+	}
+	if snap.Policy.Fetch.TLSVersion != "TLS1.3" {
+		t.Fatalf("tls_version=%s", snap.Policy.Fetch.TLSVersion)
+	}
+	if status, reason, err := VerifySnapshotZip(zipBytes); err != nil || status != "VALID" {
+		t.Fatalf("verify: %s %s %v", status, reason, err)
+	}
+
+	// Plain HTTP through a forward proxy; credentials are not recorded.
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		if r.URL.Path == "/s.css" {
+			w.Header().Set("Content-Type", "text/css")
+			_, _ = w.Write([]byte("p {}"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<link rel="stylesheet" href="/s.css">via proxy`))
+	}))
+	defer proxy.Close()
+	zipBytes, snap, err = SnapshotFromURL("http://policy.example/tos", SnapshotOptions{
+		CreatedAtUTC:  "2026-01-01T00:00:00Z",
+		ToolVersion:   "policyguardian/v0.1.0-test",
+		ProxyURL:      "http://user:pw@" + strings.TrimPrefix(proxy.URL, "http://"),
+		WithResources: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(proxied, " ") != "http://policy.example/tos http://policy.example/s.css" || snap.Policy.Fetch.Transport.Proxy != proxy.URL {
+		t.Fatalf("proxy: got requests %q, recorded %q", proxied, snap.Policy.Fetch.Transport.Proxy)
+	}
+	// The connection was to the proxy, not to policy.example.
+	if f := snap.Policy.Fetch; f.RemoteAddr != "" || f.ResolvedIP != "" || f.ConnectionReused != nil || f.RedirectChain[0].ResolvedIP != "" {
+		t.Fatalf("proxy address recorded as the origin: %s %s %+v", f.RemoteAddr, f.ResolvedIP, f.RedirectChain)
+	}
+	m, err := ReadResourceManifest(zipBytes)
+	if err != nil || len(m.Resources) != 1 || m.Resources[0].ResolvedIP != "" {
+		t.Fatalf("proxy address recorded for a resource: %+v %v", m, err)
+	}
+}
+
+func TestWARCRoundTrip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"v3"`)
+		_, _ = w.Write([]byte("<p>terms</p>"))
+	}))
+	defer srv.Close()
+	opts := SnapshotOptions{CreatedAtUTC: "2026-01-01T00:00:00Z", ToolVersion: "policyguardian/v0.1.0-test"}
+	urlPack, urlSnap, err := SnapshotFromURL(srv.URL+"/tos", SnapshotOptions{
+		CreatedAtUTC:   "2026-01-01T00:00:00Z",
+		RetrievedAtUTC: "2025-12-31T23:59:58Z",
+		ToolVersion:    "policyguardian/v0.1.0-test",
+		RequestHeaders: []RequestHeader{{Name: "Authorization", Value: "Bearer s3cret"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filePack, fileSnap, err := SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := ExportWARC([][]byte{urlPack, filePack}, "policies.warc", "policyguardian/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, r := range recs {
+		types = append(types, r.Type())
+	}
+	if strings.Join(types, ",") != "warcinfo,request,response,metadata,resource,metadata" {
+		t.Fatalf("record types: %v", types)
+	}
+	if recs[2].Get(WARCSnapshotIDField) != urlSnap.SnapshotID || recs[5].Get(WARCSnapshotIDField) != fileSnap.SnapshotID {
+		t.Fatalf("snapshot_id fields missing")
+	}
+	if bytes.Contains(recs[1].Block, []byte("s3cret")) || bytes.Contains(recs[1].Block, []byte("Authorization")) {
+		t.Fatalf("request record leaks credentials: %s", recs[1].Block)
+	}
+	var plain, gz bytes.Buffer
+	if err := warc.Write(&plain, recs, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := warc.Write(&gz, recs, true); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := ExportWARC([][]byte{urlPack, filePack}, "policies.warc", "policyguardian/test")
+	var plain2 bytes.Buffer
+	_ = warc.Write(&plain2, again, false)
+	if !bytes.Equal(plain.Bytes(), plain2.Bytes()) {
+		t.Fatalf("WARC export is not deterministic")
+	}
+
+	for _, data := range [][]byte{plain.Bytes(), gz.Bytes()} {
+		imported, err := ImportWARC(data, "/archive/policies.warc", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(imported) != 1 {
+			t.Fatalf("imported %d packs", len(imported))
+		}
+		snap := imported[0].Snapshot
+		w := snap.Policy.Input.WARC
+		if snap.Policy.Input.Mode != "warc" || w.TargetURI != srv.URL+"/tos" || w.Date != "2025-12-31T23:59:58Z" ||
+			w.File != "policies.warc" || w.SnapshotID != urlSnap.SnapshotID || w.RecordID != recs[2].Get("WARC-Record-ID") {
+			t.Fatalf("provenance: %+v", w)
+		}
+		f := snap.Policy.Fetch
+		if snap.Policy.Bytes.Hashes["sha2-256"] != urlSnap.Policy.Bytes.Hashes["sha2-256"] || f.RetrievedAtUTC != "2025-12-31T23:59:58Z" ||
+			f.ETag != `"v3"` || f.HTTPStatus != 200 || f.ResponseHeaders.SHA256 != urlSnap.Policy.Fetch.ResponseHeaders.SHA256 {
+			t.Fatalf("fetch: %+v", f)
+		}
+		if status, reason, err := VerifySnapshotZip(imported[0].Zip); err != nil || status != "VALID" {
+			t.Fatalf("verify imported: %s %s %v", status, reason, err)
+		}
+	}
+
+	// Records from other archivers: chunked body, fractional WARC-Date, no
+	// digests and no PolicyLock fields.
+	block := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n"
+	foreign := "WARC/1.0\r\nWARC-Type: response\r\nWARC-Record-ID: <urn:uuid:0001>\r\n" +
+		"WARC-Date: 2024-05-06T07:08:09.123Z\r\nWARC-Target-URI: <https://example.com/privacy>\r\n" +
+		"WARC-IP-Address: 192.0.2.7\r\nContent-Type: application/http; msgtype=response\r\n" +
+		fmt.Sprintf("Content-Length: %d\r\n\r\n", len(block)) + block + "\r\n\r\n"
+	imported, err := ImportWARC([]byte(foreign), "other.warc", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := imported[0].Snapshot.Policy.Fetch; f.FinalURL != "https://example.com/privacy" || f.RetrievedAtUTC != "2024-05-06T07:08:09Z" ||
+		f.ResolvedIP != "192.0.2.7" || imported[0].Snapshot.Policy.Bytes.Hashes["sha2-256"] != hashing.SHA256Hex([]byte("hello world")) {
+		t.Fatalf("foreign import: %+v", f)
+	}
+
+	// A tampered response block is rejected on import.
+	bad := bytes.Replace(plain.Bytes(), []byte("<p>terms</p>"), []byte("<p>TERMS</p>"), 1)
+	if _, err := ImportWARC(bad, "bad.warc", opts); err == nil || !strings.Contains(err.Error(), "block digest mismatch") {
+		t.Fatalf("expected block digest mismatch, got %v", err)
+	}
+	// Invalid packs are not exported.
+	if _, err := ExportWARC([][]byte{replaceZipEntry(t, filePack, "policy_body.bin", []byte("x"))}, "x.warc", "t"); err == nil {
+		t.Fatalf("expected error exporting an invalid pack")
+	}
+}
+
+func TestBundleSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "tos.txt"), []byte("terms"), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "privacy.txt"), []byte("privacy"), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "cookies.txt"), []byte("cookies"), 0644)
+	manifestPath := filepath.Join(dir, "bundle.json")
+	_ = os.WriteFile(manifestPath, []byte(`{"documents": [
+		{"name": "tos", "role": "terms_of_service", "path": "tos.txt"},
+		{"name": "privacy", "role": "privacy_policy", "path": "privacy.txt"},
+		{"path": "cookies.txt"}
+	]}`), 0644)
+
+	docs, err := LoadBundleManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := SnapshotOptions{CreatedAtUTC: "2026-01-01T00:00:00Z", ToolVersion: "policyguardian/v0.1.0-test"}
+	zipBytes, snap, err := SnapshotBundle(docs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _, _ := SnapshotBundle(docs, opts)
+	if !bytes.Equal(zipBytes, again) {
+		t.Fatalf("bundle snapshot is not deterministic")
+	}
+	if snap.Schema != SchemaPolicySnapshotV02 || snap.Policy.Bundle == nil || snap.Policy.Bundle.DocumentCount != 3 {
+		t.Fatalf("snapshot: %+v", snap.Policy)
+	}
+	leaves := [][]byte{translog.LeafHash([]byte("terms")), translog.LeafHash([]byte("privacy")), translog.LeafHash([]byte("cookies"))}
+	if snap.Policy.Bundle.MerkleRoot != hex.EncodeToString(translog.RootHash(leaves)) {
+		t.Fatalf("merkle_root mismatch")
+	}
+	m, err := ReadBundleManifest(zipBytes)
+	if err != nil || m.Documents[2].Name != "cookies.txt" || m.Documents[0].Role != "terms_of_service" {
+		t.Fatalf("manifest: %+v %v", m, err)
+	}
+	if _, bodyHash, err := ReadSnapshotInfo(zipBytes); err != nil || bodyHash != snap.Policy.Bytes.Hashes["sha2-256"] {
+		t.Fatalf("ReadSnapshotInfo: %s %v", bodyHash, err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		zip    []byte
+		status string
+		reason string
+	}{
+		{"intact", zipBytes, "VALID", ""},
+		{"tampered body", replaceZipEntry(t, zipBytes, "bodies/privacy", []byte("PRIVACY")), "INVALID", "bundle_document_hash_mismatch"},
+		{"missing body", replaceZipEntry(t, zipBytes, "bodies/tos", nil), "INVALID", "bundle_document_missing"},
+		{"extra body", replaceZipEntry(t, zipBytes, "bodies/dpa", []byte("annex")), "INVALID", "bundle_unexpected_document"},
+		{"tampered manifest", replaceZipEntry(t, zipBytes, BundleManifestEntry, []byte("{}")), "INVALID", "policy_body_hash_mismatch"},
+	} {
+		status, reason, err := VerifySnapshotZip(tc.zip)
+		if err != nil || status != tc.status || reason != tc.reason {
+			t.Fatalf("%s: %s %s %v", tc.name, status, reason, err)
+		}
+	}
+
+	if _, _, err := SnapshotBundle([]BundleInput{{Name: "a", Bytes: []byte("1")}, {Name: "a", Bytes: []byte("2")}}, opts); err == nil {
+		t.Fatalf("expected duplicate name error")
+	}
+	if _, _, err := SnapshotBundle([]BundleInput{{Name: "../x", Bytes: []byte("1")}}, opts); err == nil {
+		t.Fatalf("expected invalid name error")
+	}
+}
+
+func TestDirSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(dir, "legal", "eu"), 0755)
+	_ = os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	_ = os.WriteFile(filepath.Join(dir, "tos.md"), []byte("terms"), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "legal", "privacy.md"), []byte("privacy"), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "legal", "eu", "dpa.md"), []byte("dpa"), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "legal", "draft.md"), []byte("draft"), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644)
+	_ = os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref"), 0644)
+
+	opts := SnapshotOptions{CreatedAtUTC: "2026-01-01T00:00:00Z", ToolVersion: "policyguardian/v0.1.0-test"}
+	zipBytes, snap, err := SnapshotFromDir(dir, []string{"*.md"}, []string{"legal/draft.md"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _, _ := SnapshotFromDir(dir, []string{"*.md"}, []string{"legal/draft.md"}, opts)
+	if !bytes.Equal(zipBytes, again) {
+		t.Fatalf("dir snapshot is not deterministic")
+	}
+	if snap.Policy.Input.Mode != "dir" || snap.Policy.Input.Path != dir || snap.Policy.Bundle.DocumentCount != 3 {
+		t.Fatalf("snapshot: %+v", snap.Policy)
+	}
+	m, _ := ReadBundleManifest(zipBytes)
+	var names []string
+	for _, d := range m.Documents {
+		names = append(names, d.Name)
+	}
+	if strings.Join(names, ",") != "legal/eu/dpa.md,legal/privacy.md,tos.md" {
+		t.Fatalf("documents: %v", names)
+	}
+	if status, reason, err := VerifySnapshotZip(zipBytes); err != nil || status != "VALID" {
+		t.Fatalf("verify: %s %s %v", status, reason, err)
+	}
+	tampered := replaceZipEntry(t, zipBytes, "bodies/legal/eu/dpa.md", []byte("DPA"))
+	if _, reason, _ := VerifySnapshotZip(tampered); reason != "bundle_document_hash_mismatch" {
+		t.Fatalf("tampered: %s", reason)
+	}
+	if _, _, err := SnapshotFromDir(dir, []string{"*.pdf"}, nil, opts); err == nil {
+		t.Fatalf("expected error for empty selection")
+	}
+
+	// Policy repositories name files for people, not for URLs.
+	_ = os.MkdirAll(filepath.Join(dir, "légal"), 0755)
+	_ = os.WriteFile(filepath.Join(dir, "Terms of Service.md"), []byte("tos"), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "légal", "confidentialité.md"), []byte("vie privée"), 0644)
+	zipBytes, _, err = SnapshotFromDir(dir, []string{"Terms of Service.md", "légal/*"}, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ = ReadBundleManifest(zipBytes)
+	if len(m.Documents) != 2 || m.Documents[0].Name != "Terms of Service.md" || m.Documents[1].Name != "légal/confidentialité.md" {
+		t.Fatalf("documents: %+v", m.Documents)
+	}
+	if status, reason, err := VerifySnapshotZip(zipBytes); err != nil || status != "VALID" {
+		t.Fatalf("verify: %s %s %v", status, reason, err)
+	}
+	for _, name := range []string{"", "../tos.md", "a/./b", "a//b", "/tos.md", "a\\b", "a\x00b", "a\nb", "\xff.md"} {
+		if validBundleName(name) {
+			t.Fatalf("accepted bundle name %q", name)
+		}
+	}
+}
+
+func TestGitSnapshot(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	run := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Ann Author", "GIT_AUTHOR_EMAIL=ann@example.com", "GIT_AUTHOR_DATE=2026-01-02T03:04:05Z",
+			"GIT_COMMITTER_NAME=Carl Committer", "GIT_COMMITTER_EMAIL=carl@example.com", "GIT_COMMITTER_DATE=2026-01-03T04:05:06Z",
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	run("init", "-q")
+	_ = os.MkdirAll(filepath.Join(repo, "legal"), 0755)
+	_ = os.WriteFile(filepath.Join(repo, "legal", "tos.md"), []byte("terms v1"), 0644)
+	_ = os.WriteFile(filepath.Join(repo, "README"), []byte("readme"), 0644)
+	run("add", ".")
+	run("commit", "-q", "-m", "v1")
+	first := run("rev-parse", "HEAD")
+	_ = os.WriteFile(filepath.Join(repo, "legal", "tos.md"), []byte("terms v2"), 0644)
+	run("commit", "-q", "-am", "v2")
+	// Uncommitted changes are not part of the snapshot.
+	_ = os.WriteFile(filepath.Join(repo, "legal", "tos.md"), []byte("dirty"), 0644)
+
+	opts := SnapshotOptions{CreatedAtUTC: "2026-01-01T00:00:00Z", ToolVersion: "policyguardian/v0.1.0-test"}
+	zipBytes, snap, err := SnapshotFromGit(repo, first, []string{"legal/*"}, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := snap.Policy.Input.Git
+	if snap.Policy.Input.Mode != "git" || g == nil || g.Commit != first || g.Tree != run("rev-parse", first+"^{tree}") {
+		t.Fatalf("input: %+v %+v", snap.Policy.Input, g)
+	}
+	if g.Author != "Ann Author <ann@example.com>" || g.Committer != "Carl Committer <carl@example.com>" || g.CommitTimeUTC != "2026-01-03T04:05:06Z" {
+		t.Fatalf("provenance: %+v", g)
+	}
+	m, _ := ReadBundleManifest(zipBytes)
+	body, _ := readPackEntry(zipBytes, "bodies/legal/tos.md")
+	if len(m.Documents) != 1 || string(body) != "terms v1" {
+		t.Fatalf("documents: %+v %q", m.Documents, body)
+	}
+	if status, reason, err := VerifySnapshotZip(zipBytes); err != nil || status != "VALID" {
+		t.Fatalf("verify: %s %s %v", status, reason, err)
+	}
+	sp, _ := BuildSignPayload(*snap)
+	payload, _ := jcs.CanonicalizeValue(sp)
+	if !bytes.Contains(payload, []byte(`"commit":"`+first+`"`)) {
+		t.Fatalf("commit not in sign payload: %s", payload)
+	}
+
+	_ = os.WriteFile(filepath.Join(repo, "legal", "Terms of Service.md"), []byte("terms"), 0644)
+	run("add", ".")
+	run("commit", "-q", "-m", "spaces")
+	_, head, err := SnapshotFromGit(repo, "HEAD", nil, nil, opts)
+	if err != nil || head.Policy.Bundle.DocumentCount != 3 || head.Policy.Input.Git.Commit == first {
+		t.Fatalf("HEAD: %+v %v", head, err)
+	}
+	if _, _, err := SnapshotFromGit("https://example.com/r.git", "HEAD", nil, nil, opts); err == nil {
+		t.Fatalf("expected error for remote repository")
+	}
+	if _, _, err := SnapshotFromGit(repo, "no-such-rev", nil, nil, opts); err == nil {
+		t.Fatalf("expected error for unknown revision")
+	}
+}
+
 func TestModeInvariants(t *testing.T) {
 	// mode=file forbids URL and fetch
 	_, _, err := buildSnapshot([]byte("x"), PolicyInput{Mode: "file", Path: "a.txt", URL: "http://x"}, &PolicyFetch{}, SnapshotOptions{
@@ -138,6 +1033,13 @@ func TestModeInvariants(t *testing.T) {
 	if err == nil {
 		t.Fatalf("expected error for invalid invariants")
 	}
+	// git provenance only belongs to mode=git
+	if err := validateModeInvariants(PolicyInput{Mode: "file", Path: "a.txt", Git: &GitSource{}}, nil); err == nil {
+		t.Fatalf("expected error for git provenance on mode=file")
+	}
+	if err := validateModeInvariants(PolicyInput{Mode: "git"}, nil); err == nil {
+		t.Fatalf("expected error for mode=git without provenance")
+	}
 }
 
 func TestSnapshotIDMatchesSigningPayloadHash(t *testing.T) {
@@ -162,3 +1064,476 @@ func TestSnapshotIDMatchesSigningPayloadHash(t *testing.T) {
 		t.Fatalf("snapshot_id mismatch\nexp=%s\ngot=%s", exp, snap.SnapshotID)
 	}
 }
+
+func TestSignedSnapshotVerifies(t *testing.T) {
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+	opts := SnapshotOptions{
+		CreatedAtUTC:   "2026-01-01T00:00:00Z",
+		ToolVersion:    "policyguardian/v0.1.0-test",
+		UserAgent:      "policyguardian/v0.1.0-test",
+		SignPrivKeyHex: hex.EncodeToString(priv),
+	}
+	zipBytes, snap, err := SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Signing == nil || snap.Signing.PublicKey != hex.EncodeToString(priv.Public().(ed25519.PublicKey)) {
+		t.Fatalf("expected signer public key in snapshot")
+	}
+	if id, _ := keys.KeyID(priv.Public()); snap.Signing.KeyID != id {
+		t.Fatalf("expected key_id %s, got %q", id, snap.Signing.KeyID)
+	}
+	st, reason, err := VerifySnapshotZip(zipBytes)
+	if err != nil || st != "VALID" {
+		t.Fatalf("expected VALID, got %s %s %v", st, reason, err)
+	}
+
+	// Signing must not change snapshot_id.
+	opts.SignPrivKeyHex = ""
+	_, unsigned, err := SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unsigned.SnapshotID != snap.SnapshotID {
+		t.Fatalf("snapshot_id changed by signing")
+	}
+
+	// A pack whose envelope was produced by another key must fail.
+	other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{9}, ed25519.SeedSize))
+	opts.SignPrivKeyHex = hex.EncodeToString(other)
+	otherZip, _, err := SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapped := replaceZipEntry(t, zipBytes, SignatureEnvelopeEntry, readZipEntry(t, otherZip, SignatureEnvelopeEntry))
+	st, reason, _ = VerifySnapshotZip(swapped)
+	if st != "INVALID" || reason != "signer_public_key_mismatch" {
+		t.Fatalf("expected INVALID signer_public_key_mismatch, got %s %s", st, reason)
+	}
+
+	// The same key from a key file gives the same envelope.
+	pemKey, err := keys.Marshal(priv, keys.FormatOpenSSH, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "key")
+	if err := keys.WriteFile(keyPath, pemKey); err != nil {
+		t.Fatal(err)
+	}
+	opts.SignPrivKeyHex, opts.SignKeyFile = "", keyPath
+	fileZip, _, err := SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readZipEntry(t, fileZip, SignatureEnvelopeEntry), readZipEntry(t, zipBytes, SignatureEnvelopeEntry)) {
+		t.Fatalf("key file signature differs from hex key signature")
+	}
+}
+
+func TestSnapshotSignatureAlgorithms(t *testing.T) {
+	for _, alg := range []string{keys.AlgECDSAP256, keys.AlgRSAPSS} {
+		var key crypto.Signer
+		var err error
+		if alg == keys.AlgRSAPSS {
+			key, err = rsa.GenerateKey(rand.Reader, 2048)
+		} else {
+			key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := SnapshotOptions{
+			CreatedAtUTC: "2026-01-01T00:00:00Z",
+			ToolVersion:  "policyguardian/v0.1.0-test",
+			UserAgent:    "policyguardian/v0.1.0-test",
+			Signer:       key,
+		}
+		zipBytes, snap, err := SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snap.Signing.Mode != alg || snap.Signing.Algorithm != alg {
+			t.Fatalf("%s: signing %+v", alg, snap.Signing)
+		}
+		if st, reason, err := VerifySnapshotZip(zipBytes); err != nil || st != "VALID" {
+			t.Fatalf("%s: expected VALID, got %s %s %v", alg, st, reason, err)
+		}
+
+		// The envelope's algorithm must agree with signing.mode.
+		var env map[string]any
+		if err := json.Unmarshal(readZipEntry(t, zipBytes, SignatureEnvelopeEntry), &env); err != nil {
+			t.Fatal(err)
+		}
+		env["algorithm"] = keys.AlgEd25519
+		raw, _ := json.Marshal(env)
+		st, reason, _ := VerifySnapshotZip(replaceZipEntry(t, zipBytes, SignatureEnvelopeEntry, raw))
+		if st != "INVALID" || reason != "invalid_public_key" {
+			t.Fatalf("%s: expected INVALID invalid_public_key, got %s %s", alg, st, reason)
+		}
+	}
+}
+
+func TestTimestampedSnapshotVerifies(t *testing.T) {
+	srv, err := tsa.LoadOrCreate(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+
+	opts := SnapshotOptions{
+		CreatedAtUTC: "2026-01-01T00:00:00Z",
+		ToolVersion:  "policyguardian/v0.1.0-test",
+		UserAgent:    "policyguardian/v0.1.0-test",
+		TSAURL:       hs.URL,
+	}
+	zipBytes, snap, err := SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Timestamp == nil || snap.Timestamp.GenTimeUTC == "" {
+		t.Fatalf("expected timestamp metadata")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Cert)
+	st, reason, err := VerifySnapshotZipWithOptions(zipBytes, VerifyOptions{TSARoots: roots})
+	if err != nil || st != "VALID" {
+		t.Fatalf("expected VALID, got %s %s %v", st, reason, err)
+	}
+
+	// Timestamping must not change snapshot_id.
+	opts.TSAURL = ""
+	plain, unstamped, err := SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unstamped.SnapshotID != snap.SnapshotID {
+		t.Fatalf("snapshot_id changed by timestamping")
+	}
+	if st, reason, _ := VerifySnapshotZipWithOptions(plain, VerifyOptions{TSARoots: roots}); st != "INVALID" || reason != "timestamp_missing" {
+		t.Fatalf("expected INVALID timestamp_missing, got %s %s", st, reason)
+	}
+
+	other, err := tsa.LoadOrCreate(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong := x509.NewCertPool()
+	wrong.AddCert(other.Cert)
+	if st, reason, _ := VerifySnapshotZipWithOptions(zipBytes, VerifyOptions{TSARoots: wrong}); st != "INVALID" || reason != "timestamp_chain_invalid" {
+		t.Fatalf("expected INVALID timestamp_chain_invalid, got %s %s", st, reason)
+	}
+
+	// A token over a different payload must not be accepted.
+	opts.CreatedAtUTC = "2026-01-02T00:00:00Z"
+	opts.TSAURL = hs.URL
+	otherZip, _, err := SnapshotFromFile("../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapped := replaceZipEntry(t, zipBytes, TimestampTokenEntry, readZipEntry(t, otherZip, TimestampTokenEntry))
+	if st, reason, _ := VerifySnapshotZip(swapped); st != "INVALID" || reason != "timestamp_imprint_mismatch" {
+		t.Fatalf("expected INVALID timestamp_imprint_mismatch, got %s %s", st, reason)
+	}
+}
+
+func readZipEntry(t *testing.T, zipBytes []byte, name string) []byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if f.Name == name {
+			rc, _ := f.Open()
+			b := new(bytes.Buffer)
+			_, _ = b.ReadFrom(rc)
+			_ = rc.Close()
+			return b.Bytes()
+		}
+	}
+	t.Fatalf("%s missing", name)
+	return nil
+}
+
+// replaceZipEntry rewrites the pack with entry name set to data: a nil data
+// removes the entry, and a new name is appended.
+func replaceZipEntry(t *testing.T, zipBytes []byte, name string, data []byte) []byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []zipdet.Entry
+	found := false
+	for _, f := range zr.File {
+		d := readZipEntry(t, zipBytes, f.Name)
+		if f.Name == name {
+			found = true
+			if data == nil {
+				continue
+			}
+			d = data
+		}
+		entries = append(entries, zipdet.Entry{Name: f.Name, Data: d})
+	}
+	if !found && data != nil {
+		entries = append(entries, zipdet.Entry{Name: name, Data: data})
+	}
+	out, err := zipdet.WriteDeterministicZip(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	opts := SnapshotOptions{
+		CreatedAtUTC: "2026-01-01T00:00:00Z",
+		ToolVersion:  "policyguardian/v0.1.0-test",
+		UserAgent:    "policyguardian/v0.1.0-test",
+	}
+	a, _, err := SnapshotFromStdin(strings.NewReader("one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.CreatedAtUTC = "2026-02-01T00:00:00Z"
+	b, _, err := SnapshotFromStdin(strings.NewReader("one\nTWO\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := DiffSnapshots(a, b, "a.zip", "b.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Identical() || d.BodyIdentical {
+		t.Fatalf("expected differences")
+	}
+	foundCreated := false
+	for _, m := range d.Metadata {
+		if m.Field == "created_at_utc" && m.A == "2026-01-01T00:00:00Z" && m.B == "2026-02-01T00:00:00Z" {
+			foundCreated = true
+		}
+	}
+	if !foundCreated {
+		t.Fatalf("expected created_at_utc difference, got %+v", d.Metadata)
+	}
+	want := "--- a.zip\n+++ b.zip\n" +
+		"@@ -1,5 +1,5 @@\n one\n-two\n+TWO\n three\n four\n five\n" +
+		"@@ -8,3 +8,4 @@\n eight\n nine\n ten\n+eleven\n"
+	if d.BodyDiff != want {
+		t.Fatalf("unexpected diff:\n%s", d.BodyDiff)
+	}
+
+	same, err := DiffSnapshots(a, a, "a.zip", "a.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !same.Identical() || same.BodyDiff != "" {
+		t.Fatalf("expected identical snapshots")
+	}
+}
+
+// checkEdits verifies that edits turn a into b with want insertions and
+// deletions.
+func checkEdits(t *testing.T, a, b []string, edits []lineEdit, want int) {
+	t.Helper()
+	var gotA, gotB []string
+	cost := 0
+	for _, e := range edits {
+		if e.op != '+' {
+			gotA = append(gotA, e.line)
+		}
+		if e.op != '-' {
+			gotB = append(gotB, e.line)
+		}
+		if e.op != ' ' {
+			cost++
+		}
+	}
+	if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+		t.Fatalf("edit script does not reproduce the inputs")
+	}
+	if cost != want {
+		t.Fatalf("edit script costs %d, want %d", cost, want)
+	}
+}
+
+func TestDiffLinesMinimal(t *testing.T) {
+	rng := mrand.New(mrand.NewSource(1))
+	gen := func() []string {
+		out := make([]string, rng.Intn(12))
+		for i := range out {
+			out[i] = string(rune('a'+rng.Intn(4))) + "\n"
+		}
+		return out
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := gen(), gen()
+		// Edit distance = len(a) + len(b) - 2*LCS.
+		lcs := make([][]int, len(a)+1)
+		for x := range lcs {
+			lcs[x] = make([]int, len(b)+1)
+		}
+		for x := len(a) - 1; x >= 0; x-- {
+			for y := len(b) - 1; y >= 0; y-- {
+				switch {
+				case a[x] == b[y]:
+					lcs[x][y] = lcs[x+1][y+1] + 1
+				case lcs[x+1][y] > lcs[x][y+1]:
+					lcs[x][y] = lcs[x+1][y]
+				default:
+					lcs[x][y] = lcs[x][y+1]
+				}
+			}
+		}
+		checkEdits(t, a, b, diffLines(a, b), len(a)+len(b)-2*lcs[0][0])
+	}
+}
+
+func TestDiffLinesLarge(t *testing.T) {
+	const n = 20000
+	a := make([]string, n)
+	rewritten := make([]string, n)
+	edited := make([]string, n)
+	for i := range a {
+		a[i] = fmt.Sprintf("<p>clause %d</p>\n", i)
+		rewritten[i] = fmt.Sprintf("<p>section %d</p>\n", i)
+		edited[i] = a[i]
+		if i%50 == 0 {
+			edited[i] = fmt.Sprintf("<p>clause %d (amended)</p>\n", i)
+		}
+	}
+	// Mostly rewritten: a few shared lines keep the plain-replacement
+	// shortcut from applying, so the full O(ND) search runs.
+	const nm = n / 4
+	mixed := append([]string(nil), rewritten[:nm]...)
+	for i := 0; i < nm; i += 500 {
+		mixed[i] = a[i]
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	checkEdits(t, a, rewritten, diffLines(a, rewritten), 2*n)
+	checkEdits(t, a, edited, diffLines(a, edited), 2*(n/50))
+	checkEdits(t, a[:nm], mixed, diffLines(a[:nm], mixed), 2*(nm-nm/500))
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 256<<20 {
+		t.Fatalf("diff of %d lines allocated %d MB", n, alloc>>20)
+	}
+}
+
+func TestWatchOnceSnapshotsOnlyOnChange(t *testing.T) {
+	body := "v1"
+	etag := `"v1"`
+	honorConditional := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if honorConditional && r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	store := t.TempDir()
+	opts := WatchOptions{
+		StoreDir: store,
+		Snapshot: SnapshotOptions{
+			CreatedAtUTC: "2026-01-01T00:00:00Z",
+			ToolVersion:  "policyguardian/v0.1.0-test",
+			UserAgent:    "policyguardian/v0.1.0-test",
+		},
+	}
+	pass := func(want string) WatchResult {
+		t.Helper()
+		res, err := WatchOnce([]string{srv.URL}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 1 || res[0].Status != want {
+			t.Fatalf("expected %s, got %+v", want, res)
+		}
+		return res[0]
+	}
+
+	first := pass("new")
+	pass("not_modified")
+
+	body, etag = "v2", `"v2"`
+	opts.Snapshot.CreatedAtUTC = "2026-01-02T00:00:00Z"
+	second := pass("changed")
+	if second.PreviousSnapshotID != first.SnapshotID || second.SnapshotID == first.SnapshotID {
+		t.Fatalf("unexpected ids: %+v", second)
+	}
+
+	// A server that ignores conditional headers must not produce a new pack
+	// for identical bytes.
+	honorConditional = false
+	opts.Snapshot.CreatedAtUTC = "2026-01-03T00:00:00Z"
+	third := pass("unchanged")
+	if third.SnapshotID != second.SnapshotID {
+		t.Fatalf("expected latest snapshot to be kept, got %+v", third)
+	}
+
+	packs, err := os.ReadDir(filepath.Join(store, "snapshots"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packs) != 2 {
+		t.Fatalf("expected 2 packs in store, got %d", len(packs))
+	}
+	log, err := os.ReadFile(filepath.Join(store, "watch", "changes.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(log), "\n"); n != 2 {
+		t.Fatalf("expected 2 change log entries, got %d", n)
+	}
+}
+
+func TestWatchOnceStateSurvivesFailedPass(t *testing.T) {
+	store := t.TempDir()
+	changes := filepath.Join(store, "watch", "changes.jsonl")
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(1100 * time.Millisecond)
+		_, _ = w.Write([]byte("slow"))
+	}))
+	defer slow.Close()
+	breakLog := true
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if breakLog {
+			// Appending to the change log fails for this URL.
+			os.Remove(changes)
+			os.Mkdir(changes, 0755)
+		}
+		_, _ = w.Write([]byte("other"))
+	}))
+	defer other.Close()
+	opts := WatchOptions{StoreDir: store, Snapshot: SnapshotOptions{ToolVersion: "policyguardian/v0.1.0-test"}}
+
+	res, err := WatchOnce([]string{slow.URL, other.URL}, opts)
+	if err == nil || len(res) != 1 || res[0].Status != "new" {
+		t.Fatalf("expected a failed pass after the first URL, got %+v %v", res, err)
+	}
+	first := res[0]
+	fi, err := os.Stat(filepath.Join(store, "watch", "state.json"))
+	if err != nil || fi.Mode().Perm() != 0644 {
+		t.Fatalf("state.json: %v %v", fi, err)
+	}
+
+	breakLog = false
+	os.Remove(changes)
+	res, err = WatchOnce([]string{slow.URL, other.URL}, opts)
+	if err != nil || len(res) != 2 || res[0].Status != "unchanged" || res[1].Status != "new" {
+		t.Fatalf("unexpected second pass: %+v %v", res, err)
+	}
+	// Without a pinned time each URL is stamped when its fetch starts.
+	if res[0].CheckedAtUTC == res[1].CheckedAtUTC {
+		t.Fatalf("expected per-URL timestamps, got %s twice", res[0].CheckedAtUTC)
+	}
+	if log, _ := os.ReadFile(changes); strings.Contains(string(log), first.SnapshotID) {
+		t.Fatalf("first URL logged again: %s", log)
+	}
+}
@@ -0,0 +1,453 @@
+package policylock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"policyguardian/internal/shared/hashing"
+	"policyguardian/internal/shared/timefmt"
+	"policyguardian/internal/shared/zipdet"
+)
+
+const (
+	// ResourceManifestEntry lists the subresources captured with an HTML
+	// page; each raw response body is stored as resources/<nnnn>.
+	ResourceManifestEntry  = "resource_manifest.json"
+	ResourcesDir           = "resources/"
+	SchemaResourceManifest = "policylock.resource_manifest.v0.1"
+
+	// Crawl budgets used when the SnapshotOptions limits are zero. Depth 1
+	// is the page's own subresources; depth 2 adds those referenced from
+	// captured frames and stylesheets.
+	DefaultResourceMaxDepth = 2
+	DefaultResourceMaxBytes = 20 << 20
+	DefaultResourceMaxCount = 200
+)
+
+// ResourceManifest is the resource_manifest.json entry. Resources are in
+// capture (breadth-first) order; Skipped records references that were found
+// but not captured, so a reader can tell what the pack is missing.
+type ResourceManifest struct {
+	Schema    string            `json:"schema"`
+	PageURL   string            `json:"page_url"`
+	MaxDepth  int               `json:"max_depth"`
+	MaxBytes  int64             `json:"max_bytes"`
+	MaxCount  int               `json:"max_count"`
+	Resources []Resource        `json:"resources"`
+	Skipped   []SkippedResource `json:"skipped,omitempty"`
+}
+
+// Resource is one captured response. Kind is stylesheet, script, frame,
+// image or css_url; Parent is the URL of the document that referenced it.
+type Resource struct {
+	Entry          string `json:"entry"`
+	URL            string `json:"url"`
+	FinalURL       string `json:"final_url,omitempty"`
+	Kind           string `json:"kind"`
+	Depth          int    `json:"depth"`
+	Parent         string `json:"parent"`
+	HTTPStatus     int    `json:"http_status"`
+	ContentType    string `json:"content_type,omitempty"`
+	ETag           string `json:"etag,omitempty"`
+	LastModified   string `json:"last_modified,omitempty"`
+	ResolvedIP     string `json:"resolved_ip,omitempty"`
+	RetrievedAtUTC string `json:"retrieved_at_utc"`
+	Length         int    `json:"length"`
+	SHA256         string `json:"sha2-256"`
+}
+
+// SkippedResource is a reference that was not captured. Reason is
+// cross_origin, budget_exceeded or fetch_failed.
+type SkippedResource struct {
+	URL    string `json:"url"`
+	Kind   string `json:"kind"`
+	Parent string `json:"parent"`
+	Reason string `json:"reason"`
+}
+
+var (
+	htmlCommentRe = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlScriptRe  = regexp.MustCompile(`(?is)(<script\b[^>]*>).*?</script\s*>`)
+	htmlStyleRe   = regexp.MustCompile(`(?is)<style\b[^>]*>(.*?)</style\s*>`)
+	htmlTagRe     = regexp.MustCompile(`(?i)<(base|link|script|iframe|frame|img)\b([^>]*)>`)
+	htmlAttrRe    = regexp.MustCompile(`([A-Za-z_:][-A-Za-z0-9_:.]*)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
+	cssImportRe   = regexp.MustCompile(`(?i)@import\s+(?:url\(\s*)?["']?([^"')\s;]+)`)
+	cssURLRe      = regexp.MustCompile(`(?i)url\(\s*["']?([^"')]+?)["']?\s*\)`)
+)
+
+type resourceRef struct {
+	url  string
+	kind string
+}
+
+// htmlRefs extracts subresource references from an HTML document (those in
+// <style> blocks first, then tags in document order) and the <base href> if
+// any. It is a tag scanner, not a full HTML parser: references built by
+// scripts at run time are not found.
+func htmlRefs(doc []byte) (base string, refs []resourceRef) {
+	s := htmlCommentRe.ReplaceAllString(string(doc), "")
+	for _, m := range htmlStyleRe.FindAllStringSubmatch(s, -1) {
+		refs = append(refs, cssRefs([]byte(m[1]))...)
+	}
+	s = htmlScriptRe.ReplaceAllString(s, "$1")
+	for _, m := range htmlTagRe.FindAllStringSubmatch(s, -1) {
+		attrs := map[string]string{}
+		for _, a := range htmlAttrRe.FindAllStringSubmatch(m[2], -1) {
+			k := strings.ToLower(a[1])
+			if _, dup := attrs[k]; !dup {
+				attrs[k] = html.UnescapeString(strings.Trim(a[2], `"'`))
+			}
+		}
+		switch strings.ToLower(m[1]) {
+		case "base":
+			if base == "" {
+				base = attrs["href"]
+			}
+		case "link":
+			for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+				if rel == "stylesheet" {
+					refs = append(refs, resourceRef{attrs["href"], "stylesheet"})
+					break
+				}
+				if rel == "icon" || rel == "apple-touch-icon" {
+					refs = append(refs, resourceRef{attrs["href"], "image"})
+					break
+				}
+			}
+		case "script":
+			refs = append(refs, resourceRef{attrs["src"], "script"})
+		case "iframe", "frame":
+			refs = append(refs, resourceRef{attrs["src"], "frame"})
+		case "img":
+			refs = append(refs, resourceRef{attrs["src"], "image"})
+		}
+	}
+	return base, refs
+}
+
+// cssRefs extracts @import and url() references from a stylesheet.
+func cssRefs(css []byte) []resourceRef {
+	var refs []resourceRef
+	for _, m := range cssImportRe.FindAllSubmatch(css, -1) {
+		refs = append(refs, resourceRef{string(m[1]), "stylesheet"})
+	}
+	for _, m := range cssURLRe.FindAllSubmatch(css, -1) {
+		refs = append(refs, resourceRef{strings.TrimSpace(string(m[1])), "css_url"})
+	}
+	return refs
+}
+
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+func isHTMLType(contentType string) bool {
+	mt := mediaType(contentType)
+	return mt == "text/html" || mt == "application/xhtml+xml"
+}
+
+// origin returns scheme://host:port with the default port made explicit.
+func origin(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Hostname()) + ":" + port
+}
+
+var (
+	errCrossOrigin    = errors.New("cross_origin")
+	errResourceBudget = errors.New("budget_exceeded")
+)
+
+type resourceItem struct {
+	url    *url.URL
+	kind   string
+	parent string
+	depth  int
+}
+
+// resourceCrawler fetches the same-origin subresources of a page breadth
+// first within the depth, byte and count budgets.
+type resourceCrawler struct {
+	rt       http.RoundTripper
+	timeout  time.Duration
+	opts     SnapshotOptions
+	origin   string
+	seen     map[string]bool
+	used     int64
+	manifest ResourceManifest
+	entries  []zipdet.Entry
+	// secrets is false when the page was redirected to another origin;
+	// redacted request headers are then not sent there.
+	secrets bool
+}
+
+// captureResources returns resource_manifest.json and the resources/ entries
+// for an HTML page requested at requestURL and fetched from pageURL.
+func captureResources(rt http.RoundTripper, timeout time.Duration, requestURL, pageURL string, page []byte, opts SnapshotOptions) ([]byte, []zipdet.Entry, error) {
+	pu, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	ru, err := url.Parse(requestURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := &resourceCrawler{
+		rt:      rt,
+		timeout: timeout,
+		opts:    opts,
+		origin:  origin(pu),
+		secrets: origin(pu) == origin(ru),
+		seen:    map[string]bool{},
+		manifest: ResourceManifest{
+			Schema:    SchemaResourceManifest,
+			PageURL:   pageURL,
+			MaxDepth:  opts.ResourceMaxDepth,
+			MaxBytes:  opts.ResourceMaxBytes,
+			MaxCount:  opts.ResourceMaxCount,
+			Resources: []Resource{},
+		},
+	}
+	if c.manifest.MaxDepth <= 0 {
+		c.manifest.MaxDepth = DefaultResourceMaxDepth
+	}
+	if c.manifest.MaxBytes <= 0 {
+		c.manifest.MaxBytes = DefaultResourceMaxBytes
+	}
+	if c.manifest.MaxCount <= 0 {
+		c.manifest.MaxCount = DefaultResourceMaxCount
+	}
+	pu.Fragment = ""
+	c.seen[pu.String()] = true
+
+	queue := c.discover(pu, page, "text/html", 1)
+	for len(queue) > 0 {
+		it := queue[0]
+		queue = queue[1:]
+		skip := SkippedResource{URL: it.url.String(), Kind: it.kind, Parent: it.parent}
+		if origin(it.url) != c.origin {
+			skip.Reason = errCrossOrigin.Error()
+			c.manifest.Skipped = append(c.manifest.Skipped, skip)
+			continue
+		}
+		if len(c.manifest.Resources) >= c.manifest.MaxCount || c.used >= c.manifest.MaxBytes {
+			skip.Reason = errResourceBudget.Error()
+			c.manifest.Skipped = append(c.manifest.Skipped, skip)
+			continue
+		}
+		res, body, err := c.fetch(it)
+		if err != nil {
+			skip.Reason = "fetch_failed"
+			for _, e := range []error{errCrossOrigin, errResourceBudget} {
+				if errors.Is(err, e) {
+					skip.Reason = e.Error()
+				}
+			}
+			c.manifest.Skipped = append(c.manifest.Skipped, skip)
+			continue
+		}
+		c.used += int64(len(body))
+		res.Entry = fmt.Sprintf("%s%04d", ResourcesDir, len(c.manifest.Resources)+1)
+		c.manifest.Resources = append(c.manifest.Resources, res)
+		c.entries = append(c.entries, zipdet.Entry{Name: res.Entry, Data: body})
+		if it.depth < c.manifest.MaxDepth && res.HTTPStatus < 300 {
+			final := it.url
+			if res.FinalURL != "" {
+				final, _ = url.Parse(res.FinalURL)
+			}
+			queue = append(queue, c.discover(final, body, res.ContentType, it.depth+1)...)
+		}
+	}
+	b, err := json.MarshalIndent(c.manifest, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(b, '\n'), c.entries, nil
+}
+
+// discover resolves the references of an HTML or CSS document against base
+// and returns those not seen before. Non-http(s) references (data:,
+// javascript:, ...) are inline or not fetchable and are ignored.
+func (c *resourceCrawler) discover(base *url.URL, doc []byte, contentType string, depth int) []resourceItem {
+	var refs []resourceRef
+	switch {
+	case isHTMLType(contentType):
+		var href string
+		href, refs = htmlRefs(doc)
+		if href != "" {
+			if b, err := base.Parse(href); err == nil {
+				base = b
+			}
+		}
+	case mediaType(contentType) == "text/css":
+		refs = cssRefs(doc)
+	default:
+		return nil
+	}
+	var out []resourceItem
+	for _, r := range refs {
+		ref := strings.TrimSpace(r.url)
+		if ref == "" {
+			continue
+		}
+		u, err := base.Parse(ref)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		u.Fragment = ""
+		if c.seen[u.String()] {
+			continue
+		}
+		c.seen[u.String()] = true
+		out = append(out, resourceItem{url: u, kind: r.kind, parent: base.String(), depth: depth})
+	}
+	return out
+}
+
+// fetch GETs one resource with the page's transport, user agent and request
+// headers, less the redacted ones when the page left the requested origin.
+// Redirects must stay same-origin and the body must fit the remaining byte
+// budget.
+func (c *resourceCrawler) fetch(it resourceItem) (Resource, []byte, error) {
+	hops := newHopRecorder(c.rt)
+	client := &http.Client{
+		Transport: hops,
+		Timeout:   c.timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if origin(req.URL) != c.origin {
+				return errCrossOrigin
+			}
+			return nil
+		},
+	}
+	req, err := http.NewRequest("GET", it.url.String(), nil)
+	if err != nil {
+		return Resource{}, nil, err
+	}
+	req.Header.Set("User-Agent", c.opts.ua())
+	for _, h := range c.opts.RequestHeaders {
+		if !c.secrets && (h.Secret || isSensitiveHeader(h.Name)) {
+			continue
+		}
+		req.Header.Add(strings.TrimSpace(h.Name), h.Value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Resource{}, nil, err
+	}
+	defer resp.Body.Close()
+	remaining := c.manifest.MaxBytes - c.used
+	body, err := io.ReadAll(io.LimitReader(resp.Body, remaining+1))
+	if err != nil {
+		return Resource{}, nil, err
+	}
+	if int64(len(body)) > remaining {
+		return Resource{}, nil, errResourceBudget
+	}
+	at := c.opts.RetrievedAtUTC
+	if at == "" {
+		at = c.opts.CreatedAtUTC
+	}
+	if at == "" {
+		at = timefmt.Format(timefmt.NowUTC())
+	}
+	res := Resource{
+		URL:            it.url.String(),
+		Kind:           it.kind,
+		Depth:          it.depth,
+		Parent:         it.parent,
+		HTTPStatus:     resp.StatusCode,
+		ContentType:    resp.Header.Get("Content-Type"),
+		ETag:           resp.Header.Get("ETag"),
+		LastModified:   resp.Header.Get("Last-Modified"),
+		ResolvedIP:     hostOf(hops.conn.remote),
+		RetrievedAtUTC: at,
+		Length:         len(body),
+		SHA256:         hashing.SHA256Hex(body),
+	}
+	if final := resp.Request.URL.String(); final != res.URL {
+		res.FinalURL = final
+	}
+	return res, body, nil
+}
+
+// parseResourceManifest decodes resource_manifest.json.
+func parseResourceManifest(b []byte) (*ResourceManifest, error) {
+	var m ResourceManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	if m.Schema != SchemaResourceManifest {
+		return nil, errors.New("not a resource manifest")
+	}
+	return &m, nil
+}
+
+// verifyResources checks every captured resource against
+// resource_manifest.json, whose own hash has already been checked. bodies
+// maps resources/ entry names to their bytes.
+func verifyResources(fetch *PolicyFetch, manifest []byte, bodies map[string][]byte) string {
+	if fetch == nil || fetch.ResourceManifest == nil {
+		if len(bodies) > 0 {
+			return "resource_unexpected"
+		}
+		return ""
+	}
+	m, err := parseResourceManifest(manifest)
+	if err != nil || m.PageURL != fetch.FinalURL {
+		return "resource_manifest_invalid"
+	}
+	seen := map[string]bool{}
+	for _, r := range m.Resources {
+		body, ok := bodies[r.Entry]
+		if !ok || seen[r.Entry] {
+			return "resource_missing"
+		}
+		seen[r.Entry] = true
+		if len(body) != r.Length || hashing.SHA256Hex(body) != r.SHA256 {
+			return "resource_hash_mismatch"
+		}
+	}
+	if len(bodies) != len(m.Resources) {
+		return "resource_unexpected"
+	}
+	return ""
+}
+
+// ReadResourceManifest returns the resource manifest of a URL pack.
+func ReadResourceManifest(zipBytes []byte) (*ResourceManifest, error) {
+	b, err := readPackEntry(zipBytes, ResourceManifestEntry)
+	if err != nil {
+		return nil, err
+	}
+	return parseResourceManifest(b)
+}
+
+// FormatResource renders a captured resource on one line:
+// "<entry> <kind> <status> <url> <sha2-256>".
+func FormatResource(r Resource) string {
+	return fmt.Sprintf("%s %s %d %s %s", r.Entry, r.Kind, r.HTTPStatus, r.URL, r.SHA256)
+}
+
+// FormatSkippedResource renders a skipped reference: "<reason> <kind> <url>".
+func FormatSkippedResource(s SkippedResource) string {
+	return s.Reason + " " + s.Kind + " " + s.URL
+}
@@ -0,0 +1,250 @@
+package policylock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"policyguardian/internal/shared/timefmt"
+)
+
+// matchSource reports whether a relative slash path is selected by the
+// include and exclude patterns. A pattern (path.Match syntax) matches either
+// the whole path or its base name; no include means everything, and an
+// exclude match always wins.
+func matchSource(rel string, include, exclude []string) (bool, error) {
+	match := func(pats []string) (bool, error) {
+		for _, p := range pats {
+			for _, s := range []string{rel, path.Base(rel)} {
+				ok, err := path.Match(p, s)
+				if err != nil {
+					return false, fmt.Errorf("invalid pattern %q: %w", p, err)
+				}
+				if ok {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+	if ex, err := match(exclude); err != nil || ex {
+		return false, err
+	}
+	if len(include) == 0 {
+		return true, nil
+	}
+	return match(include)
+}
+
+// DirInputs walks dir in lexical order and returns its regular files as
+// bundle documents named by their slash-separated relative path. Symlinks,
+// special files and .git directories are skipped.
+func DirInputs(dir string, include, exclude []string) ([]BundleInput, error) {
+	var docs []BundleInput
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" && p != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		ok, err := matchSource(rel, include, exclude)
+		if err != nil || !ok {
+			return err
+		}
+		body, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, BundleInput{Name: rel, Path: rel, Bytes: body})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("no files selected in %s", dir)
+	}
+	return docs, nil
+}
+
+// SnapshotFromDir snapshots the selected files of a directory as a bundle
+// with input mode "dir".
+func SnapshotFromDir(dir string, include, exclude []string, opts SnapshotOptions) ([]byte, *PolicySnapshot, error) {
+	docs, err := DirInputs(dir, include, exclude)
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest, bodies, err := buildBundle(docs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return buildSnapshot(manifest, PolicyInput{Mode: "dir", Path: dir}, nil, opts, bodies...)
+}
+
+// ParseGitSource splits "<repo>@<rev>" at the last "@"; rev defaults to HEAD.
+func ParseGitSource(s string) (repo, rev string) {
+	if i := strings.LastIndex(s, "@"); i > 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, "HEAD"
+}
+
+// git runs git against a local repository. Lazy fetches from promisor
+// remotes are disabled so a snapshot never touches the network.
+func git(repo string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_NO_LAZY_FETCH=1", "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// gitCommit reads the tree, author, committer and committer time of commit.
+func gitCommit(repo, commit string) (*GitSource, error) {
+	raw, err := git(repo, "cat-file", "commit", commit)
+	if err != nil {
+		return nil, err
+	}
+	src := &GitSource{Commit: commit}
+	header, _, _ := bytes.Cut(raw, []byte("\n\n"))
+	for _, line := range strings.Split(string(header), "\n") {
+		key, val, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			src.Tree = val
+		case "author":
+			src.Author, _, err = splitGitIdent(val)
+		case "committer":
+			var t time.Time
+			src.Committer, t, err = splitGitIdent(val)
+			src.CommitTimeUTC = timefmt.Format(t.UTC())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if src.Tree == "" || src.Author == "" || src.Committer == "" {
+		return nil, fmt.Errorf("malformed commit %s", commit)
+	}
+	return src, nil
+}
+
+// splitGitIdent splits "Name <email> <unix> <tz>" into the identity and time.
+func splitGitIdent(s string) (string, time.Time, error) {
+	i := strings.LastIndex(s, ">")
+	if i < 0 {
+		return "", time.Time{}, fmt.Errorf("malformed git identity %q", s)
+	}
+	f := strings.Fields(s[i+1:])
+	if len(f) == 0 {
+		return "", time.Time{}, fmt.Errorf("malformed git identity %q", s)
+	}
+	sec, err := strconv.ParseInt(f[0], 10, 64)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("malformed git identity %q", s)
+	}
+	return s[:i+1], time.Unix(sec, 0), nil
+}
+
+// GitInputs resolves rev in a local repository and returns the selected
+// regular files of its tree (mode 100644 or 100755; symlinks and submodules
+// are skipped) in tree order, with the commit provenance.
+func GitInputs(repo, rev string, include, exclude []string) ([]BundleInput, *GitSource, error) {
+	if strings.Contains(repo, "://") || strings.HasPrefix(repo, "git@") {
+		return nil, nil, errors.New("git snapshots support local repositories only")
+	}
+	if st, err := os.Stat(repo); err != nil {
+		return nil, nil, err
+	} else if !st.IsDir() {
+		return nil, nil, fmt.Errorf("%s is not a directory", repo)
+	}
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return nil, nil, fmt.Errorf("invalid git revision %q", rev)
+	}
+	out, err := git(repo, "rev-parse", "--verify", "--end-of-options", rev+"^{commit}")
+	if err != nil {
+		return nil, nil, err
+	}
+	commit := strings.TrimSpace(string(out))
+	src, err := gitCommit(repo, commit)
+	if err != nil {
+		return nil, nil, err
+	}
+	src.Repo, src.Rev = repo, rev
+
+	out, err = git(repo, "ls-tree", "-r", "-z", commit)
+	if err != nil {
+		return nil, nil, err
+	}
+	var docs []BundleInput
+	for _, rec := range strings.Split(string(out), "\x00") {
+		if rec == "" {
+			continue
+		}
+		meta, name, ok := strings.Cut(rec, "\t")
+		f := strings.Fields(meta)
+		if !ok || len(f) != 3 {
+			return nil, nil, fmt.Errorf("unexpected ls-tree output %q", rec)
+		}
+		if f[1] != "blob" || (f[0] != "100644" && f[0] != "100755") {
+			continue
+		}
+		sel, err := matchSource(name, include, exclude)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !sel {
+			continue
+		}
+		body, err := git(repo, "cat-file", "blob", f[2])
+		if err != nil {
+			return nil, nil, err
+		}
+		docs = append(docs, BundleInput{Name: name, Path: name, Bytes: body})
+	}
+	if len(docs) == 0 {
+		return nil, nil, fmt.Errorf("no files selected at %s", commit)
+	}
+	return docs, src, nil
+}
+
+// SnapshotFromGit snapshots the selected files of a local repository at rev
+// as a bundle with input mode "git".
+func SnapshotFromGit(repo, rev string, include, exclude []string, opts SnapshotOptions) ([]byte, *PolicySnapshot, error) {
+	docs, src, err := GitInputs(repo, rev, include, exclude)
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest, bodies, err := buildBundle(docs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return buildSnapshot(manifest, PolicyInput{Mode: "git", Git: src}, nil, opts, bodies...)
+}
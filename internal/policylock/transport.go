@@ -0,0 +1,109 @@
+package policylock
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"policyguardian/internal/shared/hashing"
+)
+
+// DefaultFetchTimeout bounds a URL fetch, redirects included, when
+// SnapshotOptions.Timeout is zero.
+const DefaultFetchTimeout = 30 * time.Second
+
+// ParseTLSVersion accepts 1.0, 1.1, 1.2 or 1.3, with or without a "TLS"
+// prefix.
+func ParseTLSVersion(s string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "TLS") {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q (1.0|1.1|1.2|1.3)", s)
+}
+
+// fetchTransport returns the round tripper for a URL fetch and the settings
+// to record. When opts.Transport is set it is used as is and only the
+// timeout is recorded. The returned func releases idle connections.
+func fetchTransport(opts SnapshotOptions, req *http.Request) (http.RoundTripper, *FetchTransport, func(), error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultFetchTimeout
+	}
+	rec := &FetchTransport{TimeoutMS: timeout.Milliseconds()}
+	if opts.Transport != nil {
+		if opts.ClientCertFile != "" || opts.CABundleFile != "" || opts.ProxyURL != "" || opts.TLSMinVersion != 0 {
+			return nil, nil, nil, errors.New("a custom Transport cannot be combined with client cert, CA bundle, proxy or TLS minimum version options")
+		}
+		return opts.Transport, rec, func() {}, nil
+	}
+
+	// A private connection pool per fetch: the first request always dials,
+	// so connection_reused and the TLS details do not depend on earlier
+	// fetches in the same process.
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{}
+
+	if opts.TLSMinVersion != 0 {
+		t.TLSClientConfig.MinVersion = opts.TLSMinVersion
+		rec.TLSMinVersion = tlsVersionString(opts.TLSMinVersion)
+	}
+	if opts.CABundleFile != "" {
+		pem, err := os.ReadFile(opts.CABundleFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, nil, fmt.Errorf("no PEM certificates in %s", opts.CABundleFile)
+		}
+		t.TLSClientConfig.RootCAs = pool
+		rec.CABundleSHA256 = hashing.SHA256Hex(pem)
+	}
+	if opts.ClientCertFile != "" || opts.ClientKeyFile != "" {
+		if opts.ClientCertFile == "" || opts.ClientKeyFile == "" {
+			return nil, nil, nil, errors.New("client certificate and key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("client certificate: %w", err)
+		}
+		t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+		rec.ClientCertSHA256 = sha256Hex(cert.Certificate[0])
+	}
+	if opts.ProxyURL != "" {
+		pu, err := url.Parse(opts.ProxyURL)
+		if err != nil || pu.Host == "" {
+			return nil, nil, nil, fmt.Errorf("invalid proxy URL %q", opts.ProxyURL)
+		}
+		switch pu.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, nil, nil, fmt.Errorf("unsupported proxy scheme %q (http|https|socks5|socks5h)", pu.Scheme)
+		}
+		t.Proxy = http.ProxyURL(pu)
+	}
+	// Record the proxy actually chosen for the first request, which also
+	// covers HTTP(S)_PROXY from the environment. Credentials are dropped.
+	if pu, err := t.Proxy(req); err != nil {
+		return nil, nil, nil, err
+	} else if pu != nil {
+		rec.Proxy = pu.Scheme + "://" + pu.Host
+	}
+	return t, rec, t.CloseIdleConnections, nil
+}
@@ -0,0 +1,376 @@
+package policylock
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"policyguardian/internal/shared/hashing"
+	"policyguardian/internal/shared/timefmt"
+	"policyguardian/internal/shared/warc"
+	"policyguardian/internal/shared/zipdet"
+)
+
+// WARC fields added to exported records so that a record can be traced back
+// to its snapshot pack.
+const (
+	WARCSnapshotIDField   = "WARC-PolicyLock-Snapshot-ID"
+	WARCPolicySHA256Field = "WARC-PolicyLock-Policy-SHA256"
+)
+
+// warcRecordID derives a stable urn:uuid record ID from seed, so exporting
+// the same packs twice yields the same file.
+func warcRecordID(seed ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(seed, "\x00")))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// ExportWARC converts snapshot packs into WARC records: one warcinfo record,
+// then per pack its content and a metadata record holding
+// policy_snapshot.json. URL packs become a request and a response record
+// (plus a response record per captured page resource); packs imported from
+// WARC become a response record; file, stdin, bundle, dir and git packs
+// become resource records with urn:policylock:<snapshot_id>[/<name>] target
+// URIs. Every pack must verify.
+func ExportWARC(packs [][]byte, filename, software string) ([]warc.Record, error) {
+	if len(packs) == 0 {
+		return nil, errors.New("no snapshot packs")
+	}
+	var ids []string
+	var body []warc.Record
+	for i, zipBytes := range packs {
+		status, reason, err := VerifySnapshotZip(zipBytes)
+		if err != nil {
+			return nil, fmt.Errorf("pack %d: %w", i+1, err)
+		}
+		if status != "VALID" {
+			return nil, fmt.Errorf("pack %d: %s", i+1, reason)
+		}
+		recs, err := packWARCRecords(zipBytes)
+		if err != nil {
+			return nil, fmt.Errorf("pack %d: %w", i+1, err)
+		}
+		ids = append(ids, recs[len(recs)-1].Get(WARCSnapshotIDField))
+		body = append(body, recs...)
+	}
+	first, _, _ := ReadSnapshotInfo(packs[0])
+	info := "software: " + software + "\r\n" +
+		"format: WARC File Format 1.1\r\n" +
+		"conformsTo: https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n"
+	warcinfo := warc.Record{
+		Fields: []warc.Field{
+			{Name: "WARC-Type", Value: "warcinfo"},
+			{Name: "WARC-Record-ID", Value: warcRecordID(append([]string{"warcinfo", filename}, ids...)...)},
+			{Name: "WARC-Date", Value: first.CreatedAtUTC},
+			{Name: "WARC-Filename", Value: filename},
+			{Name: "Content-Type", Value: "application/warc-fields"},
+			{Name: "WARC-Block-Digest", Value: warc.Digest([]byte(info))},
+		},
+		Block: []byte(info),
+	}
+	return append([]warc.Record{warcinfo}, body...), nil
+}
+
+func packWARCRecords(zipBytes []byte) ([]warc.Record, error) {
+	snap, policySHA, err := ReadSnapshotInfo(zipBytes)
+	if err != nil {
+		return nil, err
+	}
+	snapJSON, err := readPackEntry(zipBytes, "policy_snapshot.json")
+	if err != nil {
+		return nil, err
+	}
+	id := snap.SnapshotID
+	tag := []warc.Field{
+		{Name: WARCSnapshotIDField, Value: id},
+		{Name: WARCPolicySHA256Field, Value: policySHA},
+	}
+	var recs []warc.Record
+	var target, primary string
+	f := snap.Policy.Fetch
+	switch {
+	case f != nil:
+		body, err := readPackEntry(zipBytes, bodyEntry(snap))
+		if err != nil {
+			return nil, err
+		}
+		target = f.FinalURL
+		if target == "" {
+			target = snap.Policy.Input.URL
+		}
+		primary = warcRecordID(id, "response", target)
+		var headers map[string][]string
+		if f.ResponseHeaders != nil {
+			b, err := readPackEntry(zipBytes, f.ResponseHeaders.File)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(b, &headers); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.ResponseHeaders.File, err)
+			}
+		} else {
+			headers = fallbackHeaders(f.ContentType, f.ETag, f.LastModified)
+		}
+		if snap.Policy.Input.Mode == "url" {
+			req := httpRequestBlock(target, f)
+			recs = append(recs, warc.Record{
+				Fields: []warc.Field{
+					{Name: "WARC-Type", Value: "request"},
+					{Name: "WARC-Record-ID", Value: warcRecordID(id, "request", target)},
+					{Name: "WARC-Date", Value: f.RetrievedAtUTC},
+					{Name: "WARC-Target-URI", Value: target},
+					{Name: "WARC-Concurrent-To", Value: primary},
+					{Name: "Content-Type", Value: "application/http;msgtype=request"},
+					{Name: "WARC-Block-Digest", Value: warc.Digest(req)},
+				},
+				Block: req,
+			})
+		}
+		recs = append(recs, responseRecord(primary, target, f.RetrievedAtUTC, f.ResolvedIP, f.HTTPProtocol, f.HTTPStatus, headers, body, tag))
+		if f.ResourceManifest != nil {
+			m, err := ReadResourceManifest(zipBytes)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range m.Resources {
+				rb, err := readPackEntry(zipBytes, r.Entry)
+				if err != nil {
+					return nil, err
+				}
+				u := r.URL
+				if r.FinalURL != "" {
+					u = r.FinalURL
+				}
+				recs = append(recs, responseRecord(warcRecordID(id, "response", r.Entry), u, r.RetrievedAtUTC, r.ResolvedIP, "",
+					r.HTTPStatus, fallbackHeaders(r.ContentType, r.ETag, r.LastModified), rb, tag[:1]))
+			}
+		}
+	case isBundleMode(snap.Policy.Input.Mode):
+		m, err := ReadBundleManifest(zipBytes)
+		if err != nil {
+			return nil, err
+		}
+		target = "urn:policylock:" + id
+		primary = warcRecordID(id, "resource", BundleManifestEntry)
+		manifest, err := readPackEntry(zipBytes, BundleManifestEntry)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, resourceRecord(primary, target, snap.CreatedAtUTC, "application/json", manifest, tag))
+		for _, d := range m.Documents {
+			b, err := readPackEntry(zipBytes, BundleBodiesDir+d.Name)
+			if err != nil {
+				return nil, err
+			}
+			recs = append(recs, resourceRecord(warcRecordID(id, "resource", d.Name), target+"/"+d.Name, snap.CreatedAtUTC,
+				"application/octet-stream", b, tag[:1]))
+		}
+	default:
+		body, err := readPackEntry(zipBytes, "policy_body.bin")
+		if err != nil {
+			return nil, err
+		}
+		target = "urn:policylock:" + id
+		primary = warcRecordID(id, "resource", target)
+		recs = append(recs, resourceRecord(primary, target, snap.CreatedAtUTC, "application/octet-stream", body, tag))
+	}
+	recs = append(recs, warc.Record{
+		Fields: append([]warc.Field{
+			{Name: "WARC-Type", Value: "metadata"},
+			{Name: "WARC-Record-ID", Value: warcRecordID(id, "metadata")},
+			{Name: "WARC-Date", Value: snap.CreatedAtUTC},
+			{Name: "WARC-Target-URI", Value: target},
+			{Name: "WARC-Refers-To", Value: primary},
+			{Name: "Content-Type", Value: "application/json"},
+			{Name: "WARC-Block-Digest", Value: warc.Digest(snapJSON)},
+		}, tag...),
+		Block: snapJSON,
+	})
+	return recs, nil
+}
+
+func fallbackHeaders(contentType, etag, lastModified string) map[string][]string {
+	h := map[string][]string{}
+	for k, v := range map[string]string{"content-type": contentType, "etag": etag, "last-modified": lastModified} {
+		if v != "" {
+			h[k] = []string{v}
+		}
+	}
+	return h
+}
+
+// httpRequestBlock reconstructs the final request from the recorded request
+// headers. Redacted values are left out rather than replayed as hashes.
+func httpRequestBlock(target string, f *PolicyFetch) []byte {
+	u, _ := url.Parse(target)
+	var b strings.Builder
+	b.WriteString("GET " + u.RequestURI() + " HTTP/1.1\r\nHost: " + u.Host + "\r\n")
+	names := make([]string, 0, len(f.RequestHeaders))
+	for k := range f.RequestHeaders {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		v := f.RequestHeaders[k]
+		if f.RequestHeaderSalt != "" && strings.HasPrefix(v, "sha2-256:") {
+			continue
+		}
+		b.WriteString(http.CanonicalHeaderKey(k) + ": " + v + "\r\n")
+	}
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+func responseRecord(id, target, date, ip, proto string, status int, headers map[string][]string, body []byte, tag []warc.Field) warc.Record {
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %d %s\r\n", proto, status, http.StatusText(status))
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		if k == "content-length" || k == "transfer-encoding" {
+			continue
+		}
+		for _, v := range headers[k] {
+			b.WriteString(http.CanonicalHeaderKey(k) + ": " + v + "\r\n")
+		}
+	}
+	// The stored body is the decoded entity, so its length is authoritative.
+	fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n", len(body))
+	b.Write(body)
+	fields := []warc.Field{
+		{Name: "WARC-Type", Value: "response"},
+		{Name: "WARC-Record-ID", Value: id},
+		{Name: "WARC-Date", Value: date},
+		{Name: "WARC-Target-URI", Value: target},
+	}
+	if ip != "" {
+		fields = append(fields, warc.Field{Name: "WARC-IP-Address", Value: ip})
+	}
+	fields = append(fields,
+		warc.Field{Name: "Content-Type", Value: "application/http;msgtype=response"},
+		warc.Field{Name: "WARC-Block-Digest", Value: warc.Digest(b.Bytes())},
+		warc.Field{Name: "WARC-Payload-Digest", Value: warc.Digest(body)},
+	)
+	return warc.Record{Fields: append(fields, tag...), Block: b.Bytes()}
+}
+
+func resourceRecord(id, target, date, contentType string, body []byte, tag []warc.Field) warc.Record {
+	return warc.Record{
+		Fields: append([]warc.Field{
+			{Name: "WARC-Type", Value: "resource"},
+			{Name: "WARC-Record-ID", Value: id},
+			{Name: "WARC-Date", Value: date},
+			{Name: "WARC-Target-URI", Value: target},
+			{Name: "Content-Type", Value: contentType},
+			{Name: "WARC-Block-Digest", Value: warc.Digest(body)},
+		}, tag...),
+		Block: body,
+	}
+}
+
+// ImportedSnapshot is one pack built by ImportWARC.
+type ImportedSnapshot struct {
+	Zip      []byte
+	Snapshot *PolicySnapshot
+}
+
+// ImportWARC builds a snapshot pack (input mode "warc") from every HTTP
+// response record of a WARC file. The record's target URI, WARC-Date and
+// IP address become the fetch metadata and the record ID and digests are
+// kept as provenance; records with a WARC-Block-Digest must match it. Other
+// record types are ignored.
+func ImportWARC(data []byte, filename string, opts SnapshotOptions) ([]ImportedSnapshot, error) {
+	recs, err := warc.Read(data)
+	if err != nil {
+		return nil, err
+	}
+	var out []ImportedSnapshot
+	for _, rec := range recs {
+		if rec.Type() != "response" || !strings.HasPrefix(strings.ToLower(rec.Get("Content-Type")), "application/http") {
+			continue
+		}
+		id := rec.Get("WARC-Record-ID")
+		zipBytes, snap, err := importResponse(rec, filepath.Base(filename), opts)
+		if err != nil {
+			return nil, fmt.Errorf("record %s: %w", id, err)
+		}
+		out = append(out, ImportedSnapshot{Zip: zipBytes, Snapshot: snap})
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no HTTP response records")
+	}
+	return out, nil
+}
+
+func importResponse(rec warc.Record, filename string, opts SnapshotOptions) ([]byte, *PolicySnapshot, error) {
+	src := &WARCSource{
+		File:          filename,
+		RecordID:      rec.Get("WARC-Record-ID"),
+		TargetURI:     strings.Trim(rec.Get("WARC-Target-URI"), "<>"),
+		Date:          rec.Get("WARC-Date"),
+		BlockDigest:   rec.Get("WARC-Block-Digest"),
+		PayloadDigest: rec.Get("WARC-Payload-Digest"),
+		SnapshotID:    rec.Get(WARCSnapshotIDField),
+	}
+	if src.TargetURI == "" || src.RecordID == "" || src.Date == "" {
+		return nil, nil, errors.New("missing WARC-Target-URI, WARC-Record-ID or WARC-Date")
+	}
+	if src.BlockDigest != "" {
+		ok, err := warc.CheckDigest(src.BlockDigest, rec.Block)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			return nil, nil, errors.New("block digest mismatch")
+		}
+	}
+	at, err := time.Parse(time.RFC3339Nano, src.Date)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid WARC-Date %q", src.Date)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(rec.Block)), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("http response: %w", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("http response body: %w", err)
+	}
+	headersJSON, err := responseHeadersJSON(resp.Header, opts.ResponseHeaderDenyList)
+	if err != nil {
+		return nil, nil, err
+	}
+	fetch := &PolicyFetch{
+		RequestedURL:    src.TargetURI,
+		FinalURL:        src.TargetURI,
+		HTTPStatus:      resp.StatusCode,
+		ContentType:     resp.Header.Get("Content-Type"),
+		ETag:            resp.Header.Get("ETag"),
+		LastModified:    resp.Header.Get("Last-Modified"),
+		RetrievedAtUTC:  timefmt.Format(at.UTC().Truncate(time.Second)),
+		ResolvedIP:      rec.Get("WARC-IP-Address"),
+		HTTPProtocol:    resp.Proto,
+		ResponseHeaders: &PackEntry{File: ResponseHeadersEntry, SHA256: hashing.SHA256Hex(headersJSON)},
+	}
+	in := PolicyInput{Mode: "warc", URL: src.TargetURI, WARC: src}
+	return buildSnapshot(body, in, fetch, opts, zipdet.Entry{Name: ResponseHeadersEntry, Data: headersJSON})
+}
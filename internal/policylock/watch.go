@@ -0,0 +1,199 @@
+package policylock
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"policyguardian/internal/shared/timefmt"
+	"policyguardian/internal/store"
+)
+
+// WatchOptions configures one watch pass over a watchlist.
+type WatchOptions struct {
+	// StoreDir is the evidence store root; packs are put into the store and
+	// watch state/change log go to <store>/watch.
+	StoreDir string
+	// Snapshot is the template used for every URL fetch. When CreatedAtUTC
+	// is empty each URL is stamped with the time its fetch starts.
+	Snapshot SnapshotOptions
+}
+
+// WatchResult reports what happened to one URL during a pass.
+// Status is one of new|changed|unchanged|not_modified|error.
+type WatchResult struct {
+	URL                  string `json:"url"`
+	CheckedAtUTC         string `json:"checked_at_utc"`
+	Status               string `json:"status"`
+	SnapshotID           string `json:"snapshot_id,omitempty"`
+	PolicySHA256         string `json:"policy_sha256,omitempty"`
+	PreviousSnapshotID   string `json:"previous_snapshot_id,omitempty"`
+	PreviousPolicySHA256 string `json:"previous_policy_sha256,omitempty"`
+	Error                string `json:"error,omitempty"`
+}
+
+type watchState struct {
+	// Latest maps a watched URL to the snapshot_id of its newest pack.
+	Latest map[string]string `json:"latest"`
+}
+
+// ReadWatchlist reads one URL per line. Blank lines and lines starting with
+// '#' are ignored; duplicates are dropped.
+func ReadWatchlist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	seen := map[string]bool{}
+	var urls []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || seen[line] {
+			continue
+		}
+		seen[line] = true
+		urls = append(urls, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// WatchOnce fetches every URL once, using the previous pack's ETag and
+// Last-Modified for conditional requests. A new pack is written to the store
+// only when the sha2-256 body hash differs from the previous pack, and each
+// new/changed result is appended to <store>/watch/changes.jsonl.
+// Per-URL failures are reported in the results, not as an error.
+func WatchOnce(urls []string, opts WatchOptions) ([]WatchResult, error) {
+	if opts.StoreDir == "" {
+		return nil, errors.New("store dir required")
+	}
+	watchDir := filepath.Join(opts.StoreDir, "watch")
+	if err := os.MkdirAll(watchDir, 0755); err != nil {
+		return nil, err
+	}
+	st, err := store.OpenFS(opts.StoreDir)
+	if err != nil {
+		return nil, err
+	}
+	statePath := filepath.Join(watchDir, "state.json")
+	state, err := loadWatchState(statePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []WatchResult
+	for _, u := range urls {
+		r := WatchResult{URL: u}
+		so := opts.Snapshot
+		so.IfNoneMatch, so.IfModifiedSince = "", ""
+
+		if prevID := state.Latest[u]; prevID != "" {
+			r.PreviousSnapshotID = prevID
+			if b, _, err := st.Get(store.KindSnapshot, prevID); err == nil {
+				if prev, bodyHash, err := ReadSnapshotInfo(b); err == nil {
+					r.PreviousPolicySHA256 = bodyHash
+					if prev.Policy.Fetch != nil {
+						so.IfNoneMatch = prev.Policy.Fetch.ETag
+						so.IfModifiedSince = prev.Policy.Fetch.LastModified
+					}
+				}
+			}
+		}
+
+		if so.CreatedAtUTC == "" {
+			so.CreatedAtUTC = timefmt.Format(timefmt.NowUTC())
+		}
+		r.CheckedAtUTC = so.CreatedAtUTC
+		zipBytes, snap, err := SnapshotFromURL(u, so)
+		switch {
+		case errors.Is(err, ErrNotModified):
+			r.Status = "not_modified"
+			r.SnapshotID = r.PreviousSnapshotID
+			r.PolicySHA256 = r.PreviousPolicySHA256
+		case err != nil:
+			r.Status = "error"
+			r.Error = err.Error()
+		default:
+			r.PolicySHA256 = snap.Policy.Bytes.Hashes["sha2-256"]
+			if r.PreviousPolicySHA256 != "" && r.PreviousPolicySHA256 == r.PolicySHA256 {
+				r.Status = "unchanged"
+				r.SnapshotID = r.PreviousSnapshotID
+				break
+			}
+			meta, err := StoreMeta(zipBytes)
+			if err != nil {
+				return results, err
+			}
+			if _, err := st.Put(meta, zipBytes); err != nil {
+				return results, err
+			}
+			r.SnapshotID = snap.SnapshotID
+			r.Status = "changed"
+			if r.PreviousSnapshotID == "" {
+				r.Status = "new"
+			}
+			if err := appendChangeLog(filepath.Join(watchDir, "changes.jsonl"), r); err != nil {
+				return results, err
+			}
+			// Record the change before the next URL, so a failure or crash
+			// later in the pass does not log it again.
+			state.Latest[u] = snap.SnapshotID
+			if err := saveWatchState(statePath, state); err != nil {
+				return results, err
+			}
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func loadWatchState(path string) (*watchState, error) {
+	st := &watchState{Latest: map[string]string{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("invalid watch state: %w", err)
+	}
+	if st.Latest == nil {
+		st.Latest = map[string]string{}
+	}
+	return st, nil
+}
+
+func saveWatchState(path string, st *watchState) error {
+	// encoding/json sorts map keys, so the file is stable across runs.
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store.WriteFileAtomic(path, append(b, '\n'))
+}
+
+func appendChangeLog(path string, r WatchResult) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
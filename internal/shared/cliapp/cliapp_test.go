@@ -0,0 +1,525 @@
+package cliapp
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const (
+	testPolicy    = "../../../fixtures/policylock/policy1.txt"
+	testPolicyB   = "../../../fixtures/policylock/policy3.txt"
+	resultSchema  = "../../../schemas/cli_result_v0_1.schema.json"
+	testCreatedAt = "2026-01-01T00:00:00Z"
+)
+
+// runJSON runs the CLI with args, captures stdout and returns the exit code
+// and the printed JSON object after checking it against the result schema.
+func runJSON(t *testing.T, args ...string) (int, map[string]any) {
+	t.Helper()
+	exit, out := capture(t, args...)
+	var res map[string]any
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.UseNumber()
+	if err := dec.Decode(&res); err != nil {
+		t.Fatalf("%v: stdout is not one JSON object: %v\n%s", args, err, out)
+	}
+	if dec.More() {
+		t.Fatalf("%v: more than one JSON value on stdout:\n%s", args, out)
+	}
+	if err := validateResult(t, res); err != nil {
+		t.Fatalf("%v: result does not match %s: %v\n%s", args, resultSchema, err, out)
+	}
+	if code := res["exit_code"].(json.Number).String(); code != fmt.Sprint(exit) {
+		t.Fatalf("%v: exit_code %s, but Run returned %d", args, code, exit)
+	}
+	return exit, res
+}
+
+// capture runs the CLI with args and returns its exit code and stdout.
+// Stderr is discarded.
+func capture(t *testing.T, args ...string) (int, []byte) {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devnull.Close()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = f, devnull
+	jsonOutput = false
+	exit := Run(args)
+	os.Stdout, os.Stderr = stdout, stderr
+	jsonOutput = false
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exit, out
+}
+
+// expect checks the status, reason and exit code of a result.
+func expect(t *testing.T, res map[string]any, exit int, status, reason string, wantExit int) {
+	t.Helper()
+	got, _ := res["reason"].(string)
+	if res["status"] != status || got != reason || exit != wantExit {
+		t.Fatalf("%s: got status %v reason %q exit %d, want %s %q %d (error %v)", res["command"], res["status"], got, exit, status, reason, wantExit, res["error"])
+	}
+}
+
+func result(t *testing.T, res map[string]any) map[string]any {
+	t.Helper()
+	m, ok := res["result"].(map[string]any)
+	if !ok {
+		t.Fatalf("%s: missing result object", res["command"])
+	}
+	return m
+}
+
+var loadedSchema map[string]any
+
+func validateResult(t *testing.T, v any) error {
+	t.Helper()
+	if loadedSchema == nil {
+		b, err := os.ReadFile(resultSchema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(b, &loadedSchema); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return validate(loadedSchema, loadedSchema, v, "$")
+}
+
+// validate checks v against the JSON Schema keywords the result schema
+// uses. Any other assertion keyword fails, so the checker cannot silently
+// fall behind the schema.
+func validate(root, s map[string]any, v any, path string) error {
+	for k, kv := range s {
+		switch k {
+		case "$schema", "$id", "$defs", "title", "description", "examples":
+		case "$ref":
+			ref := strings.TrimPrefix(kv.(string), "#/$defs/")
+			def, ok := root["$defs"].(map[string]any)[ref].(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: unknown $ref %v", path, kv)
+			}
+			if err := validate(root, def, v, path); err != nil {
+				return err
+			}
+		case "type":
+			types, ok := kv.([]any)
+			if !ok {
+				types = []any{kv}
+			}
+			match := false
+			for _, typ := range types {
+				match = match || hasType(v, typ.(string))
+			}
+			if !match {
+				return fmt.Errorf("%s: %T is not of type %v", path, v, kv)
+			}
+		case "const":
+			if !jsonEqual(v, kv) {
+				return fmt.Errorf("%s: %v is not %v", path, v, kv)
+			}
+		case "enum":
+			match := false
+			for _, e := range kv.([]any) {
+				match = match || jsonEqual(v, e)
+			}
+			if !match {
+				return fmt.Errorf("%s: %v is not one of %v", path, v, kv)
+			}
+		case "pattern":
+			if str, ok := v.(string); ok && !regexp.MustCompile(kv.(string)).MatchString(str) {
+				return fmt.Errorf("%s: %q does not match %s", path, str, kv)
+			}
+		case "required":
+			if obj, ok := v.(map[string]any); ok {
+				for _, name := range kv.([]any) {
+					if _, ok := obj[name.(string)]; !ok {
+						return fmt.Errorf("%s: missing %v", path, name)
+					}
+				}
+			}
+		case "properties", "additionalProperties":
+			obj, ok := v.(map[string]any)
+			if !ok || k == "additionalProperties" && s["properties"] != nil {
+				continue
+			}
+			props, _ := s["properties"].(map[string]any)
+			names := make([]string, 0, len(obj))
+			for name := range obj {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				sub, ok := props[name].(map[string]any)
+				if !ok {
+					switch extra := s["additionalProperties"].(type) {
+					case bool:
+						if !extra {
+							return fmt.Errorf("%s: unexpected property %q", path, name)
+						}
+						continue
+					case map[string]any:
+						sub = extra
+					default:
+						continue
+					}
+				}
+				if err := validate(root, sub, obj[name], path+"."+name); err != nil {
+					return err
+				}
+			}
+		case "items":
+			if list, ok := v.([]any); ok {
+				for i, item := range list {
+					if err := validate(root, kv.(map[string]any), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+						return err
+					}
+				}
+			}
+		default:
+			return fmt.Errorf("%s: schema keyword %q is not supported by this test", path, k)
+		}
+	}
+	return nil
+}
+
+func hasType(v any, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	}
+	return false
+}
+
+// jsonEqual compares a decoded result value with a schema value; numbers
+// are json.Number on the result side and float64 on the schema side.
+func jsonEqual(v, s any) bool {
+	if n, ok := v.(json.Number); ok {
+		f, err := n.Float64()
+		sf, ok := s.(float64)
+		return err == nil && ok && f == sf
+	}
+	return v == s
+}
+
+func TestRunJSONPolicyLock(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("POLICYGUARDIAN_STORE", filepath.Join(dir, "store"))
+	snap := filepath.Join(dir, "snap.zip")
+
+	exit, res := runJSON(t, "--json", "policylock", "snapshot", "--out", snap, "--created-at", testCreatedAt, testPolicy)
+	expect(t, res, exit, "OK", "", 0)
+	if res["command"] != "policylock snapshot" {
+		t.Fatalf("unexpected command %v", res["command"])
+	}
+	snapID, _ := result(t, res)["snapshot_id"].(string)
+	if snapID == "" {
+		t.Fatalf("snapshot without snapshot_id: %v", res)
+	}
+
+	exit, res = runJSON(t, "--json", "policylock", "verify", snap)
+	expect(t, res, exit, "VALID", "", 0)
+	if result(t, res)["snapshot_id"] != snapID {
+		t.Fatalf("verify reported snapshot_id %v, want %s", result(t, res)["snapshot_id"], snapID)
+	}
+
+	exit, res = runJSON(t, "--json", "policylock", "show", snap)
+	expect(t, res, exit, "OK", "", 0)
+	if result(t, res)["snapshot_id"] != snapID {
+		t.Fatalf("show reported snapshot_id %v, want %s", result(t, res)["snapshot_id"], snapID)
+	}
+
+	tampered := filepath.Join(dir, "tampered.zip")
+	if err := os.WriteFile(tampered, tamperPack(t, snap), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exit, res = runJSON(t, "--json", "policylock", "verify", tampered)
+	if reason, _ := res["reason"].(string); res["status"] != "INVALID" || reason == "" || exit != 2 {
+		t.Fatalf("tampered pack: got %v %q exit %d", res["status"], reason, exit)
+	}
+
+	warcPath := filepath.Join(dir, "out.warc")
+	exit, res = runJSON(t, "--json", "policylock", "export-warc", "--out", warcPath, snap)
+	expect(t, res, exit, "OK", "", 0)
+	if result(t, res)["snapshot_count"] != json.Number("1") {
+		t.Fatalf("export-warc: unexpected result %v", result(t, res))
+	}
+	bad := filepath.Join(dir, "bad.warc")
+	exit, res = runJSON(t, "--json", "policylock", "export-warc", "--out", bad, snap, tampered)
+	expect(t, res, exit, "INVALID", "policy_body_hash_mismatch", 2)
+	if result(t, res)["pack"] != tampered {
+		t.Fatalf("export-warc: expected pack %s, got %v", tampered, result(t, res))
+	}
+	if _, err := os.Stat(bad); !os.IsNotExist(err) {
+		t.Fatalf("export-warc wrote %s for an invalid pack", bad)
+	}
+	exit, out := capture(t, "policylock", "export-warc", "--out", bad, tampered)
+	if exit != 2 || !strings.HasPrefix(string(out), "INVALID\nreason: policy_body_hash_mismatch\n") {
+		t.Fatalf("export-warc text mode: exit %d output %q", exit, out)
+	}
+
+	other := filepath.Join(dir, "other.zip")
+	exit, res = runJSON(t, "--json", "policylock", "snapshot", "--out", other, "--created-at", testCreatedAt, testPolicyB)
+	expect(t, res, exit, "OK", "", 0)
+	exit, res = runJSON(t, "--json", "policylock", "diff", snap, snap)
+	expect(t, res, exit, "IDENTICAL", "", 0)
+	exit, res = runJSON(t, "--json", "policylock", "diff", snap, other)
+	expect(t, res, exit, "DIFFERENT", "", 0)
+	if result(t, res)["body_identical"] != false {
+		t.Fatalf("diff of different policies reported body_identical %v", result(t, res)["body_identical"])
+	}
+
+	exit, res = runJSON(t, "--json", "policylock", "verify", filepath.Join(dir, "missing.zip"))
+	expect(t, res, exit, "INPUT_ERROR", "", 4)
+	if res["error"] == nil {
+		t.Fatal("input error without error message")
+	}
+	exit, res = runJSON(t, "--json", "policylock", "verify")
+	expect(t, res, exit, "INPUT_ERROR", "", 4)
+	exit, res = runJSON(t, "--json", "policylock", "verify", "--no-such-flag", snap)
+	expect(t, res, exit, "INPUT_ERROR", "", 4)
+
+	// URL-only flags are refused for file snapshots rather than ignored.
+	for _, flags := range [][]string{
+		{"--header", "X-Tenant: acme"},
+		{"--bearer-token-file", testPolicy},
+		{"--client-cert", testPolicy},
+		{"--client-key", testPolicy},
+		{"--ca-bundle", testPolicy},
+		{"--proxy", "http://127.0.0.1:3128"},
+		{"--timeout", "5s"},
+		{"--tls-min-version", "1.3"},
+		{"--tls-chain"},
+		{"--with-resources"},
+	} {
+		out := filepath.Join(dir, "url-only.zip")
+		args := append(append([]string{"--json", "policylock", "snapshot", "--out", out}, flags...), testPolicy)
+		exit, res = runJSON(t, args...)
+		expect(t, res, exit, "INPUT_ERROR", "", 4)
+		if msg, _ := res["error"].(string); !strings.Contains(msg, "require") || !strings.Contains(msg, "--url") {
+			t.Fatalf("%s: unexpected error %q", flags[0], msg)
+		}
+		if _, err := os.Stat(out); !os.IsNotExist(err) {
+			t.Fatalf("%s: snapshot written without --url", flags[0])
+		}
+	}
+}
+
+// tamperPack rewrites the policy body of a pack without updating its hashes.
+func tamperPack(t *testing.T, path string) []byte {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	tampered := false
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Name == "policy_body.bin" {
+			b = append(b, " tampered"...)
+			tampered = true
+		}
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(b)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !tampered {
+		t.Fatal("pack has no policy body to tamper with")
+	}
+	return buf.Bytes()
+}
+
+func TestRunJSONConsent(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("POLICYGUARDIAN_STORE", filepath.Join(dir, "store"))
+	snap := filepath.Join(dir, "snap.zip")
+	exit, res := runJSON(t, "--json", "policylock", "snapshot", "--out", snap, "--created-at", testCreatedAt, testPolicy)
+	expect(t, res, exit, "OK", "", 0)
+	snapID := result(t, res)["snapshot_id"]
+
+	key := filepath.Join(dir, "key.pem")
+	exit, res = runJSON(t, "--json", "keys", "generate", "--out", key)
+	expect(t, res, exit, "OK", "", 0)
+
+	// Unsigned events verify, with a warning.
+	unsigned := filepath.Join(dir, "unsigned.json")
+	exit, res = runJSON(t, "--json", "consent", "record", "--subject", "alice@example.com", "--tenant-salt", "bb", "--pepper", "aa",
+		"--created-at", "2026-01-01T00:00:01Z", "--out", unsigned, snap)
+	expect(t, res, exit, "OK", "", 0)
+	if result(t, res)["snapshot_id"] != snapID || result(t, res)["out"] != unsigned {
+		t.Fatalf("unexpected record result %v", result(t, res))
+	}
+	exit, res = runJSON(t, "--json", "consent", "verify", unsigned)
+	expect(t, res, exit, "VALID", "", 0)
+	if w, _ := res["warnings"].([]any); len(w) != 1 || w[0] != "unsigned_consent" {
+		t.Fatalf("unsigned consent: unexpected warnings %v", res["warnings"])
+	}
+
+	signed := filepath.Join(dir, "signed.json")
+	exit, res = runJSON(t, "--json", "consent", "record", "--subject", "alice@example.com", "--tenant-salt", "bb", "--pepper", "aa",
+		"--created-at", "2026-01-01T00:00:01Z", "--sign-key", key, "--out", signed, snap)
+	expect(t, res, exit, "OK", "", 0)
+	consentID := result(t, res)["consent_event_id"]
+	exit, res = runJSON(t, "--json", "consent", "verify", signed)
+	expect(t, res, exit, "VALID", "", 0)
+	if result(t, res)["consent_event_id"] != consentID || result(t, res)["snapshot_id"] != snapID {
+		t.Fatalf("verify reported %v, want consent %v snapshot %v", result(t, res), consentID, snapID)
+	}
+	if res["warnings"] != nil {
+		t.Fatalf("signed consent: unexpected warnings %v", res["warnings"])
+	}
+
+	b, err := os.ReadFile(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, bytes.Replace(b, []byte("2026-01-01T00:00:01Z"), []byte("2026-01-01T00:00:02Z"), 1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exit, res = runJSON(t, "--json", "consent", "verify", bad)
+	if reason, _ := res["reason"].(string); res["status"] != "INVALID" || reason == "" || exit != 2 {
+		t.Fatalf("altered consent: got %v %q exit %d", res["status"], reason, exit)
+	}
+
+	exit, res = runJSON(t, "--json", "consent", "record", "--subject", "alice@example.com", snap)
+	expect(t, res, exit, "INPUT_ERROR", "", 4)
+}
+
+func TestRunJSONFlagPosition(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("POLICYGUARDIAN_STORE", filepath.Join(dir, "store"))
+	snap := filepath.Join(dir, "snap.zip")
+	exit, res := runJSON(t, "policylock", "snapshot", "--json", "--out", snap, "--created-at", testCreatedAt, testPolicy)
+	expect(t, res, exit, "OK", "", 0)
+
+	for _, args := range [][]string{
+		{"--json", "policylock", "verify", snap},
+		{"-json", "policylock", "verify", snap},
+		{"policylock", "--json", "verify", snap},
+		{"policylock", "verify", "--json", snap},
+	} {
+		exit, res := runJSON(t, args...)
+		expect(t, res, exit, "VALID", "", 0)
+	}
+	exit, res = runJSON(t, "--json", "version")
+	expect(t, res, exit, "OK", "", 0)
+
+	// Without --json the output stays text.
+	exit, out := capture(t, "policylock", "verify", snap)
+	if exit != 0 || !strings.HasPrefix(string(out), "VALID\n") {
+		t.Fatalf("text mode: exit %d output %q", exit, out)
+	}
+	// After the command's positional arguments --json is not a flag.
+	exit, _ = capture(t, "policylock", "verify", snap, "--json")
+	if exit != 4 {
+		t.Fatalf("trailing --json: exit %d, want 4", exit)
+	}
+}
+
+func TestStripGlobalFlags(t *testing.T) {
+	for _, tc := range []struct {
+		in   []string
+		want []string
+		json bool
+	}{
+		{[]string{"policylock", "verify", "a.zip"}, []string{"policylock", "verify", "a.zip"}, false},
+		{[]string{"--json", "policylock", "verify", "a.zip"}, []string{"policylock", "verify", "a.zip"}, true},
+		{[]string{"policylock", "-json", "verify", "a.zip"}, []string{"policylock", "verify", "a.zip"}, true},
+		{[]string{"policylock", "verify", "--json", "a.zip"}, []string{"policylock", "verify", "--json", "a.zip"}, false},
+	} {
+		jsonOutput = false
+		got := stripGlobalFlags(tc.in)
+		if strings.Join(got, " ") != strings.Join(tc.want, " ") || jsonOutput != tc.json {
+			t.Fatalf("%v: got %v json=%v, want %v json=%v", tc.in, got, jsonOutput, tc.want, tc.json)
+		}
+	}
+	jsonOutput = false
+}
+
+func TestValidateResultRejects(t *testing.T) {
+	id := strings.Repeat("ab", 32)
+	ok := `{"schema":"policyguardian.cli_result.v0.1","command":"policylock verify","status":"VALID","exit_code":0,"result":{"snapshot_id":"` + id + `"}}`
+	for _, tc := range []struct{ old, new string }{
+		{"", ""},
+		{`"VALID"`, `"FINE"`},
+		{`"exit_code":0`, `"exit_code":7`},
+		{`"exit_code":0`, `"exit_code":0,"reason":"Bad Reason"`},
+		{`"exit_code":0`, `"exit_code":0,"extra":1`},
+		{`"schema":"policyguardian.cli_result.v0.1",`, ""},
+		{id, "not-a-hash"},
+		{`"result":{`, `"result":{"http_status":"200",`},
+	} {
+		var v map[string]any
+		dec := json.NewDecoder(strings.NewReader(strings.Replace(ok, tc.old, tc.new, 1)))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		err := validateResult(t, v)
+		if (tc.old == "") != (err == nil) {
+			t.Fatalf("%q -> %q: validate returned %v", tc.old, tc.new, err)
+		}
+	}
+}
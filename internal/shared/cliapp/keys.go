@@ -0,0 +1,309 @@
+package cliapp
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"strings"
+
+	"policyguardian/internal/shared/extsigner"
+	"policyguardian/internal/shared/keys"
+	"policyguardian/internal/shared/sigenv"
+)
+
+// Passphrases are read from a file or, failing that, from these variables;
+// never from argv.
+const (
+	passphraseEnv    = "POLICYGUARDIAN_KEY_PASSPHRASE"
+	newPassphraseEnv = "POLICYGUARDIAN_NEW_KEY_PASSPHRASE"
+)
+
+// passphrase returns the contents of file, else $env, else nil.
+func passphrase(file, env string) ([]byte, error) {
+	if file != "" {
+		return keys.ReadPassphrase(file)
+	}
+	if v := os.Getenv(env); v != "" {
+		return []byte(v), nil
+	}
+	return nil, nil
+}
+
+// signingFlags are the key flags of every command that signs.
+type signingFlags struct {
+	keyFile  string
+	passFile string
+	privHex  string
+	certFile string
+	external string
+}
+
+func (s *signingFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.keyFile, "sign-key", "", "Signing key file (PKCS#8 PEM, encrypted PKCS#8 PEM, OpenSSH or OpenSSL EC/RSA PEM)")
+	fs.StringVar(&s.passFile, "passphrase-file", "", "File holding the --sign-key passphrase (default $"+passphraseEnv+")")
+	fs.StringVar(&s.privHex, "sign-privkey", "", "Ed25519 private key hex (deprecated: visible in process listings; use --sign-key)")
+	fs.StringVar(&s.external, "signer", "", "External signer: plugin:<executable> or ssh-agent[:<key_id|comment>]")
+}
+
+// registerCert adds --sign-cert, for commands whose envelopes may carry
+// the signer's certificate chain.
+func (s *signingFlags) registerCert(fs *flag.FlagSet) {
+	fs.StringVar(&s.certFile, "sign-cert", "", "PEM certificate chain (leaf first) of the signing key, embedded in the signature envelope")
+}
+
+// certChain loads --sign-cert; it returns nil when the flag is not set.
+func (s *signingFlags) certChain() ([]*x509.Certificate, error) {
+	if s.certFile == "" {
+		return nil, nil
+	}
+	return sigenv.LoadCertChain(s.certFile)
+}
+
+// signer loads the selected key; it returns nil when no key flag is set.
+func (s *signingFlags) signer(r *report) (crypto.Signer, error) {
+	if s.privHex != "" {
+		r.warn("sign_privkey_in_argv", "use --sign-key <file>")
+	}
+	if s.passFile != "" && s.keyFile == "" {
+		return nil, errors.New("--passphrase-file requires --sign-key")
+	}
+	pass, err := passphrase(s.passFile, passphraseEnv)
+	if err != nil {
+		return nil, err
+	}
+	if s.external == "" {
+		return sigenv.ResolveSigner(nil, s.keyFile, pass, s.privHex)
+	}
+	if s.keyFile != "" || s.privHex != "" {
+		return nil, errors.New("--signer cannot be combined with --sign-key or --sign-privkey")
+	}
+	return extsigner.Parse(s.external)
+}
+
+func runKeys(argv []string) int {
+	if len(argv) == 0 {
+		usage()
+		return 4
+	}
+	switch argv[0] {
+	case "generate":
+		return cmdKeysGenerate(argv[1:])
+	case "show":
+		return cmdKeysShow(argv[1:])
+	case "export":
+		return cmdKeysConvert("keys export", keys.FormatPublic, argv[1:])
+	case "import":
+		return cmdKeysConvert("keys import", keys.FormatPKCS8, argv[1:])
+	default:
+		usage()
+		return 4
+	}
+}
+
+// keyFields prints what identifies a key.
+func keyFields(r *report, pub crypto.PublicKey) error {
+	id, err := keys.KeyID(pub)
+	if err != nil {
+		return err
+	}
+	alg, err := keys.Algorithm(pub)
+	if err != nil {
+		return err
+	}
+	ssh, err := keys.MarshalPublic(pub, keys.FormatSSHPublic, "")
+	if err != nil {
+		return err
+	}
+	pemBytes, err := keys.MarshalPublic(pub, keys.FormatPublic, "")
+	if err != nil {
+		return err
+	}
+	pubHex, err := keys.PublicKeyHex(pub)
+	if err != nil {
+		return err
+	}
+	r.field("key_id", id)
+	r.field("algorithm", alg)
+	r.field("public_key", pubHex)
+	r.field("ssh_public_key", strings.TrimSpace(string(ssh)))
+	r.set("public_key_pem", string(pemBytes))
+	return nil
+}
+
+func cmdKeysGenerate(argv []string) int {
+	r := newReport("keys generate")
+	fs := newFlagSet("keys generate")
+	var outPath, format, passFile, alg string
+	fs.StringVar(&outPath, "out", "signing_key.pem", "Output key file (never overwritten; mode 0600)")
+	fs.StringVar(&alg, "algorithm", keys.AlgEd25519, "Key algorithm: "+strings.Join(keys.Algorithms, "|"))
+	fs.StringVar(&format, "format", keys.FormatPKCS8, "Key file format: pkcs8|pkcs8-encrypted|openssh")
+	fs.StringVar(&passFile, "passphrase-file", "", "File holding the passphrase for pkcs8-encrypted (default $"+passphraseEnv+")")
+	if !r.parse(fs, argv) {
+		return 4
+	}
+	if fs.NArg() != 0 {
+		return r.usage("unexpected arguments")
+	}
+	pass, err := passphrase(passFile, passphraseEnv)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	key, err := keys.Generate(alg)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	data, err := keys.Marshal(key, format, pass)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	if err := keys.WriteFile(outPath, data); err != nil {
+		return r.fail(4, err)
+	}
+	r.status("OK")
+	r.field("out", outPath)
+	r.field("format", format)
+	if err := keyFields(r, key.Public()); err != nil {
+		return r.fail(4, err)
+	}
+	return r.done(0)
+}
+
+func cmdKeysShow(argv []string) int {
+	r := newReport("keys show")
+	fs := newFlagSet("keys show")
+	var passFile string
+	fs.StringVar(&passFile, "passphrase-file", "", "File holding the key passphrase (default $"+passphraseEnv+")")
+	if !r.parse(fs, argv) {
+		return 4
+	}
+	if fs.NArg() != 1 {
+		return r.usage("missing <key file>")
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return r.fail(4, err)
+	}
+	pass, err := passphrase(passFile, passphraseEnv)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	var pub crypto.PublicKey
+	format := keys.FormatPublic
+	key, f, err := keys.ParsePrivate(data, pass)
+	switch {
+	case err == nil:
+		pub, format = key.Public(), f
+	case errors.Is(err, keys.ErrPassphraseRequired) || errors.Is(err, keys.ErrBadPassphrase):
+		return r.fail(4, err)
+	default:
+		if pub, err = keys.ParsePublic(data); err != nil {
+			return r.fail(4, err)
+		}
+	}
+	r.status("OK")
+	r.field("format", format)
+	r.field("private", key != nil)
+	if err := keyFields(r, pub); err != nil {
+		return r.fail(4, err)
+	}
+	return r.done(0)
+}
+
+// cmdKeysConvert implements import (foreign key -> key file) and export
+// (key file -> public key or another private format). They differ in the
+// default format; private formats must go to --out.
+func cmdKeysConvert(name, defFormat string, argv []string) int {
+	r := newReport(name)
+	fs := newFlagSet(name)
+	var outPath, format, passFile, newPassFile, comment string
+	fs.StringVar(&outPath, "out", "", "Output file (never overwritten); public formats default to stdout")
+	fs.StringVar(&format, "format", defFormat, "Output format: pkcs8|pkcs8-encrypted|openssh|public|ssh-public")
+	fs.StringVar(&passFile, "passphrase-file", "", "File holding the passphrase of the input key (default $"+passphraseEnv+")")
+	fs.StringVar(&newPassFile, "new-passphrase-file", "", "File holding the passphrase for pkcs8-encrypted output (default $"+newPassphraseEnv+", else the input passphrase)")
+	fs.StringVar(&comment, "comment", "", "Comment appended to ssh-public output")
+	if !r.parse(fs, argv) {
+		return 4
+	}
+	if fs.NArg() != 1 {
+		return r.usage("missing <key file> (- reads stdin)")
+	}
+	public := format == keys.FormatPublic || format == keys.FormatSSHPublic
+	if !public && outPath == "" {
+		return r.usage("private key formats require --out")
+	}
+	var data []byte
+	var err error
+	if fs.Arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		return r.fail(4, err)
+	}
+	pass, err := passphrase(passFile, passphraseEnv)
+	if err != nil {
+		return r.fail(4, err)
+	}
+
+	var pub crypto.PublicKey
+	var out []byte
+	key, from, err := keys.ParsePrivate(data, pass)
+	if public {
+		if err != nil && !errors.Is(err, keys.ErrPassphraseRequired) && !errors.Is(err, keys.ErrBadPassphrase) {
+			if pub, err = keys.ParsePublic(data); err == nil {
+				from = keys.FormatPublic
+			}
+		} else if err == nil {
+			pub = key.Public()
+		}
+		if err != nil {
+			return r.fail(4, err)
+		}
+		out, err = keys.MarshalPublic(pub, format, comment)
+	} else {
+		if err != nil {
+			return r.fail(4, err)
+		}
+		pub = key.Public()
+		newPass, perr := passphrase(newPassFile, newPassphraseEnv)
+		if perr != nil {
+			return r.fail(4, perr)
+		}
+		if newPass == nil {
+			newPass = pass
+		}
+		out, err = keys.Marshal(key, format, newPass)
+	}
+	if err != nil {
+		return r.fail(4, err)
+	}
+	if outPath == "" && !jsonOutput {
+		// Like store get: only the key on stdout, so it can be redirected.
+		os.Stdout.Write(out)
+		return 0
+	}
+	if outPath != "" {
+		if err := keys.WriteFile(outPath, out); err != nil {
+			return r.fail(4, err)
+		}
+	}
+	r.status("OK")
+	if from == keys.FormatPKCS8Encrypted && (format == keys.FormatPKCS8 || format == keys.FormatOpenSSH) {
+		r.warn("key_written_unencrypted", outPath)
+	}
+	r.field("input_format", from)
+	r.field("format", format)
+	if outPath != "" {
+		r.field("out", outPath)
+	} else {
+		r.set("data", string(out))
+	}
+	if err := keyFields(r, pub); err != nil {
+		return r.fail(4, err)
+	}
+	return r.done(0)
+}
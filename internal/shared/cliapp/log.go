@@ -0,0 +1,194 @@
+package cliapp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"policyguardian/internal/translog"
+)
+
+func defaultLogDir() string {
+	return filepath.Join(storeDir(), "log")
+}
+
+// appendToLog appends kind/id to the log in dir and writes the inclusion
+// proof next to the artifact as <artifactPath>.inclusion.json.
+func appendToLog(dir, kind, id, artifactPath string) (string, error) {
+	l, err := translog.Open(dir)
+	if err != nil {
+		return "", err
+	}
+	p, err := l.Append(kind, id)
+	if err != nil {
+		return "", err
+	}
+	b, err := translog.MarshalProof(p)
+	if err != nil {
+		return "", err
+	}
+	proofPath := artifactPath + ".inclusion.json"
+	if err := os.WriteFile(proofPath, b, 0644); err != nil {
+		return "", err
+	}
+	return proofPath, nil
+}
+
+func runLog(argv []string) int {
+	if len(argv) == 0 {
+		usage()
+		return 4
+	}
+	switch argv[0] {
+	case "sth":
+		return cmdLogSTH(argv[1:])
+	case "prove-consistency":
+		return cmdLogProveConsistency(argv[1:])
+	case "verify-inclusion":
+		return cmdLogVerifyInclusion(argv[1:])
+	case "verify-consistency":
+		return cmdLogVerifyConsistency(argv[1:])
+	default:
+		usage()
+		return 4
+	}
+}
+
+func cmdLogSTH(argv []string) int {
+	r := newReport("log sth")
+	fs := newFlagSet("log sth")
+	var dir string
+	fs.StringVar(&dir, "log-dir", defaultLogDir(), "Transparency log directory")
+	if !r.parse(fs, argv) {
+		return 4
+	}
+	l, err := translog.Open(dir)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	sth, err := l.Latest()
+	if err != nil {
+		return r.fail(4, err)
+	}
+	r.res.Status = "OK"
+	r.field("tree_size", sth.TreeHead.TreeSize)
+	r.field("root_hash", sth.TreeHead.RootHash)
+	r.field("timestamp_utc", sth.TreeHead.TimestampUTC)
+	r.field("log_id", sth.TreeHead.LogID)
+	r.field("log_public_key", l.PublicKeyHex())
+	return r.done(0)
+}
+
+func cmdLogProveConsistency(argv []string) int {
+	r := newReport("log prove-consistency")
+	fs := newFlagSet("log prove-consistency")
+	var dir string
+	var from, to uint64
+	var outPath string
+	fs.StringVar(&dir, "log-dir", defaultLogDir(), "Transparency log directory")
+	fs.Uint64Var(&from, "from", 0, "Older tree size")
+	fs.Uint64Var(&to, "to", 0, "Newer tree size (default: latest)")
+	fs.StringVar(&outPath, "out", "consistency_proof.json", "Output proof json")
+	if !r.parse(fs, argv) {
+		return 4
+	}
+	l, err := translog.Open(dir)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	if to == 0 {
+		sth, err := l.Latest()
+		if err != nil {
+			return r.fail(4, err)
+		}
+		to = sth.TreeHead.TreeSize
+	}
+	p, err := l.ProveConsistency(from, to)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	b, err := translog.MarshalProof(p)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	if err := os.WriteFile(outPath, b, 0644); err != nil {
+		return r.fail(4, err)
+	}
+	r.status("OK")
+	r.field("from", from)
+	r.field("to", to)
+	r.field("out", outPath)
+	return r.done(0)
+}
+
+func cmdLogVerifyInclusion(argv []string) int {
+	r := newReport("log verify-inclusion")
+	fs := newFlagSet("log verify-inclusion")
+	var pub string
+	fs.StringVar(&pub, "log-pubkey", "", "Expected log public key hex")
+	if !r.parse(fs, argv) {
+		return 4
+	}
+	if fs.NArg() != 1 {
+		return r.usage("missing <proof.json>")
+	}
+	var p translog.InclusionProof
+	if code := readProof(r, fs.Arg(0), &p); code != 0 {
+		return code
+	}
+	reason := translog.VerifyInclusionProof(&p, pub)
+	if reason != "" {
+		r.status("INVALID")
+		r.reason(reason)
+		return r.done(2)
+	}
+	r.status("VALID")
+	r.field("kind", p.Kind)
+	r.field("id", p.ID)
+	r.field("leaf_index", p.LeafIndex)
+	r.field("tree_size", p.SignedTreeHead.TreeHead.TreeSize)
+	r.field("root_hash", p.SignedTreeHead.TreeHead.RootHash)
+	r.field("log_public_key", p.SignedTreeHead.Signature.PublicKey)
+	return r.done(0)
+}
+
+func cmdLogVerifyConsistency(argv []string) int {
+	r := newReport("log verify-consistency")
+	fs := newFlagSet("log verify-consistency")
+	var pub string
+	fs.StringVar(&pub, "log-pubkey", "", "Expected log public key hex")
+	if !r.parse(fs, argv) {
+		return 4
+	}
+	if fs.NArg() != 1 {
+		return r.usage("missing <proof.json>")
+	}
+	var p translog.ConsistencyProof
+	if code := readProof(r, fs.Arg(0), &p); code != 0 {
+		return code
+	}
+	reason := translog.VerifyConsistencyProof(&p, pub)
+	if reason != "" {
+		r.status("INVALID")
+		r.reason(reason)
+		return r.done(2)
+	}
+	r.status("VALID")
+	r.field("old_tree_size", p.Old.TreeHead.TreeSize)
+	r.field("new_tree_size", p.New.TreeHead.TreeSize)
+	r.field("log_public_key", p.New.Signature.PublicKey)
+	return r.done(0)
+}
+
+func readProof(r *report, path string, v any) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		r.status("INVALID")
+		r.reason("invalid_proof_json")
+		return r.done(2)
+	}
+	return 0
+}
@@ -0,0 +1,178 @@
+package cliapp
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// SchemaCLIResult identifies the --json output object
+// (schemas/cli_result_v0_1.schema.json).
+const SchemaCLIResult = "policyguardian.cli_result.v0.1"
+
+// jsonOutput is set by the global --json flag.
+var jsonOutput bool
+
+// jsonFlag sets jsonOutput without resetting it on registration, so a
+// global --json given before the command survives.
+type jsonFlag struct{}
+
+func (jsonFlag) String() string   { return "false" }
+func (jsonFlag) IsBoolFlag() bool { return true }
+func (jsonFlag) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	jsonOutput = v
+	return nil
+}
+
+// newFlagSet returns a ContinueOnError flag set that also accepts --json.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Var(jsonFlag{}, "json", "Emit one JSON result object on stdout")
+	return fs
+}
+
+// cliResult is the object printed by a command in --json mode.
+type cliResult struct {
+	Schema   string         `json:"schema"`
+	Command  string         `json:"command"`
+	Status   string         `json:"status"`
+	Reason   string         `json:"reason,omitempty"`
+	ExitCode int            `json:"exit_code"`
+	Error    string         `json:"error,omitempty"`
+	Warnings []string       `json:"warnings,omitempty"`
+	Result   map[string]any `json:"result,omitempty"`
+}
+
+// report is a command's output. In text mode every call prints immediately,
+// exactly as the commands always have; in --json mode everything is
+// collected and done prints a single cliResult.
+type report struct {
+	res cliResult
+}
+
+func newReport(command string) *report {
+	return &report{res: cliResult{Schema: SchemaCLIResult, Command: command, Result: map[string]any{}}}
+}
+
+// status prints the first output line (VALID, OK, ...).
+func (r *report) status(s string) {
+	r.res.Status = s
+	if !jsonOutput {
+		fmt.Println(s)
+	}
+}
+
+func (r *report) reason(s string) {
+	if s == "" {
+		return
+	}
+	r.res.Reason = s
+	if !jsonOutput {
+		fmt.Println("reason:", s)
+	}
+}
+
+// field prints "key: value" and becomes result[key] in JSON.
+func (r *report) field(key string, v any) {
+	r.res.Result[key] = v
+	if !jsonOutput {
+		fmt.Println(key+":", v)
+	}
+}
+
+// item prints "key: text" and appends v to result[jsonKey] in JSON.
+func (r *report) item(key, text, jsonKey string, v any) {
+	list, _ := r.res.Result[jsonKey].([]any)
+	r.res.Result[jsonKey] = append(list, v)
+	if !jsonOutput {
+		fmt.Println(key+":", text)
+	}
+}
+
+// set adds a JSON-only result value.
+func (r *report) set(key string, v any) {
+	r.res.Result[key] = v
+}
+
+// text prints human-only output that has no JSON counterpart.
+func (r *report) text(s string) {
+	if !jsonOutput {
+		fmt.Print(s)
+	}
+}
+
+// warn prints "WARNING: code" on stderr; detail (a file, a URL) is appended.
+func (r *report) warn(code string, detail ...any) {
+	msg := code
+	if len(detail) > 0 {
+		msg += ": " + fmt.Sprint(detail...)
+	}
+	r.res.Warnings = append(r.res.Warnings, msg)
+	if !jsonOutput {
+		fmt.Fprintln(os.Stderr, "WARNING:", msg)
+	}
+}
+
+// errorStatus maps the error exit codes to their labels.
+var errorStatus = map[int][2]string{
+	3: {"UNSUPPORTED", "UNSUPPORTED"},
+	4: {"INPUT ERROR", "INPUT_ERROR"},
+	5: {"NETWORK ERROR", "NETWORK_ERROR"},
+}
+
+// fail reports err under the label for exit (3, 4 or 5) and finishes.
+func (r *report) fail(exit int, err any) int {
+	label := errorStatus[exit]
+	r.res.Status = label[1]
+	r.res.Error = fmt.Sprint(err)
+	if !jsonOutput {
+		fmt.Fprintln(os.Stderr, label[0]+":", err)
+	}
+	return r.done(exit)
+}
+
+// usage reports a missing or malformed argument (exit 4). Text mode prints
+// msg on stderr without a label, as before.
+func (r *report) usage(msg string) int {
+	r.res.Status = errorStatus[4][1]
+	r.res.Error = msg
+	if !jsonOutput {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+	return r.done(4)
+}
+
+// parse parses argv into fs; a flag error is reported as a usage error.
+func (r *report) parse(fs *flag.FlagSet, argv []string) bool {
+	if err := fs.Parse(argv); err != nil {
+		r.res.Status = errorStatus[4][1]
+		r.res.Error = err.Error()
+		r.done(4)
+		return false
+	}
+	return true
+}
+
+// done prints the JSON object (in --json mode) and returns exit.
+func (r *report) done(exit int) int {
+	if !jsonOutput {
+		return exit
+	}
+	r.res.ExitCode = exit
+	if len(r.res.Result) == 0 {
+		r.res.Result = nil
+	}
+	b, err := json.MarshalIndent(r.res, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "INPUT ERROR:", err)
+		return 4
+	}
+	fmt.Println(string(b))
+	return exit
+}
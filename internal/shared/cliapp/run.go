@@ -1,23 +1,43 @@
 package cliapp
 
 import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"policyguardian/internal/consentguardian"
 	"policyguardian/internal/policylock"
+	"policyguardian/internal/shared/hashing"
+	"policyguardian/internal/shared/keys"
+	"policyguardian/internal/shared/timefmt"
+	"policyguardian/internal/shared/tsa"
 	"policyguardian/internal/shared/version"
+	"policyguardian/internal/shared/warc"
+	"policyguardian/internal/store"
+	"policyguardian/internal/translog"
 )
 
 func Run(argv []string) int {
+	argv = stripGlobalFlags(argv)
 	if len(argv) == 0 {
 		usage()
 		return 4
 	}
 	if argv[0] == "--version" || argv[0] == "version" {
+		if jsonOutput {
+			r := newReport("version")
+			r.status("OK")
+			r.set("version", version.Version)
+			return r.done(0)
+		}
 		fmt.Println("policyguardian " + version.Version)
 		return 0
 	}
@@ -26,20 +46,64 @@ func Run(argv []string) int {
 		return runPolicyLock(argv[1:])
 	case "consent":
 		return runConsent(argv[1:])
+	case "log":
+		return runLog(argv[1:])
+	case "store":
+		return runStore(argv[1:])
+	case "tsa":
+		return runTSA(argv[1:])
+	case "keys":
+		return runKeys(argv[1:])
 	default:
 		usage()
 		return 4
 	}
 }
 
+// stripGlobalFlags removes --json given before the command group or between
+// the group and the command (the Mode B wrappers prepend the group), so
+// "policyguardian --json policylock verify" and "policylock --json verify"
+// both work. After the command it is an ordinary flag of that command.
+func stripGlobalFlags(argv []string) []string {
+	out := make([]string, 0, len(argv))
+	for _, a := range argv {
+		if len(out) < 2 && (a == "--json" || a == "-json") {
+			jsonOutput = true
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
 func usage() {
 	fmt.Fprintln(os.Stderr, "Usage:")
 	fmt.Fprintln(os.Stderr, "  policyguardian --version")
-	fmt.Fprintln(os.Stderr, "  policyguardian policylock snapshot <file>|--url <url>|--stdin [--out <zip>] [--created-at <ts>]")
-	fmt.Fprintln(os.Stderr, "  policyguardian policylock verify <snapshot.zip>")
+	fmt.Fprintln(os.Stderr, "  policyguardian --json <command> ...   (one JSON result object on stdout; --json may also follow the command)")
+	fmt.Fprintln(os.Stderr, "  policyguardian policylock snapshot <file>|--url <url>|--stdin [--out <zip>] [--created-at <ts>] [--sign-key <file> [--passphrase-file <file>]|--signer <spec>] [--tsa-url <url>] [--log-dir <dir>]")
+	fmt.Fprintln(os.Stderr, "  policyguardian policylock verify [--tsa-roots <pem>] <snapshot.zip>")
 	fmt.Fprintln(os.Stderr, "  policyguardian policylock show <snapshot.zip>")
-	fmt.Fprintln(os.Stderr, "  policyguardian consent record <snapshot.zip|snapshot_id> --subject <id> --tenant-salt <hex> --pepper <hex> [--out <consent.json>] [--created-at <ts>] [--sign-privkey <hex>]")
-	fmt.Fprintln(os.Stderr, "  policyguardian consent verify <consent.json> [--resolve-snapshot]")
+	fmt.Fprintln(os.Stderr, "  policyguardian policylock diff <a.zip> <b.zip>")
+	fmt.Fprintln(os.Stderr, "  policyguardian policylock watch --watchlist <file> [--interval <dur>] [--once] [--max-bytes <n>]")
+	fmt.Fprintln(os.Stderr, "  policyguardian policylock export-warc [--out <file.warc>] [--gzip] <snapshot.zip>...")
+	fmt.Fprintln(os.Stderr, "  policyguardian policylock import-warc [--out-dir <dir>] [--created-at <ts>] [--sign-key <file> [--passphrase-file <file>]|--signer <spec>] <file.warc[.gz]>")
+	fmt.Fprintln(os.Stderr, "  policyguardian consent record <snapshot.zip|snapshot_id> --subject <id> --tenant-salt <hex> --pepper <hex> [--out <consent.json>] [--created-at <ts>] [--sign-key <file> [--passphrase-file <file>]|--signer <spec> [--sign-cert <pem>]] [--tsa-url <url>] [--log-dir <dir>]")
+	fmt.Fprintln(os.Stderr, "  policyguardian consent record-batch <snapshot.zip|snapshot_id> --input <rows.jsonl|rows.csv> --tenant-salt <hex> --pepper <hex> (--out-dir <dir>|--out-jsonl <file>) [--format jsonl|csv] [--created-at <ts>] [--sign-key <file> [--passphrase-file <file>]|--signer <spec> [--sign-cert <pem>]] [--workers <n>]")
+	fmt.Fprintln(os.Stderr, "  policyguardian consent revoke <consent.json> [--out <revocation.json>] [--created-at <ts>] [--reason <text>] [--sign-key <file> [--passphrase-file <file>]|--signer <spec> [--sign-cert <pem>]] [--tsa-url <url>] [--log-dir <dir>]")
+	fmt.Fprintln(os.Stderr, "  policyguardian consent verify <consent.json|revocation.json> [--resolve-snapshot] [--tsa-roots <pem>] [--trusted-keys <keyring.json>] [--roots <pem>]")
+	fmt.Fprintln(os.Stderr, "  policyguardian consent verify --at <ts> [--consent-id <id>] [--trusted-keys <keyring.json>] [--roots <pem>] <event.json>...")
+	fmt.Fprintln(os.Stderr, "  policyguardian log sth [--log-dir <dir>]")
+	fmt.Fprintln(os.Stderr, "  policyguardian log prove-consistency --from <size> [--to <size>] [--out <proof.json>] [--log-dir <dir>]")
+	fmt.Fprintln(os.Stderr, "  policyguardian log verify-inclusion <proof.json> [--log-pubkey <hex>]")
+	fmt.Fprintln(os.Stderr, "  policyguardian log verify-consistency <proof.json> [--log-pubkey <hex>]")
+	fmt.Fprintln(os.Stderr, "  policyguardian store ls [--kind snapshot|consent_event]")
+	fmt.Fprintln(os.Stderr, "  policyguardian store get [--kind snapshot|consent_event] [--out <file>] <id>")
+	fmt.Fprintln(os.Stderr, "  policyguardian store fsck [--verify] [--reindex]")
+	fmt.Fprintln(os.Stderr, "  policyguardian keys generate [--algorithm ed25519|ecdsa-p256-sha256|rsa-pss-sha256] [--out <key.pem>] [--format pkcs8|pkcs8-encrypted|openssh] [--passphrase-file <file>]")
+	fmt.Fprintln(os.Stderr, "  policyguardian keys show [--passphrase-file <file>] <key file>")
+	fmt.Fprintln(os.Stderr, "  policyguardian keys export [--format public|ssh-public|pkcs8|pkcs8-encrypted|openssh] [--out <file>] [--passphrase-file <file>] [--new-passphrase-file <file>] <key file>")
+	fmt.Fprintln(os.Stderr, "  policyguardian keys import [--format pkcs8|pkcs8-encrypted|openssh] --out <key file> [--passphrase-file <file>] [--new-passphrase-file <file>] <key file|->")
+	fmt.Fprintln(os.Stderr, "  policyguardian tsa serve [--addr <host:port>] [--dir <dir>]")
 }
 
 func runPolicyLock(argv []string) int {
@@ -54,6 +118,14 @@ func runPolicyLock(argv []string) int {
 		return cmdPolicyVerify(argv[1:])
 	case "show":
 		return cmdPolicyShow(argv[1:])
+	case "diff":
+		return cmdPolicyDiff(argv[1:])
+	case "watch":
+		return cmdPolicyWatch(argv[1:])
+	case "export-warc":
+		return cmdPolicyExportWARC(argv[1:])
+	case "import-warc":
+		return cmdPolicyImportWARC(argv[1:])
 	default:
 		usage()
 		return 4
@@ -61,93 +133,360 @@ func runPolicyLock(argv []string) int {
 }
 
 func cmdPolicySnapshot(argv []string) int {
-	fs := flag.NewFlagSet("policylock snapshot", flag.ContinueOnError)
+	r := newReport("policylock snapshot")
+	fs := newFlagSet("policylock snapshot")
 	var urlStr string
 	var useStdin bool
 	var outPath string
 	var createdAt string
 	var maxBytes int64
+	var signing signingFlags
+	var tsaURL string
+	var logDir string
+	var tlsChain bool
+	var headerDeny string
+	var headers stringList
+	var headerFile, cookieFile, bearerFile, redactionSalt string
+	var clientCert, clientKey, caBundle, proxyURL, tlsMin string
+	var timeout time.Duration
+	var bundlePath string
+	var dirPath, gitSource string
+	var withResources bool
+	var resourceDepth, resourceMaxCount int
+	var resourceMaxBytes int64
+	var include, exclude stringList
 	fs.StringVar(&urlStr, "url", "", "URL to fetch")
+	fs.StringVar(&bundlePath, "bundle", "", "Bundle manifest JSON listing several documents to snapshot together")
+	fs.StringVar(&dirPath, "dir", "", "Directory whose files are snapshotted together")
+	fs.StringVar(&gitSource, "git", "", "Local repository and revision <repo>@<rev> whose tree is snapshotted")
+	fs.Var(&include, "include", "Pattern selecting --dir/--git files by path or base name (repeatable)")
+	fs.Var(&exclude, "exclude", "Pattern excluding --dir/--git files by path or base name (repeatable)")
 	fs.BoolVar(&useStdin, "stdin", false, "Read policy bytes from stdin")
 	fs.StringVar(&outPath, "out", "policy_snapshot.zip", "Output snapshot zip")
 	fs.StringVar(&createdAt, "created-at", "", "Created timestamp")
 	fs.Int64Var(&maxBytes, "max-bytes", 0, "Max bytes for URL fetch")
-	if err := fs.Parse(argv); err != nil {
+	signing.register(fs)
+	fs.StringVar(&tsaURL, "tsa-url", "", "RFC 3161 time-stamping authority URL")
+	fs.StringVar(&logDir, "log-dir", "", "Append snapshot_id to the transparency log in this directory")
+	fs.BoolVar(&tlsChain, "tls-chain", false, "Store the TLS certificate chain and OCSP staple in the pack (URL only)")
+	fs.Var(&headers, "header", `Request header "Name: value" for URL fetches (repeatable)`)
+	fs.StringVar(&headerFile, "header-file", "", `File of "Name: value" request headers; values are recorded redacted`)
+	fs.StringVar(&cookieFile, "cookie-file", "", "cookies.txt or raw Cookie header value to send")
+	fs.StringVar(&bearerFile, "bearer-token-file", "", "File holding a bearer token for the Authorization header")
+	fs.StringVar(&redactionSalt, "redaction-salt", "", "Hex salt for redacted header values (default random)")
+	fs.StringVar(&clientCert, "client-cert", "", "PEM client certificate for mutual TLS")
+	fs.StringVar(&clientKey, "client-key", "", "PEM private key of --client-cert")
+	fs.StringVar(&caBundle, "ca-bundle", "", "PEM CA certificates trusted in addition to the system roots")
+	fs.StringVar(&proxyURL, "proxy", "", "Proxy URL (http://, https://, socks5://); default from HTTP(S)_PROXY")
+	fs.DurationVar(&timeout, "timeout", policylock.DefaultFetchTimeout, "Fetch timeout including redirects")
+	fs.StringVar(&tlsMin, "tls-min-version", "", "Minimum TLS version (1.0|1.1|1.2|1.3)")
+	fs.BoolVar(&withResources, "with-resources", false, "Also capture same-origin stylesheets, scripts, frames and images of an HTML page (URL only)")
+	fs.IntVar(&resourceDepth, "resource-depth", policylock.DefaultResourceMaxDepth, "Link depth for --with-resources")
+	fs.Int64Var(&resourceMaxBytes, "resource-max-bytes", policylock.DefaultResourceMaxBytes, "Total body bytes for --with-resources")
+	fs.IntVar(&resourceMaxCount, "resource-max-count", policylock.DefaultResourceMaxCount, "Maximum resources for --with-resources")
+	fs.StringVar(&headerDeny, "response-header-deny", strings.Join(policylock.DefaultResponseHeaderDenyList, ","), "Comma-separated response headers left out of response_headers.json")
+	if !r.parse(fs, argv) {
 		return 4
 	}
 	opts := policylock.SnapshotOptions{
-		CreatedAtUTC: createdAt,
-		ToolVersion:  version.ToolVersion,
-		UserAgent:    version.ToolVersion + " (PolicyLock)",
-		MaxBytes:     maxBytes,
+		CreatedAtUTC:    createdAt,
+		ToolVersion:     version.ToolVersion,
+		UserAgent:       version.ToolVersion + " (PolicyLock)",
+		MaxBytes:        maxBytes,
+		TSAURL:          tsaURL,
+		CaptureTLSChain: tlsChain,
+	}
+	if dirPath == "" && gitSource == "" && (len(include) > 0 || len(exclude) > 0) {
+		return r.usage("--include and --exclude require --dir or --git")
+	}
+	if (dirPath != "" || gitSource != "") && fs.NArg() != 0 {
+		return r.usage("--dir and --git take no <file> arguments")
+	}
+	if urlStr == "" && withResources {
+		return r.usage("--with-resources requires --url")
+	}
+	if urlStr == "" && (len(headers) > 0 || headerFile != "" || cookieFile != "" || bearerFile != "") {
+		return r.usage("--header, --header-file, --cookie-file and --bearer-token-file require --url")
+	}
+	if urlStr == "" {
+		transportSet := false
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "client-cert", "client-key", "ca-bundle", "proxy", "timeout", "tls-min-version", "tls-chain":
+				transportSet = true
+			}
+		})
+		if transportSet {
+			return r.usage("--client-cert, --client-key, --ca-bundle, --proxy, --timeout, --tls-min-version and --tls-chain require --url")
+		}
+	}
+	if urlStr != "" {
+		hs, err := requestHeaders(urlStr, headers, headerFile, cookieFile, bearerFile)
+		if err != nil {
+			return r.fail(4, err)
+		}
+		opts.RequestHeaders = hs
+		opts.RedactionSaltHex = redactionSalt
+		opts.ClientCertFile, opts.ClientKeyFile = clientCert, clientKey
+		opts.CABundleFile = caBundle
+		opts.ProxyURL = proxyURL
+		opts.Timeout = timeout
+		opts.WithResources = withResources
+		opts.ResourceMaxDepth, opts.ResourceMaxBytes, opts.ResourceMaxCount = resourceDepth, resourceMaxBytes, resourceMaxCount
+		if tlsMin != "" {
+			if opts.TLSMinVersion, err = policylock.ParseTLSVersion(tlsMin); err != nil {
+				return r.usage(err.Error())
+			}
+		}
+	}
+	opts.ResponseHeaderDenyList = []string{}
+	for _, h := range strings.Split(headerDeny, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			opts.ResponseHeaderDenyList = append(opts.ResponseHeaderDenyList, h)
+		}
 	}
 
 	var zipBytes []byte
 	var snap *policylock.PolicySnapshot
 	var err error
+	if opts.Signer, err = signing.signer(r); err != nil {
+		return r.fail(4, err)
+	}
 	if useStdin {
 		zipBytes, snap, err = policylock.SnapshotFromStdin(os.Stdin, opts)
 	} else if urlStr != "" {
 		zipBytes, snap, err = policylock.SnapshotFromURL(urlStr, opts)
+	} else if dirPath != "" {
+		zipBytes, snap, err = policylock.SnapshotFromDir(dirPath, include, exclude, opts)
+	} else if gitSource != "" {
+		repo, rev := policylock.ParseGitSource(gitSource)
+		zipBytes, snap, err = policylock.SnapshotFromGit(repo, rev, include, exclude, opts)
+	} else if bundlePath != "" || fs.NArg() > 1 {
+		var docs []policylock.BundleInput
+		if bundlePath != "" {
+			if fs.NArg() != 0 {
+				return r.usage("--bundle takes no <file> arguments")
+			}
+			docs, err = policylock.LoadBundleManifest(bundlePath)
+		} else {
+			docs, err = policylock.BundleInputsFromFiles(fs.Args())
+		}
+		if err == nil {
+			zipBytes, snap, err = policylock.SnapshotBundle(docs, opts)
+		}
 	} else {
 		if fs.NArg() != 1 {
-			fmt.Fprintln(os.Stderr, "missing <file>")
-			return 4
+			return r.usage("missing <file>")
 		}
 		zipBytes, snap, err = policylock.SnapshotFromFile(fs.Arg(0), opts)
 	}
 	if err != nil {
 		msg := err.Error()
 		if strings.Contains(msg, "unsupported") {
-			fmt.Fprintln(os.Stderr, "UNSUPPORTED:", msg)
-			return 3
+			return r.fail(3, msg)
 		}
-		if strings.Contains(msg, "truncated_http") || strings.Contains(msg, "response exceeds") {
-			fmt.Fprintln(os.Stderr, "NETWORK ERROR:", msg)
-			return 5
+		if strings.Contains(msg, "truncated_http") || strings.Contains(msg, "response exceeds") || strings.HasPrefix(msg, "tsa:") {
+			return r.fail(5, msg)
 		}
-		fmt.Fprintln(os.Stderr, "INPUT ERROR:", msg)
-		return 4
+		return r.fail(4, msg)
 	}
 	if err := os.WriteFile(outPath, zipBytes, 0644); err != nil {
-		fmt.Fprintln(os.Stderr, "INPUT ERROR:", err)
-		return 4
+		return r.fail(4, err)
+	}
+	meta, err := policylock.StoreMeta(zipBytes)
+	if err == nil {
+		err = putEvidence(meta, zipBytes)
+	}
+	if err != nil {
+		return r.fail(4, fmt.Errorf("store: %w", err))
+	}
+
+	var proofPath string
+	if logDir != "" {
+		proofPath, err = appendToLog(logDir, translog.KindSnapshot, snap.SnapshotID, outPath)
+		if err != nil {
+			return r.fail(4, err)
+		}
+	}
+
+	r.status("OK")
+	r.field("snapshot_id", snap.SnapshotID)
+	r.field("out", outPath)
+	if b := snap.Policy.Bundle; b != nil {
+		r.field("documents", b.DocumentCount)
+		r.field("bundle_merkle_root", b.MerkleRoot)
+	}
+	if g := snap.Policy.Input.Git; g != nil {
+		r.field("git_commit", g.Commit)
+		r.field("git_tree", g.Tree)
+	}
+	if m, err := policylock.ReadResourceManifest(zipBytes); err == nil {
+		r.field("resource_count", len(m.Resources))
+		r.field("resource_skipped_count", len(m.Skipped))
+	} else if withResources {
+		r.warn("resources_not_captured", "response is not HTML")
+	}
+	if snap.Timestamp != nil {
+		r.field("timestamp_gen_time_utc", snap.Timestamp.GenTimeUTC)
+	}
+	if proofPath != "" {
+		r.field("inclusion_proof", proofPath)
+	}
+	r.set("policy_sha256", meta.PolicySHA256)
+	for _, f := range fetchFields(snap) {
+		r.set(f.key, f.value)
+	}
+	return r.done(0)
+}
+
+func storeDir() string {
+	return store.DefaultDir()
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ", ") }
+func (l *stringList) Set(s string) error { *l = append(*l, s); return nil }
+
+// requestHeaders collects the extra request headers of a URL snapshot from
+// the --header, --header-file, --cookie-file and --bearer-token-file flags.
+func requestHeaders(rawurl string, lines []string, headerFile, cookieFile, bearerFile string) ([]policylock.RequestHeader, error) {
+	var hs []policylock.RequestHeader
+	for _, l := range lines {
+		h, err := policylock.ParseHeaderLine(l)
+		if err != nil {
+			return nil, err
+		}
+		hs = append(hs, h)
+	}
+	if headerFile != "" {
+		b, err := os.ReadFile(headerFile)
+		if err != nil {
+			return nil, err
+		}
+		fh, err := policylock.ParseHeaderFile(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", headerFile, err)
+		}
+		hs = append(hs, fh...)
 	}
-	// Save into store
-	store := os.Getenv("POLICYGUARDIAN_STORE")
-	if store == "" {
-		store = ".policyguardian_store"
+	if cookieFile != "" {
+		b, err := os.ReadFile(cookieFile)
+		if err != nil {
+			return nil, err
+		}
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			return nil, err
+		}
+		c, err := policylock.ParseCookieFile(b, u.Hostname())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cookieFile, err)
+		}
+		hs = append(hs, policylock.RequestHeader{Name: "Cookie", Value: c, Secret: true})
 	}
-	_ = os.MkdirAll(filepath.Join(store, "snapshots"), 0755)
-	_ = os.WriteFile(filepath.Join(store, "snapshots", snap.SnapshotID+".zip"), zipBytes, 0644)
+	if bearerFile != "" {
+		b, err := os.ReadFile(bearerFile)
+		if err != nil {
+			return nil, err
+		}
+		tok := strings.TrimSpace(string(b))
+		if tok == "" {
+			return nil, fmt.Errorf("%s: empty bearer token", bearerFile)
+		}
+		hs = append(hs, policylock.RequestHeader{Name: "Authorization", Value: "Bearer " + tok, Secret: true})
+	}
+	return hs, nil
+}
 
-	fmt.Println("OK")
-	fmt.Println("snapshot_id:", snap.SnapshotID)
-	fmt.Println("out:", outPath)
-	return 0
+type kv struct {
+	key   string
+	value any
+}
+
+// fetchFields lists the fetch metadata of a URL snapshot.
+func fetchFields(snap *policylock.PolicySnapshot) []kv {
+	f := snap.Policy.Fetch
+	if (snap.Policy.Input.Mode != "url" && snap.Policy.Input.Mode != "warc") || f == nil {
+		return nil
+	}
+	var out []kv
+	add := func(k string, v any, ok bool) {
+		if ok {
+			out = append(out, kv{k, v})
+		}
+	}
+	add("retrieved_at_utc", f.RetrievedAtUTC, f.RetrievedAtUTC != "")
+	add("final_url", f.FinalURL, f.FinalURL != "")
+	add("http_status", f.HTTPStatus, f.HTTPStatus != 0)
+	add("content_type", f.ContentType, f.ContentType != "")
+	add("etag", f.ETag, f.ETag != "")
+	add("last_modified", f.LastModified, f.LastModified != "")
+	add("resolved_ip", f.ResolvedIP, f.ResolvedIP != "")
+	add("remote_addr", f.RemoteAddr, f.RemoteAddr != "")
+	add("http_protocol", f.HTTPProtocol, f.HTTPProtocol != "")
+	add("tls_alpn", f.TLSALPN, f.TLSALPN != "")
+	add("tls_cipher_suite", f.TLSCipherSuite, f.TLSCipherSuite != "")
+	add("connection_reused", derefBool(f.ConnectionReused), f.ConnectionReused != nil)
+	if t := f.Transport; t != nil {
+		add("timeout_ms", t.TimeoutMS, true)
+		add("tls_min_version", t.TLSMinVersion, t.TLSMinVersion != "")
+		add("ca_bundle_sha256", t.CABundleSHA256, t.CABundleSHA256 != "")
+		add("client_cert_sha256", t.ClientCertSHA256, t.ClientCertSHA256 != "")
+		add("proxy", t.Proxy, t.Proxy != "")
+	}
+	add("redirect_count", derefInt(f.RedirectCount), f.RedirectCount != nil && *f.RedirectCount != 0)
+	add("cross_domain_redirect", true, f.CrossDomainRedirect != nil && *f.CrossDomainRedirect)
+	return out
+}
+
+func derefBool(p *bool) bool {
+	return p != nil && *p
+}
+
+func derefInt(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
 }
 
 func cmdPolicyVerify(argv []string) int {
-	if len(argv) != 1 {
-		fmt.Fprintln(os.Stderr, "missing <snapshot.zip>")
+	r := newReport("policylock verify")
+	fs := newFlagSet("policylock verify")
+	var tsaRoots, tlsRoots string
+	fs.StringVar(&tsaRoots, "tsa-roots", "", "PEM trust roots for the RFC 3161 timestamp token")
+	fs.StringVar(&tlsRoots, "tls-roots", "", "PEM trust roots for the stored TLS certificate chain")
+	if !r.parse(fs, argv) {
 		return 4
 	}
-	b, err := os.ReadFile(argv[0])
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "INPUT ERROR:", err)
-		return 4
+	if fs.NArg() != 1 {
+		return r.usage("missing <snapshot.zip>")
 	}
-	status, reason, err := policylock.VerifySnapshotZip(b)
+	b, err := os.ReadFile(fs.Arg(0))
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "INPUT ERROR:", err)
-		return 4
+		return r.fail(4, err)
+	}
+	var vopts policylock.VerifyOptions
+	if tsaRoots != "" {
+		if vopts.TSARoots, err = tsa.LoadRoots(tsaRoots); err != nil {
+			return r.fail(4, err)
+		}
 	}
-	fmt.Println(status)
-	if reason != "" {
-		fmt.Println("reason:", reason)
+	if tlsRoots != "" {
+		if vopts.TLSRoots, err = tsa.LoadRoots(tlsRoots); err != nil {
+			return r.fail(4, err)
+		}
 	}
+	status, reason, err := policylock.VerifySnapshotZipWithOptions(b, vopts)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	r.status(status)
+	r.reason(reason)
 	if status != "VALID" {
-		return 2
+		return r.done(2)
 	}
 
 	// Helpful, deterministic context for humans.
@@ -155,53 +494,356 @@ func cmdPolicyVerify(argv []string) int {
 	// if policy_sha256 differs, the remote bytes changed between fetches.
 	snap, bodyHash, err := policylock.ReadSnapshotInfo(b)
 	if err == nil {
-		fmt.Println("policy_sha256:", bodyHash)
-		if snap.Policy.Input.Mode == "url" && snap.Policy.Fetch != nil {
-			if snap.Policy.Fetch.RetrievedAtUTC != "" {
-				fmt.Println("retrieved_at_utc:", snap.Policy.Fetch.RetrievedAtUTC)
+		r.set("snapshot_id", snap.SnapshotID)
+		r.field("policy_sha256", bodyHash)
+		if snap.Signing != nil {
+			r.field("signing_mode", snap.Signing.Mode)
+			r.field("signer_public_key", snap.Signing.PublicKey)
+			if snap.Signing.KeyID != "" {
+				r.field("signer_key_id", snap.Signing.KeyID)
+			}
+		}
+		if g := snap.Policy.Input.Git; g != nil {
+			r.field("git_commit", g.Commit)
+			r.field("git_tree", g.Tree)
+			r.field("git_committer", g.Committer)
+			r.field("git_commit_time_utc", g.CommitTimeUTC)
+		}
+		if snap.Policy.Bundle != nil {
+			r.field("bundle_merkle_root", snap.Policy.Bundle.MerkleRoot)
+			if m, err := policylock.ReadBundleManifest(b); err == nil {
+				for _, d := range m.Documents {
+					r.item("document", policylock.FormatBundleDocument(d), "bundle_documents", d)
+				}
 			}
-			if snap.Policy.Fetch.FinalURL != "" {
-				fmt.Println("final_url:", snap.Policy.Fetch.FinalURL)
+		}
+		if snap.Timestamp != nil {
+			r.field("timestamp_gen_time_utc", snap.Timestamp.GenTimeUTC)
+			if vopts.TSARoots == nil {
+				r.warn("timestamp_chain_unverified")
 			}
-			if snap.Policy.Fetch.HTTPStatus != 0 {
-				fmt.Println("http_status:", snap.Policy.Fetch.HTTPStatus)
+		}
+		if w := snap.Policy.Input.WARC; w != nil {
+			r.field("warc_record_id", w.RecordID)
+			r.field("warc_date", w.Date)
+		}
+		if (snap.Policy.Input.Mode == "url" || snap.Policy.Input.Mode == "warc") && snap.Policy.Fetch != nil {
+			for _, f := range fetchFields(snap) {
+				r.field(f.key, f.value)
 			}
-			if snap.Policy.Fetch.ContentType != "" {
-				fmt.Println("content_type:", snap.Policy.Fetch.ContentType)
+			if rh := snap.Policy.Fetch.RequestHeaders; len(rh) > 0 {
+				names := make([]string, 0, len(rh))
+				for k := range rh {
+					names = append(names, k)
+				}
+				sort.Strings(names)
+				for _, k := range names {
+					r.text("request_header: " + k + ": " + rh[k] + "\n")
+				}
+				r.set("request_headers", rh)
 			}
-			if snap.Policy.Fetch.ETag != "" {
-				fmt.Println("etag:", snap.Policy.Fetch.ETag)
+			for i, h := range snap.Policy.Fetch.RedirectChain {
+				r.item("redirect_hop", policylock.FormatRedirectHop(i+1, h), "redirect_chain", h)
 			}
-			if snap.Policy.Fetch.LastModified != "" {
-				fmt.Println("last_modified:", snap.Policy.Fetch.LastModified)
+			if snap.Policy.Fetch.ResponseHeaders != nil {
+				r.field("response_headers_sha256", snap.Policy.Fetch.ResponseHeaders.SHA256)
 			}
-			if snap.Policy.Fetch.ResolvedIP != "" {
-				fmt.Println("resolved_ip:", snap.Policy.Fetch.ResolvedIP)
+			if snap.Policy.Fetch.TLSChain != nil {
+				r.field("tls_chain_sha256", snap.Policy.Fetch.TLSChain.SHA256)
+				if vopts.TLSRoots == nil {
+					r.warn("tls_chain_unverified")
+				}
 			}
-			if snap.Policy.Fetch.RedirectCount != nil && *snap.Policy.Fetch.RedirectCount != 0 {
-				fmt.Println("redirect_count:", *snap.Policy.Fetch.RedirectCount)
+			if snap.Policy.Fetch.TLSOCSPStaple != nil {
+				r.field("tls_ocsp_staple_sha256", snap.Policy.Fetch.TLSOCSPStaple.SHA256)
 			}
-			if snap.Policy.Fetch.CrossDomainRedirect != nil && *snap.Policy.Fetch.CrossDomainRedirect {
-				fmt.Println("cross_domain_redirect:", "true")
+			if snap.Policy.Fetch.ResourceManifest != nil {
+				r.field("resource_manifest_sha256", snap.Policy.Fetch.ResourceManifest.SHA256)
+				if m, err := policylock.ReadResourceManifest(b); err == nil {
+					for _, res := range m.Resources {
+						r.item("resource", policylock.FormatResource(res), "resources", res)
+					}
+					for _, s := range m.Skipped {
+						r.item("resource_skipped", policylock.FormatSkippedResource(s), "resources_skipped", s)
+					}
+				}
 			}
-			fmt.Println("note:", "If two URL snapshots differ, compare policy_sha256. If it differs, the remote bytes changed between fetches.")
+			r.text("note: If two URL snapshots differ, compare policy_sha256. If it differs, the remote bytes changed between fetches.\n")
 		}
 	}
-	return 0
+	return r.done(0)
 }
 
 func cmdPolicyShow(argv []string) int {
-	if len(argv) != 1 {
-		fmt.Fprintln(os.Stderr, "missing <snapshot.zip>")
+	r := newReport("policylock show")
+	fs := newFlagSet("policylock show")
+	if !r.parse(fs, argv) {
+		return 4
+	}
+	if fs.NArg() != 1 {
+		return r.usage("missing <snapshot.zip>")
+	}
+	b, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return r.fail(4, err)
+	}
+	fields, err := policylock.ShowSnapshotFields(b)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	r.res.Status = "OK"
+	for _, f := range fields {
+		if f.Key == "redirect_hop" || f.Key == "document" || f.Key == "resource" || f.Key == "resource_skipped" {
+			// Repeated; JSON carries the structured chain instead.
+			r.text(f.Key + ": " + f.Value + "\n")
+			continue
+		}
+		r.field(f.Key, f.Value)
+	}
+	if snap, _, err := policylock.ReadSnapshotInfo(b); err == nil && snap.Policy.Fetch != nil && len(snap.Policy.Fetch.RedirectChain) > 0 {
+		r.set("redirect_chain", snap.Policy.Fetch.RedirectChain)
+	}
+	if m, err := policylock.ReadBundleManifest(b); err == nil {
+		r.set("bundle_documents", m.Documents)
+	}
+	if m, err := policylock.ReadResourceManifest(b); err == nil {
+		r.set("resources", m.Resources)
+		if len(m.Skipped) > 0 {
+			r.set("resources_skipped", m.Skipped)
+		}
+	}
+	return r.done(0)
+}
+
+func cmdPolicyExportWARC(argv []string) int {
+	r := newReport("policylock export-warc")
+	fs := newFlagSet("policylock export-warc")
+	var outPath string
+	var gz bool
+	fs.StringVar(&outPath, "out", "policy_snapshots.warc", "Output WARC file")
+	fs.BoolVar(&gz, "gzip", false, "Compress each record as its own gzip member (.warc.gz)")
+	if !r.parse(fs, argv) {
+		return 4
+	}
+	if fs.NArg() == 0 {
+		return r.usage("missing <snapshot.zip>")
+	}
+	packs := make([][]byte, 0, fs.NArg())
+	for _, p := range fs.Args() {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return r.fail(4, err)
+		}
+		status, reason, err := policylock.VerifySnapshotZip(b)
+		if err != nil {
+			return r.fail(4, fmt.Errorf("%s: %w", p, err))
+		}
+		if status != "VALID" {
+			r.status(status)
+			r.reason(reason)
+			r.field("pack", p)
+			return r.done(2)
+		}
+		packs = append(packs, b)
+	}
+	recs, err := policylock.ExportWARC(packs, filepath.Base(outPath), version.ToolVersion)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	var buf bytes.Buffer
+	if err := warc.Write(&buf, recs, gz); err != nil {
+		return r.fail(4, err)
+	}
+	if err := os.WriteFile(outPath, buf.Bytes(), 0644); err != nil {
+		return r.fail(4, err)
+	}
+	r.status("OK")
+	r.field("out", outPath)
+	r.field("snapshot_count", len(packs))
+	r.field("record_count", len(recs))
+	r.field("warc_sha256", hashing.SHA256Hex(buf.Bytes()))
+	return r.done(0)
+}
+
+func cmdPolicyImportWARC(argv []string) int {
+	r := newReport("policylock import-warc")
+	fs := newFlagSet("policylock import-warc")
+	var outDir, createdAt string
+	var signing signingFlags
+	fs.StringVar(&outDir, "out-dir", ".", "Directory for the imported packs (<snapshot_id>.zip)")
+	fs.StringVar(&createdAt, "created-at", "", "Created timestamp")
+	signing.register(fs)
+	if !r.parse(fs, argv) {
+		return 4
+	}
+	if fs.NArg() != 1 {
+		return r.usage("missing <file.warc>")
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return r.fail(4, err)
+	}
+	signer, err := signing.signer(r)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	imported, err := policylock.ImportWARC(data, fs.Arg(0), policylock.SnapshotOptions{
+		CreatedAtUTC: createdAt,
+		ToolVersion:  version.ToolVersion,
+		Signer:       signer,
+	})
+	if err != nil {
+		return r.fail(4, err)
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return r.fail(4, err)
+	}
+	r.status("OK")
+	for _, im := range imported {
+		out := filepath.Join(outDir, im.Snapshot.SnapshotID+".zip")
+		if err := os.WriteFile(out, im.Zip, 0644); err != nil {
+			return r.fail(4, err)
+		}
+		meta, err := policylock.StoreMeta(im.Zip)
+		if err == nil {
+			err = putEvidence(meta, im.Zip)
+		}
+		if err != nil {
+			return r.fail(4, fmt.Errorf("store: %w", err))
+		}
+		item := map[string]any{"snapshot_id": im.Snapshot.SnapshotID, "out": out, "target_uri": im.Snapshot.Policy.Input.URL, "warc_record_id": im.Snapshot.Policy.Input.WARC.RecordID}
+		r.item("snapshot", im.Snapshot.SnapshotID+" "+im.Snapshot.Policy.Input.URL, "snapshots", item)
+	}
+	return r.done(0)
+}
+
+func cmdPolicyDiff(argv []string) int {
+	r := newReport("policylock diff")
+	fs := newFlagSet("policylock diff")
+	if !r.parse(fs, argv) {
 		return 4
 	}
-	out, err := policylock.ShowSnapshot(argv[0])
+	if fs.NArg() != 2 {
+		return r.usage("missing <a.zip> <b.zip>")
+	}
+	var packs [2][]byte
+	for i := range packs {
+		b, err := os.ReadFile(fs.Arg(i))
+		if err != nil {
+			return r.fail(4, err)
+		}
+		status, reason, err := policylock.VerifySnapshotZip(b)
+		if err != nil {
+			return r.fail(4, err)
+		}
+		if status != "VALID" {
+			r.status(status)
+			r.reason(reason)
+			r.field("pack", fs.Arg(i))
+			return r.done(2)
+		}
+		packs[i] = b
+	}
+	d, err := policylock.DiffSnapshots(packs[0], packs[1], fs.Arg(0), fs.Arg(1))
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "INPUT ERROR:", err)
+		return r.fail(4, err)
+	}
+	if d.Identical() {
+		r.status("IDENTICAL")
+	} else {
+		r.status("DIFFERENT")
+	}
+	r.field("snapshot_id_a", d.SnapshotIDA)
+	r.field("snapshot_id_b", d.SnapshotIDB)
+	r.field("policy_sha256_a", d.PolicySHA256A)
+	r.field("policy_sha256_b", d.PolicySHA256B)
+	for _, m := range d.Metadata {
+		r.item("changed", fmt.Sprintf("%s: %q -> %q", m.Field, m.A, m.B), "metadata", m)
+	}
+	if d.BodyDiffSkipped != "" {
+		r.field("body_diff_skipped", d.BodyDiffSkipped)
+	}
+	if d.BodyDiff != "" {
+		r.set("body_diff", d.BodyDiff)
+		r.text(d.BodyDiff)
+	}
+	r.set("body_identical", d.BodyIdentical)
+	return r.done(0)
+}
+
+func cmdPolicyWatch(argv []string) int {
+	r := newReport("policylock watch")
+	fs := newFlagSet("policylock watch")
+	var watchlist string
+	var interval time.Duration
+	var once bool
+	var maxBytes int64
+	fs.StringVar(&watchlist, "watchlist", "", "File with one URL per line")
+	fs.DurationVar(&interval, "interval", time.Hour, "Time between passes")
+	fs.BoolVar(&once, "once", false, "Run a single pass and exit")
+	fs.Int64Var(&maxBytes, "max-bytes", 0, "Max bytes per URL fetch")
+	if !r.parse(fs, argv) {
 		return 4
 	}
-	fmt.Print(out)
-	return 0
+	if watchlist == "" {
+		return r.usage("missing --watchlist")
+	}
+	if interval <= 0 {
+		return r.usage("--interval must be positive")
+	}
+	for {
+		// One report per pass: in --json mode each pass prints one object.
+		r := newReport("policylock watch")
+		// Re-read each pass so the watchlist can be edited while running.
+		urls, err := policylock.ReadWatchlist(watchlist)
+		if err != nil {
+			return r.fail(4, err)
+		}
+		results, err := policylock.WatchOnce(urls, policylock.WatchOptions{
+			StoreDir: storeDir(),
+			Snapshot: policylock.SnapshotOptions{
+				ToolVersion: version.ToolVersion,
+				UserAgent:   version.ToolVersion + " (PolicyLock)",
+				MaxBytes:    maxBytes,
+			},
+		})
+		if err != nil {
+			return r.fail(4, err)
+		}
+		failed := 0
+		counts := map[string]int{}
+		for _, res := range results {
+			counts[res.Status]++
+			switch res.Status {
+			case "error":
+				failed++
+				if !jsonOutput {
+					fmt.Fprintf(os.Stderr, "NETWORK ERROR: %s: %s\n", res.URL, res.Error)
+				}
+			case "new", "changed":
+				r.text(fmt.Sprintf("%s: %s snapshot_id=%s\n", res.Status, res.URL, res.SnapshotID))
+			}
+		}
+		checked := timefmt.Format(timefmt.NowUTC())
+		r.text(fmt.Sprintf("pass: checked_at_utc=%s urls=%d new=%d changed=%d unchanged=%d not_modified=%d error=%d\n",
+			checked, len(results), counts["new"], counts["changed"],
+			counts["unchanged"], counts["not_modified"], counts["error"]))
+		r.res.Status = "OK"
+		if failed > 0 {
+			r.res.Status = errorStatus[5][1]
+		}
+		r.set("checked_at_utc", checked)
+		r.set("results", results)
+		exit := 0
+		if failed > 0 {
+			exit = 5
+		}
+		if once {
+			return r.done(exit)
+		}
+		r.done(exit)
+		time.Sleep(interval)
+	}
 }
 
 func runConsent(argv []string) int {
@@ -212,6 +854,10 @@ func runConsent(argv []string) int {
 	switch argv[0] {
 	case "record":
 		return cmdConsentRecord(argv[1:])
+	case "record-batch":
+		return cmdConsentRecordBatch(argv[1:])
+	case "revoke":
+		return cmdConsentRevoke(argv[1:])
 	case "verify":
 		return cmdConsentVerify(argv[1:])
 	default:
@@ -221,74 +867,418 @@ func runConsent(argv []string) int {
 }
 
 func cmdConsentRecord(argv []string) int {
-	fs := flag.NewFlagSet("consent record", flag.ContinueOnError)
+	r := newReport("consent record")
+	fs := newFlagSet("consent record")
 	var outPath string
 	var createdAt string
 	var subject string
 	var tenantSalt string
 	var pepper string
-	var signPriv string
+	var signing signingFlags
+	var tsaURL string
+	var logDir string
 	fs.StringVar(&outPath, "out", "consent_event.json", "Output consent json")
 	fs.StringVar(&createdAt, "created-at", "", "Created timestamp")
 	fs.StringVar(&subject, "subject", "", "Subject identifier")
 	fs.StringVar(&tenantSalt, "tenant-salt", "", "Tenant salt hex")
 	fs.StringVar(&pepper, "pepper", "", "Pepper hex")
-	fs.StringVar(&signPriv, "sign-privkey", "", "Ed25519 private key hex")
-	if err := fs.Parse(argv); err != nil {
+	signing.register(fs)
+	signing.registerCert(fs)
+	fs.StringVar(&tsaURL, "tsa-url", "", "RFC 3161 time-stamping authority URL")
+	fs.StringVar(&logDir, "log-dir", "", "Append consent_event_id to the transparency log in this directory")
+	if !r.parse(fs, argv) {
 		return 4
 	}
 	if fs.NArg() != 1 {
-		fmt.Fprintln(os.Stderr, "missing <snapshot.zip|snapshot_id>")
-		return 4
+		return r.usage("missing <snapshot.zip|snapshot_id>")
 	}
 	if subject == "" || tenantSalt == "" || pepper == "" {
-		fmt.Fprintln(os.Stderr, "missing --subject/--tenant-salt/--pepper")
-		return 4
+		return r.usage("missing --subject/--tenant-salt/--pepper")
+	}
+	signer, err := signing.signer(r)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	chain, err := signing.certChain()
+	if err != nil {
+		return r.fail(4, err)
 	}
-	_, _, _, err := consentguardian.RecordConsent(fs.Arg(0), outPath, consentguardian.RecordOptions{
+	ev, canonical, _, err := consentguardian.RecordConsent(fs.Arg(0), outPath, consentguardian.RecordOptions{
 		CreatedAtUTC:      createdAt,
 		SubjectIdentifier: subject,
 		TenantSaltHex:     tenantSalt,
 		PepperHex:         pepper,
-		SignPrivKeyHex:    signPriv,
+		Signer:            signer,
+		SignCertChain:     chain,
+		TSAURL:            tsaURL,
 	})
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "INPUT ERROR:", err)
+		if strings.HasPrefix(err.Error(), "tsa:") {
+			return r.fail(5, err)
+		}
+		return r.fail(4, err)
+	}
+	meta, err := consentguardian.StoreMeta(canonical)
+	if err == nil {
+		err = putEvidence(meta, canonical)
+	}
+	if err != nil {
+		return r.fail(4, fmt.Errorf("store: %w", err))
+	}
+	var proofPath string
+	if logDir != "" {
+		proofPath, err = appendToLog(logDir, translog.KindConsentEvent, ev.ConsentEventID, outPath)
+		if err != nil {
+			return r.fail(4, err)
+		}
+	}
+	r.status("OK")
+	r.set("consent_event_id", ev.ConsentEventID)
+	r.set("snapshot_id", ev.Policy.SnapshotID)
+	r.set("policy_sha256", ev.Policy.PolicySHA256)
+	r.field("out", outPath)
+	if ev.Timestamp != nil {
+		r.field("timestamp_gen_time_utc", ev.Timestamp.GenTimeUTC)
+	}
+	if proofPath != "" {
+		r.field("inclusion_proof", proofPath)
+	}
+	return r.done(0)
+}
+
+func cmdConsentRecordBatch(argv []string) int {
+	r := newReport("consent record-batch")
+	fs := newFlagSet("consent record-batch")
+	var input string
+	var format string
+	var outDir string
+	var outJSONL string
+	var createdAt string
+	var tenantSalt string
+	var pepper string
+	var signing signingFlags
+	var workers int
+	fs.StringVar(&input, "input", "", "JSONL or CSV file of subjects")
+	fs.StringVar(&format, "format", "", "Input format jsonl|csv (default: from --input extension)")
+	fs.StringVar(&outDir, "out-dir", "", "Write one <consent_event_id>.json per event into this directory")
+	fs.StringVar(&outJSONL, "out-jsonl", "", "Write all events as one JSONL stream")
+	fs.StringVar(&createdAt, "created-at", "", "Created timestamp for rows without created_at_utc")
+	fs.StringVar(&tenantSalt, "tenant-salt", "", "Tenant salt hex")
+	fs.StringVar(&pepper, "pepper", "", "Pepper hex")
+	signing.register(fs)
+	signing.registerCert(fs)
+	fs.IntVar(&workers, "workers", 0, "Worker count (default: number of CPUs)")
+	if !r.parse(fs, argv) {
 		return 4
 	}
-	fmt.Println("OK")
-	fmt.Println("out:", outPath)
-	return 0
+	if fs.NArg() != 1 {
+		return r.usage("missing <snapshot.zip|snapshot_id>")
+	}
+	if input == "" || tenantSalt == "" || pepper == "" {
+		return r.usage("missing --input/--tenant-salt/--pepper")
+	}
+	if (outDir == "") == (outJSONL == "") {
+		return r.usage("exactly one of --out-dir or --out-jsonl is required")
+	}
+	if format == "" {
+		format = "jsonl"
+		if strings.EqualFold(filepath.Ext(input), ".csv") {
+			format = "csv"
+		}
+	}
+	signer, err := signing.signer(r)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	chain, err := signing.certChain()
+	if err != nil {
+		return r.fail(4, err)
+	}
+	f, err := os.Open(input)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	rows, failures, err := consentguardian.ReadBatchRows(f, format)
+	f.Close()
+	if err != nil {
+		return r.fail(4, err)
+	}
+	opts := consentguardian.BatchOptions{
+		CreatedAtUTC:  createdAt,
+		TenantSaltHex: tenantSalt,
+		PepperHex:     pepper,
+		Signer:        signer,
+		SignCertChain: chain,
+		Workers:       workers,
+		OutDir:        outDir,
+	}
+	var out *os.File
+	if outJSONL != "" {
+		if out, err = os.Create(outJSONL); err != nil {
+			return r.fail(4, err)
+		}
+		opts.OutJSONL = out
+	}
+	sum, err := consentguardian.RecordConsentBatch(fs.Arg(0), rows, opts)
+	if out != nil {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return r.fail(4, err)
+	}
+	failures = append(failures, sum.Failures...)
+	sort.Slice(failures, func(i, j int) bool { return failures[i].Row < failures[j].Row })
+
+	if len(failures) == 0 {
+		r.status("OK")
+	} else {
+		r.status("PARTIAL")
+	}
+	r.field("snapshot_id", sum.SnapshotID)
+	r.field("rows", sum.Total+len(failures)-len(sum.Failures))
+	r.field("recorded", sum.Recorded)
+	r.field("failed", len(failures))
+	for _, fl := range failures {
+		r.item("failure", fmt.Sprintf("row %d: %s", fl.Row, fl.Error), "failures", fl)
+	}
+	if outDir != "" {
+		r.field("out_dir", outDir)
+	} else {
+		r.field("out", outJSONL)
+	}
+	if len(failures) > 0 {
+		return r.done(1)
+	}
+	return r.done(0)
+}
+
+func cmdConsentRevoke(argv []string) int {
+	r := newReport("consent revoke")
+	fs := newFlagSet("consent revoke")
+	var outPath string
+	var createdAt string
+	var reasonText string
+	var signing signingFlags
+	var tsaURL string
+	var logDir string
+	fs.StringVar(&outPath, "out", "consent_revocation.json", "Output revocation json")
+	fs.StringVar(&createdAt, "created-at", "", "Revocation timestamp")
+	fs.StringVar(&reasonText, "reason", "", "Optional revocation reason (stored as context.reason)")
+	signing.register(fs)
+	signing.registerCert(fs)
+	fs.StringVar(&tsaURL, "tsa-url", "", "RFC 3161 time-stamping authority URL")
+	fs.StringVar(&logDir, "log-dir", "", "Append revocation_event_id to the transparency log in this directory")
+	if !r.parse(fs, argv) {
+		return 4
+	}
+	if fs.NArg() != 1 {
+		return r.usage("missing <consent.json>")
+	}
+	signer, err := signing.signer(r)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	chain, err := signing.certChain()
+	if err != nil {
+		return r.fail(4, err)
+	}
+	opts := consentguardian.RevokeOptions{
+		CreatedAtUTC:  createdAt,
+		Signer:        signer,
+		SignCertChain: chain,
+		TSAURL:        tsaURL,
+	}
+	if reasonText != "" {
+		opts.Context = map[string]string{"reason": reasonText}
+	}
+	rv, _, _, err := consentguardian.RevokeConsent(fs.Arg(0), outPath, opts)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "tsa:") {
+			return r.fail(5, err)
+		}
+		return r.fail(4, err)
+	}
+	var proofPath string
+	if logDir != "" {
+		proofPath, err = appendToLog(logDir, translog.KindConsentRevocation, rv.RevocationEventID, outPath)
+		if err != nil {
+			return r.fail(4, err)
+		}
+	}
+	r.status("OK")
+	r.field("revocation_event_id", rv.RevocationEventID)
+	r.field("revokes", rv.Revokes.ConsentEventID)
+	r.field("out", outPath)
+	if rv.Timestamp != nil {
+		r.field("timestamp_gen_time_utc", rv.Timestamp.GenTimeUTC)
+	}
+	if proofPath != "" {
+		r.field("inclusion_proof", proofPath)
+	}
+	return r.done(0)
 }
 
 func cmdConsentVerify(argv []string) int {
-	fs := flag.NewFlagSet("consent verify", flag.ContinueOnError)
+	r := newReport("consent verify")
+	fs := newFlagSet("consent verify")
 	var resolveSnap bool
+	var tsaRoots string
+	var at string
+	var consentID string
+	var trustedKeys string
+	var signerRoots string
 	fs.BoolVar(&resolveSnap, "resolve-snapshot", false, "Resolve snapshot from local store")
-	if err := fs.Parse(argv); err != nil {
+	fs.StringVar(&tsaRoots, "tsa-roots", "", "PEM trust roots for the RFC 3161 timestamp token")
+	fs.StringVar(&at, "at", "", "Report whether the consent was in force at this timestamp")
+	fs.StringVar(&consentID, "consent-id", "", "consent_event_id to resolve when several consent events are given")
+	fs.StringVar(&trustedKeys, "trusted-keys", "", "Keyring of trusted signer keys; events must be signed by a key valid at created_at_utc")
+	fs.StringVar(&signerRoots, "roots", "", "PEM trust roots for signer certificates; events must carry a chain valid at created_at_utc")
+	if !r.parse(fs, argv) {
 		return 4
 	}
-	if fs.NArg() != 1 {
-		fmt.Fprintln(os.Stderr, "missing <consent.json>")
-		return 4
+	if fs.NArg() == 0 {
+		return r.usage("missing <consent.json>")
+	}
+	vopts := consentguardian.VerifyOptions{ResolveSnapshot: resolveSnap}
+	if tsaRoots != "" {
+		roots, err := tsa.LoadRoots(tsaRoots)
+		if err != nil {
+			return r.fail(4, err)
+		}
+		vopts.TSARoots = roots
 	}
-	status, reason, unsigned, err := consentguardian.VerifyConsentFile(fs.Arg(0), resolveSnap)
+	if trustedKeys != "" {
+		ring, err := consentguardian.LoadKeyring(trustedKeys)
+		if err != nil {
+			return r.fail(4, err)
+		}
+		vopts.TrustedKeys = ring
+	}
+	if signerRoots != "" {
+		roots, err := tsa.LoadRoots(signerRoots)
+		if err != nil {
+			return r.fail(4, err)
+		}
+		vopts.SignerRoots = roots
+	}
+	if fs.NArg() > 1 || at != "" || consentID != "" {
+		return consentEffective(r, fs.Args(), consentID, at, vopts)
+	}
+	status, reason, unsigned, err := consentguardian.VerifyEventFile(fs.Arg(0), vopts)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "INPUT ERROR:", err)
-		return 4
+		return r.fail(4, err)
 	}
-	fmt.Println(status)
-	if reason != "" {
-		fmt.Println("reason:", reason)
+	r.status(status)
+	r.reason(reason)
+	if status != "INVALID" {
+		if b, err := os.ReadFile(fs.Arg(0)); err == nil {
+			eventIDs(r, fs.Arg(0), b, vopts)
+		}
 	}
 	if unsigned {
-		fmt.Fprintln(os.Stderr, "WARNING: unsigned_consent")
+		r.warn("unsigned_consent")
 	}
 	if status == "INVALID" {
-		return 2
+		return r.done(2)
+	}
+	if status == "PARTIAL" {
+		return r.done(1)
+	}
+	return r.done(0)
+}
+
+// eventIDs adds the IDs of a verified consent event or revocation to the
+// JSON result and prints the signer key ID and the signer's legal entity:
+// the verified certificate subject with --roots, else the keyring entry.
+func eventIDs(r *report, path string, b []byte, vopts consentguardian.VerifyOptions) {
+	var ev struct {
+		Schema            string `json:"schema"`
+		CreatedAtUTC      string `json:"created_at_utc"`
+		ConsentEventID    string `json:"consent_event_id"`
+		RevocationEventID string `json:"revocation_event_id"`
+		Hashes            map[string]string
+		Policy            *consentguardian.PolicyRef      `json:"policy"`
+		Revokes           *consentguardian.RevokedConsent `json:"revokes"`
+		Signing           *consentguardian.SigningInfo    `json:"signing"`
+	}
+	if json.Unmarshal(b, &ev) != nil {
+		return
+	}
+	if ev.Signing != nil && ev.Signing.KeyID != "" {
+		r.field("signer_key_id", ev.Signing.KeyID)
+	}
+	switch {
+	case vopts.SignerRoots != nil:
+		if cert, err := consentguardian.SignerCertificate(path); err == nil && cert != nil {
+			entity := legalEntity(cert)
+			r.field("signer_legal_entity", entity)
+			r.field("signer_certificate_subject", cert.Subject.String())
+			r.field("signer_certificate_issuer", cert.Issuer.String())
+			r.field("signer_certificate_serial", cert.SerialNumber.Text(16))
+			if ev.Signing.LegalEntityName != "" && ev.Signing.LegalEntityName != entity {
+				r.warn("legal_entity_name_mismatch", ev.Signing.LegalEntityName)
+			}
+		}
+	case vopts.TrustedKeys != nil && ev.Signing != nil:
+		if pub, err := keys.ParsePublic([]byte(ev.Signing.PublicKey)); err == nil {
+			id, _ := keys.KeyID(pub)
+			if k := vopts.TrustedKeys.Lookup(id); k != nil && k.LegalEntityName != "" {
+				r.field("signer_legal_entity", k.LegalEntityName)
+			}
+		}
+	}
+	r.set("schema", ev.Schema)
+	r.set("created_at_utc", ev.CreatedAtUTC)
+	if ev.Schema == consentguardian.SchemaConsentRevocation {
+		r.set("revocation_event_id", ev.Hashes["sha2-256"])
+		if ev.Revokes != nil {
+			r.set("revokes", ev.Revokes.ConsentEventID)
+		}
+		return
+	}
+	r.set("consent_event_id", ev.Hashes["sha2-256"])
+	if ev.Policy != nil {
+		r.set("snapshot_id", ev.Policy.SnapshotID)
+		r.set("policy_sha256", ev.Policy.PolicySHA256)
+	}
+}
+
+// legalEntity names the subject of a signer certificate: its organization,
+// else its common name.
+func legalEntity(cert *x509.Certificate) string {
+	if len(cert.Subject.Organization) > 0 {
+		return cert.Subject.Organization[0]
+	}
+	return cert.Subject.CommonName
+}
+
+func consentEffective(r *report, paths []string, consentID, at string, vopts consentguardian.VerifyOptions) int {
+	status, reason, eff, err := consentguardian.ResolveEffective(paths, consentID, at, vopts)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	r.status(status)
+	r.reason(reason)
+	if status == "INVALID" {
+		if eff.InvalidFile != "" {
+			r.field("file", eff.InvalidFile)
+		}
+		return r.done(2)
+	}
+	r.field("consent_event_id", eff.ConsentEventID)
+	r.field("at_utc", eff.AtUTC)
+	r.field("effective", eff.State)
+	if eff.RevocationEventID != "" {
+		r.field("revocation_event_id", eff.RevocationEventID)
+		r.field("revoked_at_utc", eff.RevokedAtUTC)
+	}
+	for _, f := range eff.UnsignedFiles {
+		r.warn("unsigned_consent", f)
 	}
 	if status == "PARTIAL" {
-		return 1
+		return r.done(1)
 	}
-	return 0
+	return r.done(0)
 }
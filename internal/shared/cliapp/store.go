@@ -0,0 +1,231 @@
+package cliapp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"policyguardian/internal/consentguardian"
+	"policyguardian/internal/policylock"
+	"policyguardian/internal/store"
+)
+
+// putEvidence saves an artifact into the default evidence store.
+func putEvidence(meta store.Meta, data []byte) error {
+	st, err := store.OpenFS(storeDir())
+	if err != nil {
+		return err
+	}
+	_, err = st.Put(meta, data)
+	return err
+}
+
+func runStore(argv []string) int {
+	if len(argv) == 0 {
+		usage()
+		return 4
+	}
+	switch argv[0] {
+	case "ls":
+		return cmdStoreLs(argv[1:])
+	case "get":
+		return cmdStoreGet(argv[1:])
+	case "fsck":
+		return cmdStoreFsck(argv[1:])
+	default:
+		usage()
+		return 4
+	}
+}
+
+func cmdStoreLs(argv []string) int {
+	r := newReport("store ls")
+	fs := newFlagSet("store ls")
+	var kindStr string
+	fs.StringVar(&kindStr, "kind", "", "Only list snapshot or consent_event objects")
+	if !r.parse(fs, argv) {
+		return 4
+	}
+	kind, ok := parseKind(kindStr)
+	if !ok {
+		return r.fail(4, "unknown kind: "+kindStr)
+	}
+	st, err := store.OpenFS(storeDir())
+	if err != nil {
+		return r.fail(4, err)
+	}
+	metas, err := st.List(kind)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	if metas == nil {
+		metas = []store.Meta{}
+	}
+	r.res.Status = "OK"
+	r.set("objects", metas)
+	for _, m := range metas {
+		ref := m.URL
+		if m.Kind == store.KindConsentEvent {
+			ref = m.SnapshotID
+		}
+		r.text(fmt.Sprintf("%s\t%s\t%s\t%s\t%s\n", m.Kind, m.ID, dash(m.CreatedAtUTC), dash(m.PolicySHA256), dash(ref)))
+	}
+	return r.done(0)
+}
+
+// parseKind accepts an empty kind (any) or one of store.Kinds.
+func parseKind(s string) (store.Kind, bool) {
+	if s == "" {
+		return "", true
+	}
+	return store.ParseKind(s)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func cmdStoreGet(argv []string) int {
+	r := newReport("store get")
+	fs := newFlagSet("store get")
+	var kindStr string
+	var outPath string
+	fs.StringVar(&kindStr, "kind", "", "Object kind (default: whichever kind holds the ID)")
+	fs.StringVar(&outPath, "out", "", "Write the object to this file instead of stdout")
+	if !r.parse(fs, argv) {
+		return 4
+	}
+	if fs.NArg() != 1 {
+		return r.usage("missing <id>")
+	}
+	if jsonOutput && outPath == "" {
+		return r.usage("--json requires --out")
+	}
+	kind, ok := parseKind(kindStr)
+	if !ok {
+		return r.fail(4, "unknown kind: "+kindStr)
+	}
+	kinds := store.Kinds
+	if kind != "" {
+		kinds = []store.Kind{kind}
+	}
+	st, err := store.OpenFS(storeDir())
+	if err != nil {
+		return r.fail(4, err)
+	}
+	var data []byte
+	var meta *store.Meta
+	for _, k := range kinds {
+		data, meta, err = st.Get(k, fs.Arg(0))
+		if !errors.Is(err, store.ErrNotFound) {
+			break
+		}
+	}
+	if err != nil {
+		return r.fail(4, err)
+	}
+	if outPath == "" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := os.WriteFile(outPath, data, 0644); err != nil {
+		return r.fail(4, err)
+	}
+	r.status("OK")
+	r.field("kind", meta.Kind)
+	r.set("id", meta.ID)
+	r.field("sha256", meta.SHA256)
+	r.field("out", outPath)
+	return r.done(0)
+}
+
+func cmdStoreFsck(argv []string) int {
+	r := newReport("store fsck")
+	fs := newFlagSet("store fsck")
+	var verify bool
+	var reindex bool
+	fs.BoolVar(&verify, "verify", false, "Also verify every snapshot pack and consent event")
+	fs.BoolVar(&reindex, "reindex", false, "Rebuild the index from the stored objects first")
+	if !r.parse(fs, argv) {
+		return 4
+	}
+	st, err := store.OpenFS(storeDir())
+	if err != nil {
+		return r.fail(4, err)
+	}
+	if reindex {
+		n, err := st.Reindex(evidenceMeta)
+		if err != nil {
+			return r.fail(4, err)
+		}
+		r.set("reindexed", n)
+		if !jsonOutput {
+			fmt.Fprintln(os.Stderr, "reindexed:", n)
+		}
+	}
+	var opts store.FsckOptions
+	if verify {
+		opts.Verify = verifyEvidence
+	}
+	probs, err := st.Fsck(opts)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	metas, err := st.List("")
+	if err != nil {
+		return r.fail(4, err)
+	}
+	if len(probs) == 0 {
+		r.status("VALID")
+	} else {
+		r.status("INVALID")
+		r.reason(probs[0].Reason)
+	}
+	r.field("store", st.Dir())
+	r.field("objects", len(metas))
+	for _, p := range probs {
+		line := p.Reason + " " + p.Path
+		if p.Detail != "" {
+			line += " (" + p.Detail + ")"
+		}
+		r.item("problem", line, "problems", p)
+	}
+	if len(probs) > 0 {
+		return r.done(2)
+	}
+	return r.done(0)
+}
+
+func evidenceMeta(kind store.Kind, id string, data []byte) (store.Meta, error) {
+	if kind == store.KindSnapshot {
+		return policylock.StoreMeta(data)
+	}
+	return consentguardian.StoreMeta(data)
+}
+
+func verifyEvidence(kind store.Kind, id string, data []byte) string {
+	var status, reason string
+	var err error
+	if kind == store.KindSnapshot {
+		status, reason, err = policylock.VerifySnapshotZip(data)
+	} else {
+		status, reason, err = consentguardian.VerifyConsent(data, false)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	if status != "VALID" {
+		return reason
+	}
+	m, err := evidenceMeta(kind, id, data)
+	if err != nil {
+		return err.Error()
+	}
+	if m.ID != id {
+		return "id_mismatch"
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package cliapp
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+
+	"policyguardian/internal/shared/tsa"
+)
+
+func runTSA(argv []string) int {
+	if len(argv) == 0 || argv[0] != "serve" {
+		usage()
+		return 4
+	}
+	r := newReport("tsa serve")
+	fs := newFlagSet("tsa serve")
+	var addr string
+	var dir string
+	fs.StringVar(&addr, "addr", "127.0.0.1:3161", "Listen address")
+	fs.StringVar(&dir, "dir", filepath.Join(storeDir(), "tsa"), "Directory holding tsa_key.pem and tsa_cert.pem (created if missing)")
+	if !r.parse(fs, argv[1:]) {
+		return 4
+	}
+	srv, err := tsa.LoadOrCreate(dir)
+	if err != nil {
+		return r.fail(4, err)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return r.fail(5, err)
+	}
+	// The result object is printed once the server is listening; exit_code 0
+	// means "started". A later serve failure prints a second object.
+	r.res.Status = "OK"
+	r.field("tsa_cert", filepath.Join(dir, tsa.CertFile))
+	r.field("tsa_policy", srv.Policy.String())
+	r.field("listening", "http://"+ln.Addr().String()+"/")
+	r.done(0)
+	if err := http.Serve(ln, srv); err != nil {
+		return newReport("tsa serve").fail(5, err)
+	}
+	return 0
+}
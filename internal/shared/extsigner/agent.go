@@ -0,0 +1,216 @@
+package extsigner
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"policyguardian/internal/shared/keys"
+)
+
+// ssh-agent protocol messages (draft-miller-ssh-agent section 3).
+const (
+	agentFailure           = 5
+	agentRequestIdentities = 11
+	agentIdentitiesAnswer  = 12
+	agentSignRequest       = 13
+	agentSignResponse      = 14
+)
+
+// agentTimeout bounds one request to the agent, including a confirmation
+// prompt for keys added with "ssh-add -c".
+const agentTimeout = 2 * time.Minute
+
+var errNoAgent = errors.New("ssh-agent: SSH_AUTH_SOCK is not set")
+
+// Agent is a crypto.Signer backed by a key held in an ssh-agent. The agent
+// hashes what it signs, so Agent is a sigenv.PayloadSigner. Ed25519 and
+// ECDSA P-256 keys are supported; RSA keys are not, since agents sign RSA
+// with PKCS#1 v1.5 rather than RSA-PSS.
+type Agent struct {
+	socket  string
+	blob    []byte
+	sshType string
+	pub     crypto.PublicKey
+}
+
+// NewAgent selects a key of the agent listening on socket (default
+// $SSH_AUTH_SOCK). selector is a key ID (keys.KeyID) or key comment; an
+// empty selector requires the agent to hold exactly one supported key.
+func NewAgent(socket, selector string) (*Agent, error) {
+	if socket == "" {
+		socket = os.Getenv("SSH_AUTH_SOCK")
+	}
+	if socket == "" {
+		return nil, errNoAgent
+	}
+	reply, err := agentCall(socket, []byte{agentRequestIdentities})
+	if err != nil {
+		return nil, err
+	}
+	r := &wireReader{b: reply}
+	if r.byte() != agentIdentitiesAnswer {
+		return nil, errors.New("ssh-agent: unexpected reply to identities request")
+	}
+	n := r.uint32()
+	var found []*Agent
+	var listed []string
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		blob, comment := r.string(), string(r.string())
+		pub, typ, err := keys.ParseSSHPublicKey(blob)
+		if err != nil {
+			continue
+		}
+		alg, _ := keys.Algorithm(pub)
+		if alg == keys.AlgRSAPSS {
+			continue
+		}
+		id, _ := keys.KeyID(pub)
+		listed = append(listed, id+" "+comment)
+		if selector == "" || selector == id || selector == comment {
+			found = append(found, &Agent{socket: socket, blob: blob, sshType: typ, pub: pub})
+		}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("ssh-agent: %w", r.err)
+	}
+	switch {
+	case len(found) == 1:
+		return found[0], nil
+	case len(listed) == 0:
+		return nil, errors.New("ssh-agent holds no ed25519 or ecdsa-sha2-nistp256 key")
+	case len(found) == 0:
+		return nil, fmt.Errorf("ssh-agent has no key %q; keys: %s", selector, strings.Join(listed, ", "))
+	}
+	return nil, fmt.Errorf("ssh-agent holds several keys; select one by key ID or comment: %s", strings.Join(listed, ", "))
+}
+
+// Public returns the selected key.
+func (a *Agent) Public() crypto.PublicKey { return a.pub }
+
+// Sign signs an Ed25519 message. ECDSA keys can only sign through
+// SignPayload, since the agent must be given the data, not its digest.
+func (a *Agent) Sign(_ io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != 0 {
+		return nil, errors.New("ssh-agent: cannot sign a precomputed digest")
+	}
+	return a.SignPayload(msg)
+}
+
+// SignPayload asks the agent to sign signBytes and converts the SSH
+// signature to the envelope encoding.
+func (a *Agent) SignPayload(signBytes []byte) ([]byte, error) {
+	var req bytes.Buffer
+	req.WriteByte(agentSignRequest)
+	writeString(&req, a.blob)
+	writeString(&req, signBytes)
+	req.Write([]byte{0, 0, 0, 0}) // flags
+	reply, err := agentCall(a.socket, req.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	r := &wireReader{b: reply}
+	switch r.byte() {
+	case agentSignResponse:
+	case agentFailure:
+		return nil, errors.New("ssh-agent refused to sign")
+	default:
+		return nil, errors.New("ssh-agent: unexpected reply to sign request")
+	}
+	sr := &wireReader{b: r.string()}
+	format, sig := string(sr.string()), sr.string()
+	if r.err != nil || sr.err != nil || format != a.sshType {
+		return nil, errors.New("ssh-agent: malformed signature")
+	}
+	if a.sshType != "ecdsa-sha2-nistp256" {
+		return sig, nil
+	}
+	// RFC 5656 section 3.1.2: mpint r, mpint s.
+	er := &wireReader{b: sig}
+	rr, ss := new(big.Int).SetBytes(er.string()), new(big.Int).SetBytes(er.string())
+	if er.err != nil {
+		return nil, errors.New("ssh-agent: malformed ECDSA signature")
+	}
+	return asn1.Marshal(struct{ R, S *big.Int }{rr, ss})
+}
+
+// agentCall sends one framed request and returns the framed reply.
+func agentCall(socket string, msg []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", socket, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("ssh-agent: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(agentTimeout))
+	var frame bytes.Buffer
+	writeString(&frame, msg)
+	if _, err := conn.Write(frame.Bytes()); err != nil {
+		return nil, fmt.Errorf("ssh-agent: %w", err)
+	}
+	var n [4]byte
+	if _, err := io.ReadFull(conn, n[:]); err != nil {
+		return nil, fmt.Errorf("ssh-agent: %w", err)
+	}
+	size := binary.BigEndian.Uint32(n[:])
+	if size == 0 || size > 256<<10 {
+		return nil, errors.New("ssh-agent: invalid reply length")
+	}
+	reply := make([]byte, size)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, fmt.Errorf("ssh-agent: %w", err)
+	}
+	return reply, nil
+}
+
+// wireReader reads the SSH wire encoding (RFC 4251 section 5).
+type wireReader struct {
+	b   []byte
+	err error
+}
+
+func (r *wireReader) byte() byte {
+	if r.err != nil || len(r.b) < 1 {
+		r.err = errors.New("truncated message")
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func (r *wireReader) uint32() uint32 {
+	if r.err != nil || len(r.b) < 4 {
+		r.err = errors.New("truncated message")
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *wireReader) string() []byte {
+	n := r.uint32()
+	if r.err != nil || uint32(len(r.b)) < n {
+		r.err = errors.New("truncated message")
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func writeString(buf *bytes.Buffer, b []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(b)))
+	buf.Write(n[:])
+	buf.Write(b)
+}
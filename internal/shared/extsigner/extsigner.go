@@ -0,0 +1,27 @@
+// Package extsigner provides crypto.Signer backends whose private keys
+// never enter this process: an external plugin executable speaking a small
+// JSON protocol over stdio (see Plugin) and an ssh-agent (see Agent).
+package extsigner
+
+import (
+	"crypto"
+	"fmt"
+	"strings"
+)
+
+// Parse resolves a signer spec: "plugin:<executable>" or
+// "ssh-agent[:<selector>]", where the selector is a key ID or key comment
+// (see NewAgent).
+func Parse(spec string) (crypto.Signer, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "plugin":
+		if arg == "" {
+			return nil, fmt.Errorf("signer %q: missing executable", spec)
+		}
+		return NewPlugin(arg)
+	case "ssh-agent":
+		return NewAgent("", arg)
+	}
+	return nil, fmt.Errorf("unknown signer %q (expected plugin:<executable> or ssh-agent[:<key_id|comment>])", spec)
+}
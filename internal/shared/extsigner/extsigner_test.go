@@ -0,0 +1,267 @@
+package extsigner
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"policyguardian/internal/consentguardian"
+	"policyguardian/internal/policylock"
+	"policyguardian/internal/shared/keys"
+)
+
+// The test binary doubles as the stub plugin: run without arguments and
+// with stubKeyEnv set, it serves one request with that key file.
+const (
+	stubKeyEnv  = "EXTSIGNER_TEST_PLUGIN_KEY"
+	stubModeEnv = "EXTSIGNER_TEST_PLUGIN_MODE"
+)
+
+func TestMain(m *testing.M) {
+	if path := os.Getenv(stubKeyEnv); path != "" {
+		os.Exit(stubPlugin(path, os.Getenv(stubModeEnv)))
+	}
+	os.Exit(m.Run())
+}
+
+func stubPlugin(path, mode string) int {
+	var req pluginRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil || req.Protocol != Protocol {
+		fmt.Fprintln(os.Stderr, "bad request")
+		return 2
+	}
+	key, err := keys.LoadSigner(path, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	resp := map[string]string{}
+	switch {
+	case mode == "exit":
+		fmt.Fprintln(os.Stderr, "token not present")
+		return 3
+	case mode == "error":
+		resp["error"] = "signing refused"
+	case req.Op == "public_key":
+		pub, _ := keys.MarshalPublic(key.Public(), keys.FormatPublic, "")
+		resp["public_key"] = string(pub)
+	case req.Op == "sign":
+		if mode == "wrong-key" {
+			key, _ = keys.Generate(req.Algorithm)
+		}
+		digest, _ := hex.DecodeString(req.DigestSHA256)
+		var sig []byte
+		switch req.Algorithm {
+		case keys.AlgEd25519:
+			payload, _ := base64.StdEncoding.DecodeString(req.Payload)
+			if sum := sha256.Sum256(payload); hex.EncodeToString(sum[:]) != req.DigestSHA256 {
+				resp["error"] = "digest does not match payload"
+				break
+			}
+			sig, err = key.Sign(rand.Reader, payload, crypto.Hash(0))
+		case keys.AlgRSAPSS:
+			sig, err = key.Sign(rand.Reader, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256})
+		default:
+			sig, err = key.Sign(rand.Reader, digest, crypto.SHA256)
+		}
+		if err != nil {
+			resp["error"] = err.Error()
+		}
+		if sig != nil {
+			resp["signature"] = hex.EncodeToString(sig)
+			pub, _ := keys.MarshalPublic(key.Public(), keys.FormatPublic, "")
+			resp["public_key"] = string(pub)
+		}
+	default:
+		resp["error"] = "unknown op " + req.Op
+	}
+	json.NewEncoder(os.Stdout).Encode(resp)
+	return 0
+}
+
+// writeKey stores a new key of alg in dir and returns the key and path.
+func writeKey(t *testing.T, dir, alg, format string) (crypto.Signer, string) {
+	t.Helper()
+	key, err := keys.Generate(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := keys.Marshal(key, format, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, alg+"."+format)
+	if err := keys.WriteFile(path, data); err != nil {
+		t.Fatal(err)
+	}
+	return key, path
+}
+
+func testSnapshot(t *testing.T, dir string) string {
+	t.Helper()
+	opts := policylock.SnapshotOptions{CreatedAtUTC: "2026-01-01T00:00:00Z", ToolVersion: "policyguardian/v0.1.0-test", UserAgent: "policyguardian/v0.1.0-test"}
+	zipb, _, err := policylock.SnapshotFromFile("../../../fixtures/policylock/policy1.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "snap.zip")
+	if err := os.WriteFile(path, zipb, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// recordAndVerify records a consent event signed by signer and checks that
+// it verifies with the signer's key ID.
+func recordAndVerify(t *testing.T, snapPath, out string, signer consentguardian.Signer) {
+	t.Helper()
+	ev, _, _, err := consentguardian.RecordConsent(snapPath, out, consentguardian.RecordOptions{
+		CreatedAtUTC:      "2026-01-01T00:00:01Z",
+		SubjectIdentifier: "alice@example.com",
+		TenantSaltHex:     "bb",
+		PepperHex:         "aa",
+		Signer:            signer,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID, _ := keys.KeyID(signer.Public())
+	if ev.Signing == nil || ev.Signing.KeyID != keyID {
+		t.Fatalf("unexpected signing info %+v", ev.Signing)
+	}
+	if st, reason, _, err := consentguardian.VerifyConsentFile(out, false); st != "VALID" || err != nil {
+		t.Fatalf("expected VALID, got %s %s %v", st, reason, err)
+	}
+}
+
+func TestPluginSigner(t *testing.T) {
+	dir := t.TempDir()
+	snapPath := testSnapshot(t, dir)
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, alg := range keys.Algorithms {
+		key, path := writeKey(t, dir, alg, keys.FormatPKCS8)
+		t.Setenv(stubKeyEnv, path)
+		t.Setenv(stubModeEnv, "")
+		signer, err := Parse("plugin:" + exe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !publicKeyEqual(signer.Public(), key.Public()) {
+			t.Fatalf("%s: plugin returned a different public key", alg)
+		}
+		recordAndVerify(t, snapPath, filepath.Join(dir, alg+".json"), signer)
+
+		for mode, want := range map[string]string{
+			"wrong-key": "signed with a different key",
+			"error":     "signing refused",
+			"exit":      "token not present",
+		} {
+			t.Setenv(stubModeEnv, mode)
+			_, _, _, err := consentguardian.RecordConsent(snapPath, "", consentguardian.RecordOptions{
+				CreatedAtUTC: "2026-01-01T00:00:01Z", SubjectIdentifier: "alice@example.com",
+				TenantSaltHex: "bb", PepperHex: "aa", Signer: signer,
+			})
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Fatalf("%s %s: expected %q, got %v", alg, mode, want, err)
+			}
+		}
+	}
+	if _, err := Parse("plugin:"); err == nil {
+		t.Fatal("expected an error for a missing executable")
+	}
+	if _, err := Parse("pkcs11:token"); err == nil {
+		t.Fatal("expected an error for an unknown signer")
+	}
+}
+
+func TestAgentSigner(t *testing.T) {
+	if _, err := exec.LookPath("ssh-agent"); err != nil {
+		t.Skip("ssh-agent not installed")
+	}
+	if _, err := exec.LookPath("ssh-add"); err != nil {
+		t.Skip("ssh-add not installed")
+	}
+	// Unix socket paths are short; t.TempDir may exceed the limit.
+	sockDir, err := os.MkdirTemp("", "pg-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sockDir)
+	sock := filepath.Join(sockDir, "agent.sock")
+	agent := exec.Command("ssh-agent", "-D", "-a", sock)
+	if err := agent.Start(); err != nil {
+		t.Skip("cannot start ssh-agent:", err)
+	}
+	defer func() {
+		agent.Process.Kill()
+		agent.Wait()
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(sock); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	dir := t.TempDir()
+	snapPath := testSnapshot(t, dir)
+	if _, err := NewAgent(sock, ""); err == nil || !strings.Contains(err.Error(), "no ed25519") {
+		t.Fatalf("expected an empty-agent error, got %v", err)
+	}
+	var signers []crypto.Signer
+	for _, alg := range keys.Algorithms {
+		key, path := writeKey(t, dir, alg, keys.FormatOpenSSH)
+		add := exec.Command("ssh-add", path)
+		add.Env = append(os.Environ(), "SSH_AUTH_SOCK="+sock)
+		if out, err := add.CombinedOutput(); err != nil {
+			t.Fatalf("ssh-add: %v: %s", err, out)
+		}
+		signers = append(signers, key)
+	}
+	if _, err := NewAgent(sock, ""); err == nil || !strings.Contains(err.Error(), "several keys") {
+		t.Fatalf("expected a selection error, got %v", err)
+	}
+	for i, alg := range keys.Algorithms {
+		keyID, _ := keys.KeyID(signers[i].Public())
+		signer, err := NewAgent(sock, keyID)
+		if alg == keys.AlgRSAPSS {
+			if err == nil {
+				t.Fatal("expected RSA agent keys to be refused")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		recordAndVerify(t, snapPath, filepath.Join(dir, "agent-"+alg+".json"), signer)
+	}
+
+	// Ed25519 signatures are deterministic, so the agent's must equal ours.
+	keyID, _ := keys.KeyID(signers[0].Public())
+	signer, err := NewAgent(sock, keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := signer.SignPayload([]byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ed25519.Sign(signers[0].(ed25519.PrivateKey), []byte("payload")); string(sig) != string(want) {
+		t.Fatal("agent signature differs from the key's")
+	}
+}
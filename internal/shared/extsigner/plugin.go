@@ -0,0 +1,150 @@
+package extsigner
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"policyguardian/internal/shared/keys"
+)
+
+// Protocol identifies the plugin protocol. Each operation runs the plugin
+// executable once (no arguments) with one JSON request on stdin and expects
+// one JSON response on stdout:
+//
+//	{"protocol":"policyguardian.signer.v1","op":"public_key"}
+//	-> {"public_key":"<PEM, ssh line or hex>"}
+//
+//	{"protocol":"policyguardian.signer.v1","op":"sign","algorithm":"<alg>",
+//	 "key_id":"<hex>","digest_sha256":"<hex>","payload":"<base64>"}
+//	-> {"signature":"<hex>","public_key":"..."}
+//
+// digest_sha256 is the sha2-256 of the JCS sign payload. payload is sent
+// for ed25519 only, which signs the payload itself. The signature is in
+// the envelope encoding of the algorithm (64 bytes for ed25519, ASN.1 DER
+// for ECDSA, raw RSASSA-PSS). A response {"error":"..."} or a non-zero exit
+// status fails the operation.
+const Protocol = "policyguardian.signer.v1"
+
+// PluginTimeout bounds one plugin invocation.
+var PluginTimeout = 60 * time.Second
+
+type pluginRequest struct {
+	Protocol     string `json:"protocol"`
+	Op           string `json:"op"`
+	Algorithm    string `json:"algorithm,omitempty"`
+	KeyID        string `json:"key_id,omitempty"`
+	DigestSHA256 string `json:"digest_sha256,omitempty"`
+	Payload      string `json:"payload,omitempty"`
+}
+
+type pluginResponse struct {
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+	Error     string `json:"error"`
+}
+
+// Plugin is a crypto.Signer backed by an external executable.
+type Plugin struct {
+	path  string
+	pub   crypto.PublicKey
+	alg   string
+	keyID string
+}
+
+// NewPlugin asks the executable at path for its public key.
+func NewPlugin(path string) (*Plugin, error) {
+	p := &Plugin{path: path}
+	resp, err := p.call(pluginRequest{Op: "public_key"})
+	if err != nil {
+		return nil, err
+	}
+	if p.pub, err = keys.ParsePublic([]byte(resp.PublicKey)); err != nil {
+		return nil, fmt.Errorf("signer plugin %s: public_key: %w", path, err)
+	}
+	if p.alg, err = keys.Algorithm(p.pub); err != nil {
+		return nil, fmt.Errorf("signer plugin %s: %w", path, err)
+	}
+	if p.keyID, err = keys.KeyID(p.pub); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Public returns the plugin's public key.
+func (p *Plugin) Public() crypto.PublicKey { return p.pub }
+
+// Sign sends the digest (and, for ed25519, the message) to the plugin. As
+// with any crypto.Signer, msg is the message when opts.HashFunc() is zero
+// and its sha2-256 digest otherwise.
+func (p *Plugin) Sign(_ io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	req := pluginRequest{Op: "sign", Algorithm: p.alg, KeyID: p.keyID}
+	switch {
+	case opts.HashFunc() == 0 && p.alg == keys.AlgEd25519:
+		digest := sha256.Sum256(msg)
+		req.DigestSHA256 = hex.EncodeToString(digest[:])
+		req.Payload = base64.StdEncoding.EncodeToString(msg)
+	case opts.HashFunc() == crypto.SHA256 && p.alg != keys.AlgEd25519 && len(msg) == sha256.Size:
+		req.DigestSHA256 = hex.EncodeToString(msg)
+	default:
+		return nil, fmt.Errorf("signer plugin %s: unsupported signing options for %s", p.path, p.alg)
+	}
+	resp, err := p.call(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.PublicKey != "" {
+		pub, err := keys.ParsePublic([]byte(resp.PublicKey))
+		if err != nil || !publicKeyEqual(pub, p.pub) {
+			return nil, fmt.Errorf("signer plugin %s signed with a different key", p.path)
+		}
+	}
+	sig, err := hex.DecodeString(strings.TrimSpace(resp.Signature))
+	if err != nil || len(sig) == 0 {
+		return nil, fmt.Errorf("signer plugin %s: invalid signature hex", p.path)
+	}
+	return sig, nil
+}
+
+func (p *Plugin) call(req pluginRequest) (*pluginResponse, error) {
+	req.Protocol = Protocol
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), PluginTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.path)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(append(in, '\n'))
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("signer plugin %s: %s: %w", p.path, msg, err)
+		}
+		return nil, fmt.Errorf("signer plugin %s: %w", p.path, err)
+	}
+	var resp pluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("signer plugin %s: invalid response: %w", p.path, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("signer plugin %s: %s", p.path, resp.Error)
+	}
+	return &resp, nil
+}
+
+// publicKeyEqual compares two public keys of the supported types.
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(b)
+}
@@ -4,38 +4,70 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"math"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf16"
 	"unicode/utf8"
 )
 
-// Deterministic canonical JSON writer compatible with RFC 8785 (JCS) for typical JSON.
+// Options selects the optional RFC 8785 features.
+// The zero value is the v0.1 profile used for all signing payloads.
+type Options struct {
+	// AllowFloats enables ES6 number serialization (RFC 8785 §3.2.2.3).
+	// v0.1 signing payloads are integers only.
+	AllowFloats bool
+	// AllowNull permits JSON null. v0.1 omits absent fields instead.
+	AllowNull bool
+}
+
+// RFC8785 enables every RFC 8785 feature (floats and null).
+var RFC8785 = Options{AllowFloats: true, AllowNull: true}
+
+// Deterministic canonical JSON writer implementing RFC 8785 (JCS).
 // v0.1 enforcement:
 //   - integers only (no floats / exponent)
 //   - omit optional fields (never null)
-// This build preserves UTF-8 strings as-is (valid UTF-8 required).
+//
+// Strings are preserved as-is (valid UTF-8 required); only the escapes
+// required by RFC 8785 are emitted, and object keys sort by UTF-16 code units.
 func CanonicalizeJSON(input []byte) ([]byte, error) {
+	return CanonicalizeJSONWithOptions(input, Options{})
+}
+
+func CanonicalizeValue(v any) ([]byte, error) {
+	return CanonicalizeValueWithOptions(v, Options{})
+}
+
+func CanonicalizeJSONWithOptions(input []byte, opts Options) ([]byte, error) {
 	dec := json.NewDecoder(bytes.NewReader(input))
 	dec.UseNumber()
 	var v any
 	if err := dec.Decode(&v); err != nil {
 		return nil, err
 	}
-	return CanonicalizeValue(v)
+	if dec.More() {
+		return nil, errors.New("trailing data after JSON value")
+	}
+	return CanonicalizeValueWithOptions(v, opts)
 }
 
-func CanonicalizeValue(v any) ([]byte, error) {
+func CanonicalizeValueWithOptions(v any, opts Options) ([]byte, error) {
 	var buf bytes.Buffer
-	if err := writeValue(&buf, v); err != nil {
+	if err := writeValue(&buf, v, opts); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
 }
 
-func writeValue(buf *bytes.Buffer, v any) error {
+func writeValue(buf *bytes.Buffer, v any, opts Options) error {
 	switch x := v.(type) {
 	case nil:
-		return errors.New("null is not allowed (omit absent fields)")
+		if !opts.AllowNull {
+			return errors.New("null is not allowed (omit absent fields)")
+		}
+		buf.WriteString("null")
 	case bool:
 		if x {
 			buf.WriteString("true")
@@ -44,6 +76,13 @@ func writeValue(buf *bytes.Buffer, v any) error {
 		}
 	case json.Number:
 		s := x.String()
+		if opts.AllowFloats {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return errors.New("invalid number")
+			}
+			return writeFloat(buf, f)
+		}
 		if strings.ContainsAny(s, ".eE") {
 			return errors.New("floats/exponents are not allowed")
 		}
@@ -52,20 +91,19 @@ func writeValue(buf *bytes.Buffer, v any) error {
 		}
 		buf.WriteString(s)
 	case float64:
-		return errors.New("floats are not allowed")
-	case string:
-		if !utf8.ValidString(x) {
-			return errors.New("invalid utf-8 string")
+		if !opts.AllowFloats {
+			return errors.New("floats are not allowed")
 		}
-		enc, _ := json.Marshal(x)
-		buf.Write(enc)
+		return writeFloat(buf, x)
+	case string:
+		return writeString(buf, x)
 	case []any:
 		buf.WriteByte('[')
 		for i, it := range x {
 			if i > 0 {
 				buf.WriteByte(',')
 			}
-			if err := writeValue(buf, it); err != nil {
+			if err := writeValue(buf, it, opts); err != nil {
 				return err
 			}
 		}
@@ -73,24 +111,25 @@ func writeValue(buf *bytes.Buffer, v any) error {
 	case map[string]any:
 		keys := make([]string, 0, len(x))
 		for k, vv := range x {
-			if vv == nil {
+			if vv == nil && !opts.AllowNull {
 				return errors.New("null is not allowed (omit absent fields)")
 			}
+			if !utf8.ValidString(k) {
+				return errors.New("invalid utf-8 key")
+			}
 			keys = append(keys, k)
 		}
-		sort.Strings(keys)
+		sort.Slice(keys, func(i, j int) bool { return lessUTF16(keys[i], keys[j]) })
 		buf.WriteByte('{')
 		for i, k := range keys {
 			if i > 0 {
 				buf.WriteByte(',')
 			}
-			if !utf8.ValidString(k) {
-				return errors.New("invalid utf-8 key")
+			if err := writeString(buf, k); err != nil {
+				return err
 			}
-			kenc, _ := json.Marshal(k)
-			buf.Write(kenc)
 			buf.WriteByte(':')
-			if err := writeValue(buf, x[k]); err != nil {
+			if err := writeValue(buf, x[k], opts); err != nil {
 				return err
 			}
 		}
@@ -100,17 +139,102 @@ func writeValue(buf *bytes.Buffer, v any) error {
 		if err != nil {
 			return err
 		}
-		return writeValueFromJSON(buf, raw)
+		return writeValueFromJSON(buf, raw, opts)
 	}
 	return nil
 }
 
-func writeValueFromJSON(buf *bytes.Buffer, raw []byte) error {
+func writeValueFromJSON(buf *bytes.Buffer, raw []byte, opts Options) error {
 	dec := json.NewDecoder(bytes.NewReader(raw))
 	dec.UseNumber()
 	var v any
 	if err := dec.Decode(&v); err != nil {
 		return err
 	}
-	return writeValue(buf, v)
+	return writeValue(buf, v, opts)
+}
+
+// writeString emits a JSON string per RFC 8785 §3.2.2.2: only '"', '\\' and
+// control characters are escaped; everything else is written as UTF-8.
+func writeString(buf *bytes.Buffer, s string) error {
+	if !utf8.ValidString(s) {
+		return errors.New("invalid utf-8 string")
+	}
+	const hexDigits = "0123456789abcdef"
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hexDigits[c>>4])
+				buf.WriteByte(hexDigits[c&0xf])
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return nil
+}
+
+// writeFloat emits a number using the ECMAScript Number.prototype.toString
+// algorithm required by RFC 8785 §3.2.2.3.
+func writeFloat(buf *bytes.Buffer, f float64) error {
+	s, err := FormatNumber(f)
+	if err != nil {
+		return err
+	}
+	buf.WriteString(s)
+	return nil
+}
+
+// FormatNumber serializes f the way ES6 JSON.stringify does.
+func FormatNumber(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", errors.New("NaN/Infinity are not allowed")
+	}
+	if f == 0 {
+		// Covers -0 as well.
+		return "0", nil
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs < 1e-6 || abs >= 1e21 {
+		format = 'e'
+	}
+	s := strconv.FormatFloat(f, format, -1, 64)
+	if format == 'e' {
+		// Go writes e-07 / e+21; ES6 writes e-7 / e+21.
+		if n := len(s); n >= 4 && s[n-4] == 'e' && s[n-2] == '0' {
+			s = s[:n-2] + s[n-1:]
+		}
+	}
+	return s, nil
+}
+
+// lessUTF16 orders strings by their UTF-16 code units (RFC 8785 §3.2.3).
+func lessUTF16(a, b string) bool {
+	ua := utf16.Encode([]rune(a))
+	ub := utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
 }
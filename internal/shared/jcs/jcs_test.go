@@ -0,0 +1,124 @@
+package jcs
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"testing"
+)
+
+// RFC 8785 §3.2.2 sample: numbers, string escaping and literals.
+func TestRFC8785Sample(t *testing.T) {
+	in := `{
+  "numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+  "string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+  "literals": [null, true, false]
+}`
+	want := `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`
+	got, err := CanonicalizeJSONWithOptions([]byte(in), RFC8785)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("mismatch\nwant=%s\ngot =%s", want, got)
+	}
+}
+
+// RFC 8785 §3.2.3 sample: keys sort by UTF-16 code units, not UTF-8 bytes.
+func TestRFC8785KeySorting(t *testing.T) {
+	in := `{
+  "\u20ac": "Euro Sign",
+  "\r": "Carriage Return",
+  "\ufb33": "Hebrew Letter Dalet With Dagesh",
+  "1": "One",
+  "\ud83d\ude00": "Emoji: Grinning Face",
+  "\u0080": "Control",
+  "\u00f6": "Latin Small Letter O With Diaeresis"
+}`
+	want := "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"\u00f6\":\"Latin Small Letter O With Diaeresis\"," +
+		"\"\u20ac\":\"Euro Sign\",\"\U0001F600\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}"
+	got, err := CanonicalizeJSON([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("mismatch\nwant=%s\ngot =%s", want, got)
+	}
+}
+
+// RFC 8785 Appendix B: IEEE-754 bit patterns and their serialization.
+func TestRFC8785Numbers(t *testing.T) {
+	vectors := []struct {
+		bits string
+		want string
+	}{
+		{"0000000000000000", "0"},
+		{"8000000000000000", "0"},
+		{"0000000000000001", "5e-324"},
+		{"8000000000000001", "-5e-324"},
+		{"7fefffffffffffff", "1.7976931348623157e+308"},
+		{"ffefffffffffffff", "-1.7976931348623157e+308"},
+		{"4340000000000000", "9007199254740992"},
+		{"c340000000000000", "-9007199254740992"},
+		{"4430000000000000", "295147905179352830000"},
+		{"44b52d02c7e14af5", "9.999999999999997e+22"},
+		{"44b52d02c7e14af6", "1e+23"},
+		{"44b52d02c7e14af7", "1.0000000000000001e+23"},
+		{"444b1ae4d6e2ef4e", "999999999999999700000"},
+		{"444b1ae4d6e2ef4f", "999999999999999900000"},
+		{"444b1ae4d6e2ef50", "1e+21"},
+		{"3eb0c6f7a0b5ed8c", "9.999999999999997e-7"},
+		{"3eb0c6f7a0b5ed8d", "0.000001"},
+		{"41b3de4355555553", "333333333.3333332"},
+		{"41b3de4355555554", "333333333.33333325"},
+		{"41b3de4355555555", "333333333.3333333"},
+		{"41b3de4355555556", "333333333.3333334"},
+		{"41b3de4355555557", "333333333.33333343"},
+		{"becbf647612f3696", "-0.0000033333333333333333"},
+		{"43143ff3c1cb0959", "1424953923781206.2"},
+	}
+	for _, v := range vectors {
+		raw, err := hex.DecodeString(v.bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := math.Float64frombits(binary.BigEndian.Uint64(raw))
+		got, err := FormatNumber(f)
+		if err != nil {
+			t.Fatalf("%s: %v", v.bits, err)
+		}
+		if got != v.want {
+			t.Fatalf("%s: want %s got %s", v.bits, v.want, got)
+		}
+	}
+	if _, err := FormatNumber(math.NaN()); err == nil {
+		t.Fatalf("expected NaN to be rejected")
+	}
+}
+
+func TestNoHTMLEscaping(t *testing.T) {
+	got, err := CanonicalizeValue(map[string]any{"k": "<a href=\"x\">&</a>\u2028"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\"k\":\"<a href=\\\"x\\\">&</a>\u2028\"}"
+	if string(got) != want {
+		t.Fatalf("mismatch\nwant=%s\ngot =%s", want, got)
+	}
+}
+
+func TestV01ProfileRejectsFloatsAndNull(t *testing.T) {
+	if _, err := CanonicalizeJSON([]byte(`{"a":1.5}`)); err == nil {
+		t.Fatalf("expected float to be rejected")
+	}
+	if _, err := CanonicalizeJSON([]byte(`{"a":null}`)); err == nil {
+		t.Fatalf("expected null to be rejected")
+	}
+	got, err := CanonicalizeJSON([]byte(`{"b":2,"a":-1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"a":-1,"b":2}` {
+		t.Fatalf("unexpected %s", got)
+	}
+}
@@ -0,0 +1,345 @@
+// Package keys reads and writes signing key files: PKCS#8 PEM, passphrase
+// encrypted PKCS#8 PEM (PBES2 with PBKDF2-HMAC-SHA256 and AES-256-CBC, as
+// written by "openssl pkcs8 -topk8 -v2 aes-256-cbc"), unencrypted OpenSSH
+// private keys and the legacy 64-byte hex form. Ed25519, ECDSA P-256 and
+// RSA (2048 bits or more) keys are supported. Only stdlib is used.
+package keys
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Key file formats. FormatHex and FormatTraditional (OpenSSL's "EC PRIVATE
+// KEY" and "RSA PRIVATE KEY" PEM blocks) are accepted on input only.
+const (
+	FormatPKCS8          = "pkcs8"
+	FormatPKCS8Encrypted = "pkcs8-encrypted"
+	FormatOpenSSH        = "openssh"
+	FormatHex            = "hex"
+	FormatTraditional    = "traditional"
+	// Public key formats.
+	FormatPublic    = "public"
+	FormatSSHPublic = "ssh-public"
+)
+
+// Signature algorithms, named after the key type and the digest they sign
+// with. Algorithm maps a public key to one of these.
+const (
+	AlgEd25519   = "ed25519"
+	AlgECDSAP256 = "ecdsa-p256-sha256"
+	AlgRSAPSS    = "rsa-pss-sha256"
+)
+
+// Algorithms lists the supported algorithms; the first is the default.
+var Algorithms = []string{AlgEd25519, AlgECDSAP256, AlgRSAPSS}
+
+// RSA key sizes: Generate writes rsaGenerateBits keys and smaller keys than
+// rsaMinBits are rejected.
+const (
+	rsaGenerateBits = 3072
+	rsaMinBits      = 2048
+)
+
+var (
+	ErrPassphraseRequired = errors.New("key file is encrypted; a passphrase is required")
+	ErrBadPassphrase      = errors.New("incorrect passphrase or corrupt key file")
+)
+
+// Generate returns a new signing key for alg ("" is AlgEd25519).
+func Generate(alg string) (crypto.Signer, error) {
+	switch alg {
+	case "", AlgEd25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return priv, nil
+	case AlgECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgRSAPSS:
+		return rsa.GenerateKey(rand.Reader, rsaGenerateBits)
+	}
+	return nil, fmt.Errorf("unknown algorithm %q (expected %s)", alg, strings.Join(Algorithms, "|"))
+}
+
+// KeyID is the stable key identifier: the lowercase hex sha2-256 of the DER
+// SubjectPublicKeyInfo, so it does not depend on the key file format.
+func KeyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Algorithm names the signature algorithm a key signs with. ECDSA keys must
+// be on P-256 and RSA keys at least 2048 bits.
+func Algorithm(pub crypto.PublicKey) (string, error) {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return AlgEd25519, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return "", fmt.Errorf("unsupported ECDSA curve %s (only P-256)", k.Curve.Params().Name)
+		}
+		return AlgECDSAP256, nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < rsaMinBits {
+			return "", fmt.Errorf("RSA key too small: %d bits (minimum %d)", k.N.BitLen(), rsaMinBits)
+		}
+		return AlgRSAPSS, nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", pub)
+}
+
+// PublicKeyHex is the hex form of a public key used in signature
+// envelopes: the raw 32 bytes for Ed25519, the DER SubjectPublicKeyInfo
+// otherwise.
+func PublicKeyHex(pub crypto.PublicKey) (string, error) {
+	if k, ok := pub.(ed25519.PublicKey); ok {
+		return hex.EncodeToString(k), nil
+	}
+	if _, err := Algorithm(pub); err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(der), nil
+}
+
+// ParsePublicKeyHex reverses PublicKeyHex.
+func ParsePublicKeyHex(s string) (crypto.PublicKey, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errors.New("invalid public key hex")
+	}
+	if len(b) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(b), nil
+	}
+	pub, err := x509.ParsePKIXPublicKey(b)
+	if err != nil {
+		return nil, errors.New("invalid public key: neither 32 bytes nor a DER SubjectPublicKeyInfo")
+	}
+	if _, err := Algorithm(pub); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+func checkSigner(key any) (crypto.Signer, error) {
+	s, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	if _, err := Algorithm(s.Public()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ParsePrivate decodes a private key file in any supported format and
+// returns the key and the format it was found in. passphrase is only used
+// for encrypted files.
+func ParsePrivate(data, passphrase []byte) (crypto.Signer, string, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		s := strings.TrimSpace(string(data))
+		if b, err := hex.DecodeString(s); err == nil && len(b) == ed25519.PrivateKeySize {
+			priv := ed25519.NewKeyFromSeed(b[:ed25519.SeedSize])
+			if !bytes.Equal(priv, b) {
+				return nil, "", errors.New("invalid ed25519 private key: public half does not match seed")
+			}
+			return priv, FormatHex, nil
+		}
+		return nil, "", errors.New("unrecognized key file (expected PEM, OpenSSH or 128 hex characters)")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, "", err
+		}
+		s, err := checkSigner(key)
+		return s, FormatPKCS8, err
+	case "ENCRYPTED PRIVATE KEY":
+		if len(passphrase) == 0 {
+			return nil, "", ErrPassphraseRequired
+		}
+		der, err := decryptPKCS8(block.Bytes, passphrase)
+		if err != nil {
+			return nil, "", err
+		}
+		key, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, "", ErrBadPassphrase
+		}
+		s, err := checkSigner(key)
+		return s, FormatPKCS8Encrypted, err
+	case "OPENSSH PRIVATE KEY":
+		s, err := parseOpenSSH(block.Bytes)
+		return s, FormatOpenSSH, err
+	case "EC PRIVATE KEY", "RSA PRIVATE KEY":
+		if _, encrypted := block.Headers["DEK-Info"]; encrypted {
+			return nil, "", errors.New("legacy encrypted PEM keys are not supported; convert with \"openssl pkcs8 -topk8\"")
+		}
+		var key any
+		var err error
+		if block.Type == "EC PRIVATE KEY" {
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		} else {
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		s, err := checkSigner(key)
+		return s, FormatTraditional, err
+	}
+	return nil, "", fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+// ParsePublic decodes a public key: a "PUBLIC KEY" PEM block, an
+// authorized_keys style "ssh-ed25519 AAAA..." line or the PublicKeyHex
+// form. Private key files are accepted too when they are not encrypted.
+func ParsePublic(data []byte) (crypto.PublicKey, error) {
+	s := strings.TrimSpace(string(data))
+	if strings.HasPrefix(s, "ssh-") || strings.HasPrefix(s, "ecdsa-") {
+		return parseSSHPublic(s)
+	}
+	if _, err := hex.DecodeString(s); err == nil && s != "" {
+		return ParsePublicKeyHex(s)
+	}
+	if block, _ := pem.Decode(data); block != nil && block.Type == "PUBLIC KEY" {
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := Algorithm(pub); err != nil {
+			return nil, err
+		}
+		return pub, nil
+	}
+	priv, _, err := ParsePrivate(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	return priv.Public(), nil
+}
+
+// Marshal encodes a private key. FormatPKCS8Encrypted requires passphrase.
+func Marshal(key crypto.Signer, format string, passphrase []byte) ([]byte, error) {
+	if _, err := checkSigner(key); err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatPKCS8, FormatPKCS8Encrypted:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if format == FormatPKCS8 {
+			return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+		}
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		enc, err := encryptPKCS8(der, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: enc}), nil
+	case FormatOpenSSH:
+		b, err := marshalOpenSSH(key)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: b}), nil
+	}
+	return nil, fmt.Errorf("unknown private key format %q", format)
+}
+
+// MarshalPublic encodes a public key as a PEM block (FormatPublic) or an
+// authorized_keys line (FormatSSHPublic) with an optional comment.
+func MarshalPublic(pub crypto.PublicKey, format, comment string) ([]byte, error) {
+	switch format {
+	case FormatPublic:
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+	case FormatSSHPublic:
+		blob, err := sshPublicBlob(pub)
+		if err != nil {
+			return nil, err
+		}
+		line := sshKeyType(pub) + " " + base64.StdEncoding.EncodeToString(blob)
+		if comment != "" {
+			line += " " + comment
+		}
+		return []byte(line + "\n"), nil
+	}
+	return nil, fmt.Errorf("unknown public key format %q", format)
+}
+
+// LoadSigner reads a private key file.
+func LoadSigner(path string, passphrase []byte) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, _, err := ParsePrivate(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// ReadPassphrase returns the first line of a passphrase file without its
+// line ending.
+func ReadPassphrase(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[:i]
+	}
+	b = bytes.TrimSuffix(b, []byte("\r"))
+	if len(b) == 0 {
+		return nil, fmt.Errorf("%s: empty passphrase", path)
+	}
+	return b, nil
+}
+
+// WriteFile writes a key file with mode 0600 and refuses to replace an
+// existing file.
+func WriteFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,370 @@
+package keys
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// SSH key type names (RFC 8709, RFC 5656, RFC 4253) and the P-256 curve
+// identifier of ecdsa keys.
+const (
+	sshEd25519   = "ssh-ed25519"
+	sshECDSAP256 = "ecdsa-sha2-nistp256"
+	sshRSA       = "ssh-rsa"
+	sshNISTP256  = "nistp256"
+)
+
+// openSSHMagic starts the "openssh-key-v1" private key format (PROTOCOL.key
+// in the OpenSSH sources).
+const openSSHMagic = "openssh-key-v1\x00"
+
+// sshReader reads the SSH wire encoding (RFC 4251 section 5).
+type sshReader struct {
+	b   []byte
+	err error
+}
+
+func (r *sshReader) uint32() uint32 {
+	if r.err != nil || len(r.b) < 4 {
+		r.err = errors.New("truncated OpenSSH key")
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *sshReader) bytes() []byte {
+	n := r.uint32()
+	if r.err != nil || uint32(len(r.b)) < n {
+		r.err = errors.New("truncated OpenSSH key")
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// mpint reads a non-negative multiple precision integer.
+func (r *sshReader) mpint() *big.Int {
+	b := r.bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		r.err = errors.New("negative mpint in OpenSSH key")
+	}
+	return new(big.Int).SetBytes(b)
+}
+
+func sshString(buf *bytes.Buffer, b []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(b)))
+	buf.Write(n[:])
+	buf.Write(b)
+}
+
+func sshMpint(buf *bytes.Buffer, v *big.Int) {
+	b := v.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	sshString(buf, b)
+}
+
+func sshKeyType(pub crypto.PublicKey) string {
+	switch pub.(type) {
+	case ed25519.PublicKey:
+		return sshEd25519
+	case *ecdsa.PublicKey:
+		return sshECDSAP256
+	case *rsa.PublicKey:
+		return sshRSA
+	}
+	return ""
+}
+
+// p256Point is the uncompressed SEC 1 encoding of an ECDSA P-256 key.
+func p256Point(k *ecdsa.PublicKey) ([]byte, error) {
+	e, err := k.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// parseP256Point checks that b is a point on P-256.
+func parseP256Point(b []byte) (*ecdsa.PublicKey, error) {
+	if _, err := ecdh.P256().NewPublicKey(b); err != nil {
+		return nil, errors.New("invalid P-256 public key")
+	}
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(b[1:33]),
+		Y:     new(big.Int).SetBytes(b[33:]),
+	}, nil
+}
+
+// sshPublicBlob is the wire encoding of a public key.
+func sshPublicBlob(pub crypto.PublicKey) ([]byte, error) {
+	if _, err := Algorithm(pub); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		sshString(&buf, []byte(sshEd25519))
+		sshString(&buf, k)
+	case *ecdsa.PublicKey:
+		q, err := p256Point(k)
+		if err != nil {
+			return nil, err
+		}
+		sshString(&buf, []byte(sshECDSAP256))
+		sshString(&buf, []byte(sshNISTP256))
+		sshString(&buf, q)
+	case *rsa.PublicKey:
+		sshString(&buf, []byte(sshRSA))
+		sshMpint(&buf, big.NewInt(int64(k.E)))
+		sshMpint(&buf, k.N)
+	}
+	return buf.Bytes(), nil
+}
+
+func parseSSHPublicBlob(blob []byte) (crypto.PublicKey, error) {
+	r := &sshReader{b: blob}
+	typ := string(r.bytes())
+	var pub crypto.PublicKey
+	switch typ {
+	case sshEd25519:
+		k := r.bytes()
+		if r.err != nil || len(k) != ed25519.PublicKeySize || len(r.b) != 0 {
+			return nil, errors.New("malformed ssh-ed25519 public key")
+		}
+		return ed25519.PublicKey(k), nil
+	case sshECDSAP256:
+		curve := string(r.bytes())
+		q := r.bytes()
+		if r.err != nil || curve != sshNISTP256 || len(r.b) != 0 {
+			return nil, errors.New("malformed ecdsa-sha2-nistp256 public key")
+		}
+		k, err := parseP256Point(q)
+		if err != nil {
+			return nil, err
+		}
+		pub = k
+	case sshRSA:
+		e := r.mpint()
+		n := r.mpint()
+		if r.err != nil || len(r.b) != 0 || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("malformed ssh-rsa public key")
+		}
+		pub = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	default:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, fmt.Errorf("unsupported SSH key type %q", typ)
+	}
+	if _, err := Algorithm(pub); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+// ParseSSHPublicKey decodes a public key in SSH wire format, as listed by
+// an ssh-agent, and returns it with its SSH key type name.
+func ParseSSHPublicKey(blob []byte) (crypto.PublicKey, string, error) {
+	pub, err := parseSSHPublicBlob(blob)
+	if err != nil {
+		return nil, "", err
+	}
+	return pub, sshKeyType(pub), nil
+}
+
+func parseSSHPublic(line string) (crypto.PublicKey, error) {
+	f := strings.Fields(line)
+	if len(f) < 2 {
+		return nil, errors.New("malformed SSH public key line")
+	}
+	blob, err := base64.StdEncoding.DecodeString(f[1])
+	if err != nil {
+		return nil, errors.New("malformed SSH public key line")
+	}
+	pub, err := parseSSHPublicBlob(blob)
+	if err != nil {
+		return nil, err
+	}
+	if sshKeyType(pub) != f[0] {
+		return nil, errors.New("SSH public key type mismatch")
+	}
+	return pub, nil
+}
+
+func parseOpenSSH(b []byte) (crypto.Signer, error) {
+	if !bytes.HasPrefix(b, []byte(openSSHMagic)) {
+		return nil, errors.New("not an openssh-key-v1 key")
+	}
+	r := &sshReader{b: b[len(openSSHMagic):]}
+	cipherName := string(r.bytes())
+	r.bytes() // kdfname
+	r.bytes() // kdfoptions
+	n := r.uint32()
+	pubBlob := r.bytes()
+	priv := r.bytes()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if cipherName != "none" {
+		return nil, errors.New("encrypted OpenSSH keys are not supported; remove the passphrase with \"ssh-keygen -p\" or import into an encrypted PKCS#8 file")
+	}
+	if n != 1 {
+		return nil, fmt.Errorf("OpenSSH key file holds %d keys; expected 1", n)
+	}
+	pr := &sshReader{b: priv}
+	if pr.uint32() != pr.uint32() {
+		return nil, errors.New("OpenSSH key check bytes differ")
+	}
+	outer, err := parseSSHPublicBlob(pubBlob)
+	if err != nil {
+		return nil, err
+	}
+	typ := string(pr.bytes())
+	var key crypto.Signer
+	switch typ {
+	case sshEd25519:
+		pub := pr.bytes()
+		k := pr.bytes()
+		pr.bytes() // comment
+		if pr.err != nil {
+			return nil, pr.err
+		}
+		if len(pub) != ed25519.PublicKeySize || len(k) != ed25519.PrivateKeySize {
+			return nil, errors.New("malformed ssh-ed25519 private key")
+		}
+		priv := ed25519.NewKeyFromSeed(k[:ed25519.SeedSize])
+		if !bytes.Equal(priv[32:], pub) || !bytes.Equal(k[32:], pub) {
+			return nil, errors.New("ssh-ed25519 public key does not match the private key")
+		}
+		key = priv
+	case sshECDSAP256:
+		curve := string(pr.bytes())
+		q := pr.bytes()
+		d := pr.bytes()
+		pr.bytes() // comment
+		if pr.err != nil {
+			return nil, pr.err
+		}
+		dv := new(big.Int).SetBytes(d)
+		if curve != sshNISTP256 || dv.BitLen() > 256 {
+			return nil, errors.New("malformed ecdsa-sha2-nistp256 private key")
+		}
+		// d is an mpint; ecdh wants exactly 32 big-endian bytes.
+		scalar := dv.FillBytes(make([]byte, 32))
+		e, err := ecdh.P256().NewPrivateKey(scalar)
+		if err != nil || !bytes.Equal(e.PublicKey().Bytes(), q) {
+			return nil, errors.New("ecdsa-sha2-nistp256 public key does not match the private key")
+		}
+		pub, _ := parseP256Point(q)
+		key = &ecdsa.PrivateKey{PublicKey: *pub, D: new(big.Int).SetBytes(scalar)}
+	case sshRSA:
+		n, e, d, _, p, q := pr.mpint(), pr.mpint(), pr.mpint(), pr.mpint(), pr.mpint(), pr.mpint()
+		pr.bytes() // comment
+		if pr.err != nil {
+			return nil, pr.err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("malformed ssh-rsa private key")
+		}
+		priv := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: n, E: int(e.Int64())},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		if err := priv.Validate(); err != nil {
+			return nil, fmt.Errorf("malformed ssh-rsa private key: %w", err)
+		}
+		priv.Precompute()
+		key = priv
+	default:
+		if pr.err != nil {
+			return nil, pr.err
+		}
+		return nil, fmt.Errorf("unsupported SSH key type %q", typ)
+	}
+	if !publicEqual(outer, key.Public()) {
+		return nil, errors.New("OpenSSH public key does not match the private key")
+	}
+	return checkSigner(key)
+}
+
+// publicEqual compares two supported public keys.
+func publicEqual(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(b)
+}
+
+func marshalOpenSSH(key crypto.Signer) ([]byte, error) {
+	pubBlob, err := sshPublicBlob(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	var check [4]byte
+	if _, err := rand.Read(check[:]); err != nil {
+		return nil, err
+	}
+	var priv bytes.Buffer
+	priv.Write(check[:])
+	priv.Write(check[:])
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		sshString(&priv, []byte(sshEd25519))
+		sshString(&priv, k[32:])
+		sshString(&priv, k)
+	case *ecdsa.PrivateKey:
+		q, err := p256Point(&k.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		sshString(&priv, []byte(sshECDSAP256))
+		sshString(&priv, []byte(sshNISTP256))
+		sshString(&priv, q)
+		sshMpint(&priv, k.D)
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return nil, errors.New("multi-prime RSA keys cannot be written as OpenSSH keys")
+		}
+		k.Precompute()
+		sshString(&priv, []byte(sshRSA))
+		sshMpint(&priv, k.N)
+		sshMpint(&priv, big.NewInt(int64(k.E)))
+		sshMpint(&priv, k.D)
+		sshMpint(&priv, k.Precomputed.Qinv)
+		sshMpint(&priv, k.Primes[0])
+		sshMpint(&priv, k.Primes[1])
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	sshString(&priv, nil) // comment
+	for i := byte(1); priv.Len()%8 != 0; i++ {
+		priv.WriteByte(i)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(openSSHMagic)
+	sshString(&buf, []byte("none"))
+	sshString(&buf, []byte("none"))
+	sshString(&buf, nil)
+	buf.Write([]byte{0, 0, 0, 1})
+	sshString(&buf, pubBlob)
+	sshString(&buf, priv.Bytes())
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,412 @@
+package sigenv
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"policyguardian/internal/shared/hashing"
+	"policyguardian/internal/shared/jcs"
+	"policyguardian/internal/shared/keys"
+)
+
+// Schema is the schema identifier of detached signature envelopes shared by
+// PolicyLock snapshot packs and Consent Guardian records.
+const Schema = "policyguardian.signature_envelope.v0.1"
+
+// Envelope is a detached signature over JCS sign payload bytes.
+// payload_hashes["sha2-256"] equals the artifact ID (snapshot_id / consent_event_id).
+type Envelope struct {
+	Schema        string            `json:"schema"`
+	Algorithm     string            `json:"algorithm"`
+	PublicKey     string            `json:"public_key"`
+	Signature     string            `json:"signature"`
+	PayloadHashes map[string]string `json:"payload_hashes"`
+
+	// KeyID is keys.KeyID of the public key; envelopes written before key
+	// files were supported omit it.
+	KeyID string `json:"key_id,omitempty"`
+	// CertChain optionally holds the signer's X.509 certificate chain as
+	// base64 DER, leaf first. The leaf certifies PublicKey; see VerifyChain.
+	CertChain []string `json:"cert_chain,omitempty"`
+}
+
+// algorithm is one entry of the signature algorithm registry.
+type algorithm struct {
+	// opts is passed to crypto.Signer.Sign; when opts.HashFunc() is set
+	// the signer receives the digest of the sign payload.
+	opts crypto.SignerOpts
+	// verify checks sig over the sign payload bytes.
+	verify func(pub crypto.PublicKey, signBytes, sig []byte) bool
+}
+
+var pssOptions = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+
+// algorithms is the registry, keyed by envelope algorithm name
+// (keys.Algorithms). Ed25519 signs the payload itself; ECDSA P-256 (ASN.1
+// DER signatures) and RSA-PSS (salt length 32) sign its sha2-256.
+var algorithms = map[string]algorithm{
+	keys.AlgEd25519: {
+		opts: crypto.Hash(0),
+		verify: func(pub crypto.PublicKey, signBytes, sig []byte) bool {
+			k, ok := pub.(ed25519.PublicKey)
+			return ok && len(sig) == ed25519.SignatureSize && ed25519.Verify(k, signBytes, sig)
+		},
+	},
+	keys.AlgECDSAP256: {
+		opts: crypto.SHA256,
+		verify: func(pub crypto.PublicKey, signBytes, sig []byte) bool {
+			k, ok := pub.(*ecdsa.PublicKey)
+			digest := sha256.Sum256(signBytes)
+			return ok && ecdsa.VerifyASN1(k, digest[:], sig)
+		},
+	},
+	keys.AlgRSAPSS: {
+		opts: pssOptions,
+		verify: func(pub crypto.PublicKey, signBytes, sig []byte) bool {
+			k, ok := pub.(*rsa.PublicKey)
+			digest := sha256.Sum256(signBytes)
+			return ok && rsa.VerifyPSS(k, crypto.SHA256, digest[:], sig, pssOptions) == nil
+		},
+	},
+}
+
+// PayloadSigner is a crypto.Signer that must be given the sign payload
+// itself rather than its digest, such as an ssh-agent, which hashes the
+// data it signs. Sign calls SignPayload instead of Sign for such signers;
+// the signature encoding is the same.
+type PayloadSigner interface {
+	crypto.Signer
+	SignPayload(signBytes []byte) ([]byte, error)
+}
+
+// Supported reports whether alg names a registered signature algorithm.
+func Supported(alg string) bool {
+	_, ok := algorithms[alg]
+	return ok
+}
+
+// ParseEd25519PrivateKeyHex decodes a 64-byte Ed25519 private key given as hex.
+func ParseEd25519PrivateKeyHex(s string) (ed25519.PrivateKey, error) {
+	priv, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errors.New("invalid ed25519 private key hex")
+	}
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid ed25519 private key length: %d", len(priv))
+	}
+	return ed25519.PrivateKey(priv), nil
+}
+
+// ResolveSigner picks the signing key of an options struct: signer, else the
+// key file at keyFile (decrypted with passphrase), else the legacy hex key.
+// Setting more than one is an error; setting none returns nil.
+func ResolveSigner(signer crypto.Signer, keyFile string, passphrase []byte, privHex string) (crypto.Signer, error) {
+	n := 0
+	for _, set := range []bool{signer != nil, keyFile != "", privHex != ""} {
+		if set {
+			n++
+		}
+	}
+	switch {
+	case n > 1:
+		return nil, errors.New("set only one of a signer, a key file or a hex private key")
+	case signer != nil:
+		return signer, nil
+	case keyFile != "":
+		return keys.LoadSigner(keyFile, passphrase)
+	case privHex != "":
+		return ParseEd25519PrivateKeyHex(privHex)
+	}
+	return nil, nil
+}
+
+// SignEd25519 signs signBytes and returns the envelope plus its canonical JSON bytes.
+func SignEd25519(priv ed25519.PrivateKey, signBytes []byte) (*Envelope, []byte, error) {
+	return Sign(priv, signBytes)
+}
+
+// Sign signs signBytes with a crypto.Signer (an in-memory key or one held
+// elsewhere) and returns the envelope plus its canonical JSON bytes. The
+// algorithm follows from the key type (keys.Algorithm).
+func Sign(signer crypto.Signer, signBytes []byte) (*Envelope, []byte, error) {
+	return SignWithChain(signer, nil, signBytes)
+}
+
+// SignWithChain is Sign that also embeds the signer's certificate chain
+// (leaf first) as cert_chain. The leaf must certify the signing key.
+func SignWithChain(signer crypto.Signer, chain []*x509.Certificate, signBytes []byte) (*Envelope, []byte, error) {
+	pub := signer.Public()
+	if len(chain) > 0 && !publicKeyEqual(chain[0].PublicKey, pub) {
+		return nil, nil, errors.New("signer certificate does not certify the signing key")
+	}
+	name, err := keys.Algorithm(pub)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unsupported signing key: %w", err)
+	}
+	alg := algorithms[name]
+	pubHex, err := keys.PublicKeyHex(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyID, err := keys.KeyID(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	var sig []byte
+	if ps, ok := signer.(PayloadSigner); ok {
+		sig, err = ps.SignPayload(signBytes)
+	} else {
+		msg := signBytes
+		if alg.opts.HashFunc() != 0 {
+			digest := sha256.Sum256(signBytes)
+			msg = digest[:]
+		}
+		sig, err = signer.Sign(rand.Reader, msg, alg.opts)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !alg.verify(pub, signBytes, sig) {
+		return nil, nil, errors.New("signer returned an invalid signature")
+	}
+	env := &Envelope{
+		Schema:    Schema,
+		Algorithm: name,
+		PublicKey: pubHex,
+		KeyID:     keyID,
+		Signature: hex.EncodeToString(sig),
+		PayloadHashes: map[string]string{
+			"sha2-256": hashing.SHA256Hex(signBytes),
+		},
+	}
+	for _, c := range chain {
+		env.CertChain = append(env.CertChain, base64.StdEncoding.EncodeToString(c.Raw))
+	}
+	raw, err := Marshal(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	return env, raw, nil
+}
+
+// Marshal returns the canonical (JCS) bytes of an envelope.
+func Marshal(env *Envelope) ([]byte, error) {
+	raw, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	return jcs.CanonicalizeJSON(raw)
+}
+
+// Parse decodes an envelope. It returns a reason code on failure.
+func Parse(raw []byte) (*Envelope, string) {
+	var env Envelope
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&env); err != nil {
+		return nil, "invalid_signature_json"
+	}
+	return &env, ""
+}
+
+// SignerPublicKey decodes public_key and checks that it belongs to the
+// envelope's algorithm.
+func (env *Envelope) SignerPublicKey() (crypto.PublicKey, error) {
+	pub, err := keys.ParsePublicKeyHex(env.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if alg, _ := keys.Algorithm(pub); alg != env.Algorithm {
+		return nil, fmt.Errorf("%s public key in a %s envelope", alg, env.Algorithm)
+	}
+	return pub, nil
+}
+
+// SignerKeyID derives the key ID from public_key, ignoring key_id. It
+// returns "" when the public key is malformed.
+func (env *Envelope) SignerKeyID() string {
+	pub, err := env.SignerPublicKey()
+	if err != nil {
+		return ""
+	}
+	id, _ := keys.KeyID(pub)
+	return id
+}
+
+// Verify checks an envelope against the expected sign payload bytes.
+// It returns "" on success, otherwise a stable reason code.
+func Verify(env *Envelope, signBytes []byte) string {
+	if env.Schema != Schema {
+		return "wrong_signature_schema"
+	}
+	alg, ok := algorithms[env.Algorithm]
+	if !ok {
+		return "wrong_signature_algorithm"
+	}
+	ph, ok := env.PayloadHashes["sha2-256"]
+	if !ok || ph == "" {
+		return "missing_signature_payload_hash"
+	}
+	if ph != hashing.SHA256Hex(signBytes) {
+		return "signature_payload_hash_mismatch"
+	}
+	pub, err := env.SignerPublicKey()
+	if err != nil {
+		return "invalid_public_key"
+	}
+	if env.KeyID != "" && env.SignerKeyID() != env.KeyID {
+		return "signer_key_id_mismatch"
+	}
+	sig, err := hex.DecodeString(strings.TrimSpace(env.Signature))
+	if err != nil || len(sig) == 0 {
+		return "invalid_signature"
+	}
+	if env.Algorithm == keys.AlgEd25519 && len(sig) != ed25519.SignatureSize {
+		return "invalid_signature"
+	}
+	if !alg.verify(pub, signBytes, sig) {
+		return "signature_verify_failed"
+	}
+	return ""
+}
+
+// publicKeyEqual compares two public keys of the supported types.
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(b)
+}
+
+// LoadCertChain reads the PEM certificates in path, in file order.
+func LoadCertChain(path string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		chain = append(chain, c)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no PEM certificates in %s", path)
+	}
+	return chain, nil
+}
+
+// Certificates decodes cert_chain; it returns nil for envelopes without one.
+func (env *Envelope) Certificates() ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for _, s := range env.CertChain {
+		der, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, c)
+	}
+	return chain, nil
+}
+
+// oidExtKeyUsageDocumentSigning is id-kp-documentSigning (RFC 9336).
+var oidExtKeyUsageDocumentSigning = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 36}
+
+// signingCertificate reports whether a leaf may sign documents: its key
+// usage must include digitalSignature or contentCommitment (nonRepudiation)
+// and its extended key usage, when present, must allow any purpose,
+// documentSigning or emailProtection.
+func signingCertificate(c *x509.Certificate) bool {
+	if c.KeyUsage&(x509.KeyUsageDigitalSignature|x509.KeyUsageContentCommitment) == 0 {
+		return false
+	}
+	if len(c.ExtKeyUsage) == 0 && len(c.UnknownExtKeyUsage) == 0 {
+		return true
+	}
+	for _, u := range c.ExtKeyUsage {
+		if u == x509.ExtKeyUsageAny || u == x509.ExtKeyUsageEmailProtection {
+			return true
+		}
+	}
+	for _, oid := range c.UnknownExtKeyUsage {
+		if oid.Equal(oidExtKeyUsageDocumentSigning) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyChain checks that cert_chain certifies the envelope's public key
+// and chains to roots at time at (every certificate must be valid then),
+// with a leaf usable for signing. Revocation is not checked. It returns
+// the leaf, or a reason code.
+func VerifyChain(env *Envelope, roots *x509.CertPool, at time.Time) (*x509.Certificate, string) {
+	if len(env.CertChain) == 0 {
+		return nil, "signer_certificate_missing"
+	}
+	chain, err := env.Certificates()
+	if err != nil {
+		return nil, "invalid_signer_certificate"
+	}
+	leaf := chain[0]
+	pub, err := env.SignerPublicKey()
+	if err != nil || !publicKeyEqual(leaf.PublicKey, pub) {
+		return nil, "signer_certificate_key_mismatch"
+	}
+	if !signingCertificate(leaf) {
+		return nil, "signer_certificate_key_usage"
+	}
+	inter := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		inter.AddCert(c)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: inter,
+		CurrentTime:   at,
+		// The leaf's extended key usage is checked by signingCertificate.
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	var invalid x509.CertificateInvalidError
+	var unknown x509.UnknownAuthorityError
+	switch {
+	case err == nil:
+		return leaf, ""
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		if at.Before(invalid.Cert.NotBefore) {
+			return nil, "signer_certificate_not_yet_valid"
+		}
+		return nil, "signer_certificate_expired"
+	case errors.As(err, &unknown):
+		return nil, "signer_certificate_untrusted"
+	}
+	return nil, "signer_certificate_invalid"
+}
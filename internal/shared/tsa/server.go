@@ -0,0 +1,307 @@
+package tsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultPolicy is the TSA policy OID used by the built-in server. It sits
+// under the ITU-T X.660 example arc; deployments should set their own.
+var DefaultPolicy = asn1.ObjectIdentifier{2, 999, 3161, 1}
+
+var (
+	oidExtKeyUsage    = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidKPTimeStamping = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+)
+
+const (
+	KeyFile  = "tsa_key.pem"
+	CertFile = "tsa_cert.pem"
+)
+
+// Server is a minimal RFC 3161 time-stamping authority intended for tests and
+// air-gapped deployments. It answers application/timestamp-query POSTs.
+type Server struct {
+	Signer crypto.Signer
+	Cert   *x509.Certificate
+	Policy asn1.ObjectIdentifier
+	// Now is overridable for tests; defaults to time.Now.
+	Now func() time.Time
+
+	mu     sync.Mutex
+	serial *big.Int
+}
+
+// LoadOrCreate loads tsa_key.pem / tsa_cert.pem from dir, generating an
+// ECDSA P-256 key and a self-signed timeStamping certificate when absent.
+// The certificate doubles as the trust root handed to verifiers.
+func LoadOrCreate(dir string) (*Server, error) {
+	keyPath := filepath.Join(dir, KeyFile)
+	certPath := filepath.Join(dir, CertFile)
+	if _, err := os.Stat(keyPath); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		keyPEM, certPEM, err := generate()
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+			return nil, err
+		}
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(keyPEM, certPEM)
+}
+
+// NewServer builds a Server from a PKCS#8 private key PEM and its certificate PEM.
+func NewServer(keyPEM, certPEM []byte) (*Server, error) {
+	kb, _ := pem.Decode(keyPEM)
+	if kb == nil {
+		return nil, errors.New("tsa: key file is not PEM")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(kb.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("tsa: unsupported key type")
+	}
+	cb, _ := pem.Decode(certPEM)
+	if cb == nil {
+		return nil, errors.New("tsa: cert file is not PEM")
+	}
+	cert, err := x509.ParseCertificate(cb.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{Signer: signer, Cert: cert, Policy: DefaultPolicy}, nil
+}
+
+func generate() (keyPEM, certPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, nil, err
+	}
+	// RFC 3161 §2.3: the timeStamping EKU must be the only one and critical.
+	eku, err := asn1.Marshal([]asn1.ObjectIdentifier{oidKPTimeStamping})
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Policy Guardian TSA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtraExtensions:       []pkix.Extension{{Id: oidExtKeyUsage, Critical: true, Value: eku}},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return keyPEM, certPEM, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST application/timestamp-query", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, "read error", http.StatusBadRequest)
+		return
+	}
+	resp, err := s.Respond(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.Write(resp)
+}
+
+// PKIFailureInfo bits (RFC 3161 §2.4.2).
+const (
+	failBadAlg        = 0
+	failBadDataFormat = 5
+)
+
+func rejection(bit int) ([]byte, error) {
+	fi := asn1.BitString{Bytes: make([]byte, 1+bit/8), BitLength: bit + 1}
+	fi.Bytes[bit/8] |= 0x80 >> uint(bit%8)
+	return asn1.Marshal(timeStampResp{Status: pkiStatusInfo{Status: 2, FailInfo: fi}})
+}
+
+// Respond answers a DER TimeStampReq with a DER TimeStampResp. Malformed or
+// unsupported requests yield a rejection response, not an error.
+func (s *Server) Respond(reqDER []byte) ([]byte, error) {
+	var req timeStampReq
+	if rest, err := asn1.Unmarshal(reqDER, &req); err != nil || len(rest) != 0 || req.Version != 1 {
+		return rejection(failBadDataFormat)
+	}
+	h, ok := hashForOID(req.MessageImprint.HashAlgorithm.Algorithm)
+	if !ok || len(req.MessageImprint.HashedMessage) != h.Size() {
+		return rejection(failBadAlg)
+	}
+	token, err := s.issue(req)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(timeStampResp{Status: pkiStatusInfo{Status: 0}, TimeStampToken: asn1.RawValue{FullBytes: token}})
+}
+
+func (s *Server) nextSerial() *big.Int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.serial == nil {
+		s.serial = big.NewInt(time.Now().UnixNano())
+	}
+	s.serial.Add(s.serial, big.NewInt(1))
+	return new(big.Int).Set(s.serial)
+}
+
+func (s *Server) issue(req timeStampReq) ([]byte, error) {
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	policy := s.Policy
+	if len(policy) == 0 {
+		policy = DefaultPolicy
+	}
+	info, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         policy,
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   s.nextSerial(),
+		GenTime:        now().UTC().Truncate(time.Second),
+		Nonce:          req.Nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256(info)
+	certHash := sha256.Sum256(s.Cert.Raw)
+	// SigningCertificateV2 { certs SEQUENCE OF ESSCertIDv2 { certHash } },
+	// hashAlgorithm defaults to sha2-256 (RFC 5816).
+	essCert, err := asn1.Marshal(struct{ Certs []struct{ Hash []byte } }{
+		Certs: []struct{ Hash []byte }{{Hash: certHash[:]}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var attrs [][]byte
+	for _, a := range []struct {
+		oid asn1.ObjectIdentifier
+		val any
+	}{
+		{oidContentType, oidTSTInfo},
+		{oidMessageDigest, digest[:]},
+		{oidSigningCertV2, asn1.RawValue{FullBytes: essCert}},
+	} {
+		v, err := asn1.Marshal(a.val)
+		if err != nil {
+			return nil, err
+		}
+		b, err := asn1.Marshal(attribute{Type: a.oid, Values: []asn1.RawValue{{FullBytes: v}}})
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, b)
+	}
+	// DER SET OF: elements sorted by their encodings.
+	sort.Slice(attrs, func(i, j int) bool { return bytes.Compare(attrs[i], attrs[j]) < 0 })
+	attrBytes := bytes.Join(attrs, nil)
+	signedSet, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: attrBytes})
+	if err != nil {
+		return nil, err
+	}
+
+	var sigAlg asn1.ObjectIdentifier
+	var sig []byte
+	switch s.Signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		sigAlg = oidECDSAWithSHA256
+		d := sha256.Sum256(signedSet)
+		sig, err = s.Signer.Sign(rand.Reader, d[:], crypto.SHA256)
+	case *rsa.PublicKey:
+		sigAlg = oidSHA256WithRSA
+		d := sha256.Sum256(signedSet)
+		sig, err = s.Signer.Sign(rand.Reader, d[:], crypto.SHA256)
+	case ed25519.PublicKey:
+		sigAlg = oidEd25519
+		sig, err = s.Signer.Sign(rand.Reader, signedSet, crypto.Hash(0))
+	default:
+		return nil, errors.New("tsa: unsupported signer key type")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: encapContentInfo{EContentType: oidTSTInfo, EContent: info},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                issuerAndSerial{Issuer: asn1.RawValue{FullBytes: s.Cert.RawIssuer}, SerialNumber: s.Cert.SerialNumber},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrBytes},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: sigAlg},
+			Signature:          sig,
+		}},
+	}
+	if req.CertReq {
+		sd.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: s.Cert.Raw}
+	}
+	sdDER, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sdDER}})
+}
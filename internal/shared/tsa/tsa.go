@@ -0,0 +1,394 @@
+package tsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// RFC 3161 time-stamp protocol: request, token verification and a minimal
+// server (see server.go). Tokens are CMS SignedData (RFC 5652) over TSTInfo.
+
+var (
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningCertV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+	Extensions     asn1.RawValue         `asn1:"optional,tag:0"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional,default:false"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// Content is the [0] EXPLICIT wrapper; its Bytes hold the inner DER.
+// encoding/asn1 does not apply explicit tags to RawValue on Marshal.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type encapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// Info describes a verified time-stamp token.
+type Info struct {
+	GenTime      time.Time
+	SerialNumber *big.Int
+	Policy       string
+	Signer       *x509.Certificate
+	// ChainVerified is true when the signer chained to the caller's roots.
+	ChainVerified bool
+}
+
+func hashForOID(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+// NewRequest returns a DER TimeStampReq for a SHA-256 digest.
+func NewRequest(digest []byte, nonce *big.Int) ([]byte, error) {
+	if len(digest) != crypto.SHA256.Size() {
+		return nil, errors.New("sha2-256 digest required")
+	}
+	return asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+}
+
+// Request asks the TSA at url to time-stamp a SHA-256 digest and returns the
+// DER TimeStampToken. The token's imprint and nonce are checked; its
+// signature is checked by Verify.
+func Request(url string, digest []byte) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	reqDER, err := NewRequest(digest, nonce)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(url, "application/timestamp-query", bytes.NewReader(reqDER))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	var tr timeStampResp
+	if rest, err := asn1.Unmarshal(body, &tr); err != nil || len(rest) != 0 {
+		return nil, errors.New("invalid TimeStampResp")
+	}
+	if tr.Status.Status != 0 && tr.Status.Status != 1 {
+		return nil, fmt.Errorf("request rejected (status %d)", tr.Status.Status)
+	}
+	token := tr.TimeStampToken.FullBytes
+	if len(token) == 0 {
+		return nil, errors.New("response carries no token")
+	}
+	_, info, err := parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return nil, errors.New("token imprint does not match request")
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("token nonce does not match request")
+	}
+	return token, nil
+}
+
+func parseToken(token []byte) (*signedData, *tstInfo, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(token, &ci); err != nil || len(rest) != 0 {
+		return nil, nil, errors.New("invalid ContentInfo")
+	}
+	if !ci.ContentType.Equal(oidSignedData) || ci.Content.Class != asn1.ClassContextSpecific || ci.Content.Tag != 0 {
+		return nil, nil, errors.New("token is not SignedData")
+	}
+	var sd signedData
+	if rest, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil || len(rest) != 0 {
+		return nil, nil, errors.New("invalid SignedData")
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, nil, errors.New("content is not TSTInfo")
+	}
+	var info tstInfo
+	if rest, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil || len(rest) != 0 {
+		return nil, nil, errors.New("invalid TSTInfo")
+	}
+	return &sd, &info, nil
+}
+
+// Verify checks a DER TimeStampToken against the SHA-256 digest it should
+// cover. The CMS signature is always verified. When roots is non-nil the
+// signer certificate must chain to roots at genTime and carry the
+// timeStamping extended key usage. It returns a reason code on failure.
+func Verify(token, digest []byte, roots *x509.CertPool) (*Info, string) {
+	sd, info, err := parseToken(token)
+	if err != nil {
+		return nil, "timestamp_token_invalid"
+	}
+	if h, ok := hashForOID(info.MessageImprint.HashAlgorithm.Algorithm); !ok || h != crypto.SHA256 {
+		return nil, "timestamp_hash_algorithm_unsupported"
+	}
+	if !bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return nil, "timestamp_imprint_mismatch"
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, "timestamp_token_invalid"
+	}
+	si := sd.SignerInfos[0]
+
+	var certs []*x509.Certificate
+	if len(sd.Certificates.Bytes) > 0 {
+		certs, err = x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, "timestamp_token_invalid"
+		}
+	}
+	var signer *x509.Certificate
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, si.SID.Issuer.FullBytes) && c.SerialNumber.Cmp(si.SID.SerialNumber) == 0 {
+			signer = c
+			break
+		}
+	}
+	if signer == nil {
+		return nil, "timestamp_signer_missing"
+	}
+
+	// Signed attributes: content-type must be TSTInfo and message-digest must
+	// match eContent.
+	h, ok := hashForOID(si.DigestAlgorithm.Algorithm)
+	if !ok || len(si.SignedAttrs.Bytes) == 0 {
+		return nil, "timestamp_token_invalid"
+	}
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(si.SignedAttrs.FullBytes, &attrs, "set,tag:0"); err != nil {
+		return nil, "timestamp_token_invalid"
+	}
+	var gotType, gotDigest bool
+	for _, a := range attrs {
+		if len(a.Values) != 1 {
+			continue
+		}
+		switch {
+		case a.Type.Equal(oidContentType):
+			var ct asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(a.Values[0].FullBytes, &ct); err != nil || !ct.Equal(oidTSTInfo) {
+				return nil, "timestamp_token_invalid"
+			}
+			gotType = true
+		case a.Type.Equal(oidMessageDigest):
+			var md []byte
+			if _, err := asn1.Unmarshal(a.Values[0].FullBytes, &md); err != nil {
+				return nil, "timestamp_token_invalid"
+			}
+			hh := h.New()
+			hh.Write(sd.EncapContentInfo.EContent)
+			if !bytes.Equal(md, hh.Sum(nil)) {
+				return nil, "timestamp_content_digest_mismatch"
+			}
+			gotDigest = true
+		}
+	}
+	if !gotType || !gotDigest {
+		return nil, "timestamp_token_invalid"
+	}
+
+	// The signature covers the DER SET OF signed attributes (tag 0x31).
+	signed := append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+	algo, ok := signatureAlgorithm(si.SignatureAlgorithm.Algorithm, h)
+	if !ok {
+		return nil, "timestamp_signature_algorithm_unsupported"
+	}
+	if err := signer.CheckSignature(algo, signed, si.Signature); err != nil {
+		return nil, "timestamp_signature_invalid"
+	}
+
+	out := &Info{
+		GenTime:      info.GenTime.UTC(),
+		SerialNumber: info.SerialNumber,
+		Policy:       info.Policy.String(),
+		Signer:       signer,
+	}
+	if roots != nil {
+		inter := x509.NewCertPool()
+		for _, c := range certs {
+			if c != signer {
+				inter.AddCert(c)
+			}
+		}
+		_, err := signer.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: inter,
+			CurrentTime:   out.GenTime,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		})
+		if err != nil {
+			return nil, "timestamp_chain_invalid"
+		}
+		out.ChainVerified = true
+	}
+	return out, ""
+}
+
+func signatureAlgorithm(oid asn1.ObjectIdentifier, h crypto.Hash) (x509.SignatureAlgorithm, bool) {
+	switch {
+	case oid.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256, true
+	case oid.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384, true
+	case oid.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512, true
+	case oid.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA, true
+	case oid.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA, true
+	case oid.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA, true
+	case oid.Equal(oidEd25519):
+		return x509.PureEd25519, true
+	case oid.Equal(oidRSAEncryption):
+		// Many TSAs name the key algorithm and rely on the digest algorithm.
+		switch h {
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, true
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, true
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, true
+		}
+	}
+	return 0, false
+}
+
+// LoadRoots reads PEM certificates from path into a pool of trust roots.
+func LoadRoots(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no PEM certificates in %s", path)
+	}
+	return pool, nil
+}
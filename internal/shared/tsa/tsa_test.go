@@ -0,0 +1,85 @@
+package tsa
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testGenTime must fall inside the generated certificate's validity window.
+var testGenTime = time.Now().UTC().Truncate(time.Second)
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	s, err := LoadOrCreate(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Now = func() time.Time { return testGenTime }
+	hs := httptest.NewServer(s)
+	t.Cleanup(hs.Close)
+	return s, hs
+}
+
+func TestRequestAndVerify(t *testing.T) {
+	s, hs := newTestServer(t)
+	digest := sha256.Sum256([]byte("sign payload"))
+	token, err := Request(hs.URL, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(s.Cert)
+	info, reason := Verify(token, digest[:], roots)
+	if reason != "" {
+		t.Fatalf("verify: %s", reason)
+	}
+	if !info.ChainVerified || !info.GenTime.Equal(testGenTime) {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+	if info.Policy != DefaultPolicy.String() {
+		t.Fatalf("policy = %s", info.Policy)
+	}
+
+	// Without roots the CMS signature is still checked, the chain is not.
+	if info, reason := Verify(token, digest[:], nil); reason != "" || info.ChainVerified {
+		t.Fatalf("rootless verify: %q %+v", reason, info)
+	}
+
+	other := sha256.Sum256([]byte("other payload"))
+	if _, reason := Verify(token, other[:], roots); reason != "timestamp_imprint_mismatch" {
+		t.Fatalf("imprint: got %q", reason)
+	}
+
+	s2, _ := newTestServer(t)
+	wrong := x509.NewCertPool()
+	wrong.AddCert(s2.Cert)
+	if _, reason := Verify(token, digest[:], wrong); reason != "timestamp_chain_invalid" {
+		t.Fatalf("chain: got %q", reason)
+	}
+
+	tampered := append([]byte(nil), token...)
+	tampered[len(tampered)-5] ^= 0xff
+	if _, reason := Verify(tampered, digest[:], roots); reason == "" {
+		t.Fatal("tampered token verified")
+	}
+}
+
+func TestRespondRejectsBadRequest(t *testing.T) {
+	s, _ := newTestServer(t)
+	resp, err := s.Respond([]byte("not der"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tr timeStampResp
+	if _, err := asn1.Unmarshal(resp, &tr); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Status.Status != 2 || len(tr.TimeStampToken.FullBytes) != 0 {
+		t.Fatalf("expected rejection, got status %d", tr.Status.Status)
+	}
+}
@@ -0,0 +1,201 @@
+// Package warc reads and writes WARC 1.1 (ISO 28500) records. Files may be
+// plain or compressed with one gzip member per record (.warc.gz).
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const Version = "WARC/1.1"
+
+// Field is one named header field; records keep them in order.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Record is a WARC record. Fields excludes Content-Length, which is derived
+// from Block when writing.
+type Record struct {
+	Version string
+	Fields  []Field
+	Block   []byte
+}
+
+// Get returns the first value of a field (case-insensitive), or "".
+func (r *Record) Get(name string) string {
+	for _, f := range r.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Type is the WARC-Type field.
+func (r *Record) Type() string { return r.Get("WARC-Type") }
+
+// Write writes records in order. With gz each record is its own gzip member.
+func Write(w io.Writer, recs []Record, gz bool) error {
+	for _, rec := range recs {
+		var buf bytes.Buffer
+		v := rec.Version
+		if v == "" {
+			v = Version
+		}
+		buf.WriteString(v + "\r\n")
+		for _, f := range rec.Fields {
+			if strings.EqualFold(f.Name, "Content-Length") {
+				continue
+			}
+			if strings.ContainsAny(f.Name, ":\r\n") || strings.ContainsAny(f.Value, "\r\n") {
+				return fmt.Errorf("invalid WARC field %q", f.Name)
+			}
+			buf.WriteString(f.Name + ": " + f.Value + "\r\n")
+		}
+		buf.WriteString("Content-Length: " + strconv.Itoa(len(rec.Block)) + "\r\n\r\n")
+		buf.Write(rec.Block)
+		buf.WriteString("\r\n\r\n")
+		if !gz {
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			continue
+		}
+		zw := gzip.NewWriter(w)
+		if _, err := zw.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read parses every record of a WARC file, gzip-compressed or not.
+func Read(data []byte) ([]Record, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	br := bufio.NewReader(r)
+	var recs []Record
+	for n := 1; ; n++ {
+		rec, err := readRecord(br)
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", n, err)
+		}
+		recs = append(recs, rec)
+	}
+}
+
+func readRecord(br *bufio.Reader) (Record, error) {
+	var line string
+	var err error
+	// Skip blank lines between records.
+	for line == "" {
+		line, err = br.ReadString('\n')
+		if err == io.EOF && strings.TrimSpace(line) == "" {
+			return Record{}, io.EOF
+		}
+		if err != nil {
+			return Record{}, io.ErrUnexpectedEOF
+		}
+		line = strings.TrimRight(line, "\r\n")
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return Record{}, fmt.Errorf("expected WARC version line, got %q", line)
+	}
+	rec := Record{Version: line}
+	length := -1
+	for {
+		line, err = br.ReadString('\n')
+		if err != nil {
+			return Record{}, io.ErrUnexpectedEOF
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(rec.Fields) > 0 {
+			// Folded continuation line.
+			rec.Fields[len(rec.Fields)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return Record{}, fmt.Errorf("malformed header line %q", line)
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(value); err != nil || length < 0 {
+				return Record{}, fmt.Errorf("invalid Content-Length %q", value)
+			}
+			continue
+		}
+		rec.Fields = append(rec.Fields, Field{name, value})
+	}
+	if length < 0 {
+		return Record{}, errors.New("missing Content-Length")
+	}
+	rec.Block = make([]byte, length)
+	if _, err := io.ReadFull(br, rec.Block); err != nil {
+		return Record{}, io.ErrUnexpectedEOF
+	}
+	return rec, nil
+}
+
+// Digest returns "sha256:<base32>", the usual WARC digest form.
+func Digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// CheckDigest reports whether a WARC-Block-Digest or WARC-Payload-Digest
+// value matches b. sha1 and sha256 in base32 or hex are understood; other
+// algorithms are an error.
+func CheckDigest(digest string, b []byte) (bool, error) {
+	alg, val, ok := strings.Cut(digest, ":")
+	if !ok {
+		return false, fmt.Errorf("malformed digest %q", digest)
+	}
+	var h hash.Hash
+	switch strings.ToLower(strings.ReplaceAll(alg, "-", "")) {
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return false, fmt.Errorf("unsupported digest algorithm %q", alg)
+	}
+	h.Write(b)
+	sum := h.Sum(nil)
+	want, err := base32.StdEncoding.DecodeString(strings.ToUpper(val))
+	if err != nil || len(want) != len(sum) {
+		if want, err = hex.DecodeString(val); err != nil {
+			return false, fmt.Errorf("malformed digest %q", digest)
+		}
+	}
+	return bytes.Equal(want, sum), nil
+}
@@ -0,0 +1,74 @@
+package warc
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base32"
+	"testing"
+)
+
+func TestWriteReadRoundTrip(t *testing.T) {
+	recs := []Record{
+		{Fields: []Field{{"WARC-Type", "warcinfo"}, {"WARC-Record-ID", "<urn:uuid:1>"}}, Block: []byte("software: test\r\n")},
+		{Fields: []Field{{"WARC-Type", "resource"}, {"WARC-Target-URI", "urn:x"}, {"Content-Length", "999"}}, Block: []byte{0, 1, 2, '\r', '\n'}},
+	}
+	for _, gz := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := Write(&buf, recs, gz); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Read(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[1].Type() != "resource" || got[1].Get("warc-target-uri") != "urn:x" || !bytes.Equal(got[1].Block, recs[1].Block) {
+			t.Fatalf("gz=%v: %+v", gz, got)
+		}
+		if got[0].Version != Version || len(got[1].Fields) != 2 {
+			t.Fatalf("gz=%v: version %q fields %v", gz, got[0].Version, got[1].Fields)
+		}
+	}
+	if err := Write(&bytes.Buffer{}, []Record{{Fields: []Field{{"X", "a\r\nb"}}}}, false); err == nil {
+		t.Fatalf("expected error for CRLF in field value")
+	}
+}
+
+func TestReadForeign(t *testing.T) {
+	// WARC/1.0 with a folded field and no trailing blank lines.
+	data := []byte("WARC/1.0\r\nWARC-Type: response\r\nWARC-Target-URI: http://e.com/\r\nX-Note: a\r\n  b\r\nContent-Length: 3\r\n\r\nabc")
+	recs, err := Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].Version != "WARC/1.0" || recs[0].Get("X-Note") != "a b" || string(recs[0].Block) != "abc" {
+		t.Fatalf("%+v", recs)
+	}
+	if _, err := Read([]byte("WARC/1.1\r\nWARC-Type: x\r\nContent-Length: 10\r\n\r\nabc")); err == nil {
+		t.Fatalf("expected error for truncated block")
+	}
+	if _, err := Read([]byte("HTTP/1.1 200 OK\r\n\r\n")); err == nil {
+		t.Fatalf("expected error for non-WARC input")
+	}
+}
+
+func TestCheckDigest(t *testing.T) {
+	b := []byte("hello")
+	s1 := sha1.Sum(b)
+	for _, tc := range []struct {
+		digest string
+		ok     bool
+	}{
+		{Digest(b), true},
+		{"sha1:" + base32.StdEncoding.EncodeToString(s1[:]), true},
+		{"sha1:aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", true},
+		{Digest([]byte("other")), false},
+	} {
+		ok, err := CheckDigest(tc.digest, b)
+		if err != nil || ok != tc.ok {
+			t.Fatalf("%s: %v %v", tc.digest, ok, err)
+		}
+	}
+	if _, err := CheckDigest("md5:abc", b); err == nil {
+		t.Fatalf("expected error for unsupported algorithm")
+	}
+}
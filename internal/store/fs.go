@@ -0,0 +1,395 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"policyguardian/internal/shared/hashing"
+)
+
+const IndexFile = "index.jsonl"
+
+// objects maps each kind to its subdirectory and file extension.
+var objects = map[Kind]struct{ dir, ext string }{
+	KindSnapshot:     {"snapshots", ".zip"},
+	KindConsentEvent: {"consents", ".json"},
+}
+
+// FS is the filesystem backend, rooted at a directory:
+//
+//	snapshots/<snapshot_id>.zip
+//	consents/<consent_event_id>.json
+//	index.jsonl   one Meta per line; the last line for a kind/ID wins
+//
+// Objects are written to a temp file and renamed into place. Other
+// directories under the root (log/, watch/, tsa/) are left alone. An FS is
+// safe for concurrent use within one process; a directory must have a single
+// writer process.
+type FS struct {
+	dir string
+	mu  sync.Mutex
+}
+
+var _ Store = (*FS)(nil)
+
+// OpenFS opens (creating if needed) the store in dir.
+func OpenFS(dir string) (*FS, error) {
+	for _, o := range objects {
+		if err := os.MkdirAll(filepath.Join(dir, o.dir), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &FS{dir: dir}, nil
+}
+
+// Dir returns the store root.
+func (s *FS) Dir() string { return s.dir }
+
+// Path returns the file that holds kind/id.
+func (s *FS) Path(kind Kind, id string) (string, error) {
+	o, ok := objects[kind]
+	if !ok {
+		return "", fmt.Errorf("unknown kind %q", kind)
+	}
+	if err := ValidateID(id); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, o.dir, id+o.ext), nil
+}
+
+func (s *FS) Put(m Meta, data []byte) (*Meta, error) {
+	path, err := s.Path(m.Kind, m.ID)
+	if err != nil {
+		return nil, err
+	}
+	m.SHA256 = hashing.SHA256Hex(data)
+	m.Size = int64(len(data))
+	line, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := WriteFileAtomic(path, data); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, IndexFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (s *FS) Get(kind Kind, id string) ([]byte, *Meta, error) {
+	path, err := s.Path(kind, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := hashing.SHA256Hex(b)
+	idx, _, err := s.readIndex()
+	if err != nil {
+		return nil, nil, err
+	}
+	m, ok := idx[key(kind, id)]
+	if !ok {
+		return b, &Meta{Kind: kind, ID: id, SHA256: sum, Size: int64(len(b))}, nil
+	}
+	if m.SHA256 != sum {
+		return nil, nil, ErrCorrupt
+	}
+	return b, &m, nil
+}
+
+func (s *FS) Stat(kind Kind, id string) (*Meta, error) {
+	path, err := s.Path(kind, id)
+	if err != nil {
+		return nil, err
+	}
+	idx, _, err := s.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := idx[key(kind, id)]; ok {
+		return &m, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Meta{Kind: kind, ID: id, SHA256: hashing.SHA256Hex(b), Size: int64(len(b))}, nil
+}
+
+func (s *FS) List(kind Kind) ([]Meta, error) {
+	if _, ok := objects[kind]; kind != "" && !ok {
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+	idx, _, err := s.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	var out []Meta
+	for _, m := range idx {
+		if kind == "" || m.Kind == kind {
+			out = append(out, m)
+		}
+	}
+	sortMetas(out)
+	return out, nil
+}
+
+// Problem is one finding of Fsck.
+// Reason is one of index_line_invalid|index_entry_invalid|missing|
+// hash_mismatch|unindexed|unexpected_file|stray_temp|verify_failed.
+type Problem struct {
+	Kind   Kind   `json:"kind,omitempty"`
+	ID     string `json:"id,omitempty"`
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type FsckOptions struct {
+	// Verify, when set, is called for every object whose bytes match the
+	// index; a non-empty return is reported as verify_failed.
+	Verify func(kind Kind, id string, data []byte) string
+}
+
+// Fsck cross-checks the index against the object files. It returns the
+// problems found, sorted by path; an error means the check could not run.
+func (s *FS) Fsck(opts FsckOptions) ([]Problem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx, badLines, err := s.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	indexPath := filepath.Join(s.dir, IndexFile)
+	var probs []Problem
+	for _, n := range badLines {
+		probs = append(probs, Problem{Path: indexPath, Reason: "index_line_invalid", Detail: fmt.Sprintf("line %d", n)})
+	}
+
+	for _, m := range idx {
+		path, err := s.Path(m.Kind, m.ID)
+		if err != nil {
+			probs = append(probs, Problem{Kind: m.Kind, ID: m.ID, Path: indexPath, Reason: "index_entry_invalid", Detail: err.Error()})
+			continue
+		}
+		b, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			probs = append(probs, Problem{Kind: m.Kind, ID: m.ID, Path: path, Reason: "missing"})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if got := hashing.SHA256Hex(b); got != m.SHA256 {
+			probs = append(probs, Problem{Kind: m.Kind, ID: m.ID, Path: path, Reason: "hash_mismatch", Detail: "sha256 " + got})
+			continue
+		}
+		if opts.Verify != nil {
+			if reason := opts.Verify(m.Kind, m.ID, b); reason != "" {
+				probs = append(probs, Problem{Kind: m.Kind, ID: m.ID, Path: path, Reason: "verify_failed", Detail: reason})
+			}
+		}
+	}
+
+	err = s.walkObjects(func(kind Kind, id, path string) {
+		if _, ok := idx[key(kind, id)]; !ok {
+			probs = append(probs, Problem{Kind: kind, ID: id, Path: path, Reason: "unindexed"})
+		}
+	}, func(path, reason string) {
+		probs = append(probs, Problem{Path: path, Reason: reason})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(probs, func(i, j int) bool {
+		if probs[i].Path != probs[j].Path {
+			return probs[i].Path < probs[j].Path
+		}
+		return probs[i].Reason < probs[j].Reason
+	})
+	return probs, nil
+}
+
+// Reindex rebuilds the index from the object files and returns the number of
+// entries written. meta supplies the caller-side fields for an object; when it
+// is nil or fails, the entry carries only kind, ID, sha256 and size.
+func (s *FS) Reindex(meta func(kind Kind, id string, data []byte) (Meta, error)) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var metas []Meta
+	var readErr error
+	err := s.walkObjects(func(kind Kind, id, path string) {
+		if readErr != nil {
+			return
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			readErr = err
+			return
+		}
+		m := Meta{}
+		if meta != nil {
+			if mm, err := meta(kind, id, b); err == nil {
+				m = mm
+			}
+		}
+		m.Kind, m.ID = kind, id
+		m.SHA256 = hashing.SHA256Hex(b)
+		m.Size = int64(len(b))
+		metas = append(metas, m)
+	}, func(string, string) {})
+	if err == nil {
+		err = readErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	sortMetas(metas)
+	var buf bytes.Buffer
+	for _, m := range metas {
+		line, err := json.Marshal(m)
+		if err != nil {
+			return 0, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := WriteFileAtomic(filepath.Join(s.dir, IndexFile), buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(metas), nil
+}
+
+// walkObjects calls obj for every well-named object file and other for
+// anything else found in the object directories.
+func (s *FS) walkObjects(obj func(kind Kind, id, path string), other func(path, reason string)) error {
+	for _, kind := range Kinds {
+		o := objects[kind]
+		dir := filepath.Join(s.dir, o.dir)
+		ents, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, e := range ents {
+			path := filepath.Join(dir, e.Name())
+			id, isObj := strings.CutSuffix(e.Name(), o.ext)
+			switch {
+			case strings.HasPrefix(e.Name(), ".tmp-"):
+				other(path, "stray_temp")
+			case e.IsDir() || !isObj || ValidateID(id) != nil:
+				other(path, "unexpected_file")
+			default:
+				obj(kind, id, path)
+			}
+		}
+	}
+	return nil
+}
+
+// readIndex returns the latest entry per kind/ID and the numbers of lines
+// that could not be parsed. A missing index is empty.
+func (s *FS) readIndex() (map[string]Meta, []int, error) {
+	f, err := os.Open(filepath.Join(s.dir, IndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]Meta{}, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	idx := map[string]Meta{}
+	var bad []int
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var m Meta
+		if err := json.Unmarshal(line, &m); err != nil || m.Kind == "" || m.ID == "" {
+			bad = append(bad, n)
+			continue
+		}
+		idx[key(m.Kind, m.ID)] = m
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	return idx, bad, nil
+}
+
+func key(kind Kind, id string) string { return string(kind) + "/" + id }
+
+func sortMetas(ms []Meta) {
+	rank := map[Kind]int{}
+	for i, k := range Kinds {
+		rank[k] = i
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		a, b := ms[i], ms[j]
+		if a.Kind != b.Kind {
+			return rank[a.Kind] < rank[b.Kind]
+		}
+		if a.CreatedAtUTC != b.CreatedAtUTC {
+			return a.CreatedAtUTC < b.CreatedAtUTC
+		}
+		return a.ID < b.ID
+	})
+}
+
+// WriteFileAtomic writes data with mode 0644 via a temp file in the same
+// directory and renames it into place, so readers never observe a partial
+// file.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,85 @@
+// Package store keeps snapshot packs and consent events addressed by their
+// IDs, with an index of metadata for listing without opening every object.
+package store
+
+import (
+	"errors"
+	"os"
+	"regexp"
+)
+
+// Kind selects the object namespace.
+type Kind string
+
+const (
+	KindSnapshot     Kind = "snapshot"
+	KindConsentEvent Kind = "consent_event"
+)
+
+// Kinds lists every kind in listing order.
+var Kinds = []Kind{KindSnapshot, KindConsentEvent}
+
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrInvalidID = errors.New("invalid id (want 64 lowercase hex chars)")
+	ErrCorrupt   = errors.New("stored bytes do not match the index")
+)
+
+// Meta is one index entry. SHA256 and Size describe the stored bytes and are
+// filled in by Put; the remaining fields are supplied by the caller.
+type Meta struct {
+	Kind         Kind   `json:"kind"`
+	ID           string `json:"id"`
+	SHA256       string `json:"sha256"`
+	Size         int64  `json:"size"`
+	CreatedAtUTC string `json:"created_at_utc,omitempty"`
+	PolicySHA256 string `json:"policy_sha256,omitempty"`
+	// URL is the requested URL of a snapshot taken from the network.
+	URL string `json:"url,omitempty"`
+	// SnapshotID is the snapshot a consent event refers to.
+	SnapshotID string `json:"snapshot_id,omitempty"`
+}
+
+// Store is implemented by evidence store backends.
+type Store interface {
+	// Put stores data under m.Kind/m.ID and records m in the index.
+	// Putting an ID again replaces the object.
+	Put(m Meta, data []byte) (*Meta, error)
+	// Get returns the object and its metadata. Objects written before the
+	// index existed are returned with SHA256/Size only.
+	Get(kind Kind, id string) ([]byte, *Meta, error)
+	// Stat returns the index entry without reading the object.
+	Stat(kind Kind, id string) (*Meta, error)
+	// List returns the indexed objects of kind (all kinds when empty),
+	// ordered by kind, then created_at_utc, then ID.
+	List(kind Kind) ([]Meta, error)
+}
+
+var idRe = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ValidateID reports whether id is a sha2-256 hex ID, which is all the store
+// accepts; this keeps IDs from escaping the store directory.
+func ValidateID(id string) error {
+	if !idRe.MatchString(id) {
+		return ErrInvalidID
+	}
+	return nil
+}
+
+// ParseKind accepts the kind names used on the command line.
+func ParseKind(s string) (Kind, bool) {
+	for _, k := range Kinds {
+		if string(k) == s {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// DefaultDir returns $POLICYGUARDIAN_STORE, or .policyguardian_store.
+func DefaultDir() string {
+	if d := os.Getenv("POLICYGUARDIAN_STORE"); d != "" {
+		return d
+	}
+	return ".policyguardian_store"
+}
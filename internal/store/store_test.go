@@ -0,0 +1,94 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testID(c byte) string { return strings.Repeat(string(c), 64) }
+
+func TestFSPutGetListFsck(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapID, evID := testID('a'), testID('b')
+	if _, err := s.Put(Meta{Kind: KindSnapshot, ID: snapID, CreatedAtUTC: "2026-01-02T00:00:00Z", URL: "https://example.com/p"}, []byte("zip")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Put(Meta{Kind: KindConsentEvent, ID: evID, SnapshotID: snapID}, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, m, err := s.Get(KindSnapshot, snapID)
+	if err != nil || string(b) != "zip" || m.URL != "https://example.com/p" || m.Size != 3 {
+		t.Fatalf("get: %q %+v %v", b, m, err)
+	}
+	if _, _, err := s.Get(KindSnapshot, evID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	for _, bad := range []string{"../../etc/passwd", strings.ToUpper(snapID), snapID[:63]} {
+		if _, _, err := s.Get(KindSnapshot, bad); !errors.Is(err, ErrInvalidID) {
+			t.Fatalf("id %q: expected ErrInvalidID, got %v", bad, err)
+		}
+	}
+	all, err := s.List("")
+	if err != nil || len(all) != 2 || all[0].Kind != KindSnapshot || all[1].SnapshotID != snapID {
+		t.Fatalf("list: %+v %v", all, err)
+	}
+	if probs, err := s.Fsck(FsckOptions{}); err != nil || len(probs) != 0 {
+		t.Fatalf("clean fsck: %+v %v", probs, err)
+	}
+
+	// Tamper with one object, drop in an unindexed one and a stray file.
+	snapPath, _ := s.Path(KindSnapshot, snapID)
+	if err := os.WriteFile(snapPath, []byte("zap"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Get(KindSnapshot, snapID); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+	legacy := filepath.Join(dir, "snapshots", testID('c')+".zip")
+	if err := os.WriteFile(legacy, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "consents", "notes.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	probs, err := s.Fsck(FsckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, p := range probs {
+		got[p.Reason] = true
+	}
+	for _, want := range []string{"hash_mismatch", "unindexed", "unexpected_file"} {
+		if !got[want] {
+			t.Fatalf("fsck missing %s: %+v", want, probs)
+		}
+	}
+
+	n, err := s.Reindex(func(kind Kind, id string, data []byte) (Meta, error) {
+		return Meta{CreatedAtUTC: "2026-01-01T00:00:00Z"}, nil
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("reindex: %d %v", n, err)
+	}
+	if m, err := s.Stat(KindSnapshot, testID('c')); err != nil || m.CreatedAtUTC != "2026-01-01T00:00:00Z" {
+		t.Fatalf("stat after reindex: %+v %v", m, err)
+	}
+	probs, _ = s.Fsck(FsckOptions{Verify: func(kind Kind, id string, data []byte) string {
+		if string(data) == "old" {
+			return "bad_pack"
+		}
+		return ""
+	}})
+	if len(probs) != 2 || probs[1].Reason != "verify_failed" || probs[1].ID != testID('c') {
+		t.Fatalf("fsck after reindex: %+v", probs)
+	}
+}
@@ -0,0 +1,466 @@
+package translog
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"policyguardian/internal/shared/hashing"
+	"policyguardian/internal/shared/jcs"
+	"policyguardian/internal/shared/sigenv"
+	"policyguardian/internal/shared/timefmt"
+)
+
+const (
+	SchemaTreeHead         = "policyguardian.tree_head.v0.1"
+	SchemaInclusionProof   = "policyguardian.inclusion_proof.v0.1"
+	SchemaConsistencyProof = "policyguardian.consistency_proof.v0.1"
+
+	// Leaf kinds.
+	KindSnapshot          = "policylock.snapshot"
+	KindConsentEvent      = "consentguardian.consent_event"
+	KindConsentRevocation = "consentguardian.consent_revocation"
+)
+
+// Leaf is one logged artifact ID. Its Merkle leaf input is JCS({"id","kind"}).
+type Leaf struct {
+	Index    uint64 `json:"index"`
+	Kind     string `json:"kind"`
+	ID       string `json:"id"`
+	LeafHash string `json:"leaf_hash"`
+}
+
+// TreeHead is the signed part of a signed tree head (STH).
+type TreeHead struct {
+	Schema       string `json:"schema"`
+	LogID        string `json:"log_id"`
+	TreeSize     uint64 `json:"tree_size"`
+	RootHash     string `json:"root_hash"`
+	TimestampUTC string `json:"timestamp_utc"`
+}
+
+// SignedTreeHead pairs a tree head with an Ed25519 envelope over JCS(tree_head).
+type SignedTreeHead struct {
+	TreeHead  TreeHead         `json:"tree_head"`
+	Signature *sigenv.Envelope `json:"signature"`
+}
+
+// InclusionProof proves that Kind/ID is leaf LeafIndex of the tree described
+// by SignedTreeHead. It is stored alongside the logged artifact.
+type InclusionProof struct {
+	Schema         string         `json:"schema"`
+	Kind           string         `json:"kind"`
+	ID             string         `json:"id"`
+	LeafIndex      uint64         `json:"leaf_index"`
+	AuditPath      []string       `json:"audit_path"`
+	SignedTreeHead SignedTreeHead `json:"signed_tree_head"`
+}
+
+// ConsistencyProof proves that Old is a prefix of New.
+type ConsistencyProof struct {
+	Schema string         `json:"schema"`
+	Old    SignedTreeHead `json:"old"`
+	New    SignedTreeHead `json:"new"`
+	Proof  []string       `json:"proof"`
+}
+
+// Log is a local append-only log rooted at a directory:
+//
+//	log_key.ed25519   tree head signing key (hex, 0600)
+//	leaves.jsonl      one Leaf per line, in index order
+//	sth/<size>.json   every signed tree head ever issued
+//
+// A Log is safe for concurrent use within one process; a directory must have
+// a single writer process.
+type Log struct {
+	dir  string
+	priv ed25519.PrivateKey
+	mu   sync.Mutex
+
+	// Now is used for tree head timestamps; tests may override it.
+	Now func() string
+}
+
+// Open opens (creating if needed) the log in dir.
+func Open(dir string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "sth"), 0755); err != nil {
+		return nil, err
+	}
+	keyPath := filepath.Join(dir, "log_key.ed25519")
+	var priv ed25519.PrivateKey
+	b, err := os.ReadFile(keyPath)
+	switch {
+	case err == nil:
+		priv, err = sigenv.ParseEd25519PrivateKeyHex(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("log key: %w", err)
+		}
+	case errors.Is(err, os.ErrNotExist):
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(keyPath, []byte(hex.EncodeToString(priv)+"\n"), 0600); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	return &Log{
+		dir:  dir,
+		priv: priv,
+		Now:  func() string { return timefmt.Format(timefmt.NowUTC()) },
+	}, nil
+}
+
+// PublicKeyHex returns the hex Ed25519 key that signs this log's tree heads.
+func (l *Log) PublicKeyHex() string {
+	return hex.EncodeToString(l.priv.Public().(ed25519.PublicKey))
+}
+
+// LeafData returns the Merkle leaf input for an artifact ID.
+func LeafData(kind, id string) ([]byte, error) {
+	return jcs.CanonicalizeValue(map[string]any{"kind": kind, "id": id})
+}
+
+// Append logs kind/id, issues a new signed tree head and returns the
+// inclusion proof against it. Appending an ID that is already logged does not
+// add a leaf; the proof is issued against the current tree head instead.
+func (l *Log) Append(kind, id string) (*InclusionProof, error) {
+	if kind == "" || id == "" {
+		return nil, errors.New("leaf kind and id required")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	leaves, err := l.readLeaves()
+	if err != nil {
+		return nil, err
+	}
+	for _, lf := range leaves {
+		if lf.Kind == kind && lf.ID == id {
+			sth, err := l.latestLocked(leaves)
+			if err != nil {
+				return nil, err
+			}
+			return l.proveLocked(leaves, lf, sth)
+		}
+	}
+
+	data, err := LeafData(kind, id)
+	if err != nil {
+		return nil, err
+	}
+	lf := Leaf{
+		Index:    uint64(len(leaves)),
+		Kind:     kind,
+		ID:       id,
+		LeafHash: hex.EncodeToString(LeafHash(data)),
+	}
+	line, err := json.Marshal(lf)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(l.dir, "leaves.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	leaves = append(leaves, lf)
+	sth, err := l.issueLocked(leaves)
+	if err != nil {
+		return nil, err
+	}
+	return l.proveLocked(leaves, lf, sth)
+}
+
+// Latest returns the newest signed tree head, issuing one if none exists yet.
+func (l *Log) Latest() (*SignedTreeHead, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	leaves, err := l.readLeaves()
+	if err != nil {
+		return nil, err
+	}
+	return l.latestLocked(leaves)
+}
+
+// TreeHeadAt returns the signed tree head issued for the given size.
+func (l *Log) TreeHeadAt(size uint64) (*SignedTreeHead, error) {
+	b, err := os.ReadFile(filepath.Join(l.dir, "sth", fmt.Sprintf("%d.json", size)))
+	if err != nil {
+		return nil, fmt.Errorf("no tree head for size %d", size)
+	}
+	var sth SignedTreeHead
+	if err := json.Unmarshal(b, &sth); err != nil {
+		return nil, err
+	}
+	return &sth, nil
+}
+
+// ProveConsistency builds a consistency proof between the tree heads issued
+// at sizes from and to.
+func (l *Log) ProveConsistency(from, to uint64) (*ConsistencyProof, error) {
+	if from > to {
+		return nil, errors.New("from must not exceed to")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	leaves, err := l.readLeaves()
+	if err != nil {
+		return nil, err
+	}
+	if to > uint64(len(leaves)) {
+		return nil, fmt.Errorf("tree size %d exceeds log size %d", to, len(leaves))
+	}
+	oldSTH, err := l.TreeHeadAt(from)
+	if err != nil {
+		return nil, err
+	}
+	newSTH, err := l.TreeHeadAt(to)
+	if err != nil {
+		return nil, err
+	}
+	hashes, err := leafHashes(leaves[:to])
+	if err != nil {
+		return nil, err
+	}
+	return &ConsistencyProof{
+		Schema: SchemaConsistencyProof,
+		Old:    *oldSTH,
+		New:    *newSTH,
+		Proof:  hexList(ConsistencyPath(int(from), hashes)),
+	}, nil
+}
+
+func (l *Log) latestLocked(leaves []Leaf) (*SignedTreeHead, error) {
+	sth, err := l.TreeHeadAt(uint64(len(leaves)))
+	if err == nil {
+		return sth, nil
+	}
+	return l.issueLocked(leaves)
+}
+
+func (l *Log) issueLocked(leaves []Leaf) (*SignedTreeHead, error) {
+	hashes, err := leafHashes(leaves)
+	if err != nil {
+		return nil, err
+	}
+	th := TreeHead{
+		Schema:       SchemaTreeHead,
+		LogID:        hashing.SHA256Hex(l.priv.Public().(ed25519.PublicKey)),
+		TreeSize:     uint64(len(leaves)),
+		RootHash:     hex.EncodeToString(RootHash(hashes)),
+		TimestampUTC: l.Now(),
+	}
+	signBytes, err := treeHeadSignBytes(th)
+	if err != nil {
+		return nil, err
+	}
+	env, _, err := sigenv.SignEd25519(l.priv, signBytes)
+	if err != nil {
+		return nil, err
+	}
+	sth := &SignedTreeHead{TreeHead: th, Signature: env}
+	b, err := json.MarshalIndent(sth, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(l.dir, "sth", fmt.Sprintf("%d.json", th.TreeSize)), append(b, '\n'), 0644); err != nil {
+		return nil, err
+	}
+	return sth, nil
+}
+
+func (l *Log) proveLocked(leaves []Leaf, lf Leaf, sth *SignedTreeHead) (*InclusionProof, error) {
+	hashes, err := leafHashes(leaves[:sth.TreeHead.TreeSize])
+	if err != nil {
+		return nil, err
+	}
+	return &InclusionProof{
+		Schema:         SchemaInclusionProof,
+		Kind:           lf.Kind,
+		ID:             lf.ID,
+		LeafIndex:      lf.Index,
+		AuditPath:      hexList(InclusionPath(int(lf.Index), hashes)),
+		SignedTreeHead: *sth,
+	}, nil
+}
+
+func (l *Log) readLeaves() ([]Leaf, error) {
+	f, err := os.Open(filepath.Join(l.dir, "leaves.jsonl"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var leaves []Leaf
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var lf Leaf
+		if err := json.Unmarshal([]byte(line), &lf); err != nil {
+			return nil, fmt.Errorf("leaves.jsonl: %w", err)
+		}
+		if lf.Index != uint64(len(leaves)) {
+			return nil, fmt.Errorf("leaves.jsonl: leaf %d out of order", lf.Index)
+		}
+		leaves = append(leaves, lf)
+	}
+	return leaves, sc.Err()
+}
+
+func leafHashes(leaves []Leaf) ([][]byte, error) {
+	out := make([][]byte, len(leaves))
+	for i, lf := range leaves {
+		data, err := LeafData(lf.Kind, lf.ID)
+		if err != nil {
+			return nil, err
+		}
+		h := LeafHash(data)
+		if hex.EncodeToString(h) != lf.LeafHash {
+			return nil, fmt.Errorf("leaves.jsonl: leaf %d hash mismatch", i)
+		}
+		out[i] = h
+	}
+	return out, nil
+}
+
+func hexList(hs [][]byte) []string {
+	out := make([]string, len(hs))
+	for i, h := range hs {
+		out[i] = hex.EncodeToString(h)
+	}
+	return out
+}
+
+func treeHeadSignBytes(th TreeHead) ([]byte, error) {
+	raw, err := json.Marshal(th)
+	if err != nil {
+		return nil, err
+	}
+	return jcs.CanonicalizeJSON(raw)
+}
+
+// VerifyTreeHead checks the tree head signature. When pubKeyHex is non-empty
+// the signer must match it. It returns "" or a reason code.
+func VerifyTreeHead(sth *SignedTreeHead, pubKeyHex string) string {
+	if sth.TreeHead.Schema != SchemaTreeHead {
+		return "wrong_tree_head_schema"
+	}
+	if sth.Signature == nil {
+		return "tree_head_signature_missing"
+	}
+	signBytes, err := treeHeadSignBytes(sth.TreeHead)
+	if err != nil {
+		return "jcs_error"
+	}
+	if reason := sigenv.Verify(sth.Signature, signBytes); reason != "" {
+		return reason
+	}
+	pub, err := hex.DecodeString(sth.Signature.PublicKey)
+	if err != nil || hashing.SHA256Hex(pub) != sth.TreeHead.LogID {
+		return "log_id_mismatch"
+	}
+	if pubKeyHex != "" && !strings.EqualFold(strings.TrimSpace(pubKeyHex), sth.Signature.PublicKey) {
+		return "untrusted_log_key"
+	}
+	return ""
+}
+
+// VerifyInclusionProof checks an inclusion proof offline. It returns "" or a
+// reason code.
+func VerifyInclusionProof(p *InclusionProof, pubKeyHex string) string {
+	if p.Schema != SchemaInclusionProof {
+		return "wrong_proof_schema"
+	}
+	if reason := VerifyTreeHead(&p.SignedTreeHead, pubKeyHex); reason != "" {
+		return reason
+	}
+	data, err := LeafData(p.Kind, p.ID)
+	if err != nil {
+		return "jcs_error"
+	}
+	path, ok := decodeHexList(p.AuditPath)
+	if !ok {
+		return "invalid_audit_path"
+	}
+	root, err := hex.DecodeString(p.SignedTreeHead.TreeHead.RootHash)
+	if err != nil {
+		return "invalid_root_hash"
+	}
+	if !VerifyInclusion(p.LeafIndex, p.SignedTreeHead.TreeHead.TreeSize, LeafHash(data), path, root) {
+		return "inclusion_proof_failed"
+	}
+	return ""
+}
+
+// VerifyConsistencyProof checks a consistency proof offline. Both tree heads
+// must be signed by the same log. It returns "" or a reason code.
+func VerifyConsistencyProof(p *ConsistencyProof, pubKeyHex string) string {
+	if p.Schema != SchemaConsistencyProof {
+		return "wrong_proof_schema"
+	}
+	if reason := VerifyTreeHead(&p.Old, pubKeyHex); reason != "" {
+		return reason
+	}
+	if reason := VerifyTreeHead(&p.New, pubKeyHex); reason != "" {
+		return reason
+	}
+	if p.Old.TreeHead.LogID != p.New.TreeHead.LogID {
+		return "log_id_mismatch"
+	}
+	proof, ok := decodeHexList(p.Proof)
+	if !ok {
+		return "invalid_proof_hash"
+	}
+	oldRoot, err1 := hex.DecodeString(p.Old.TreeHead.RootHash)
+	newRoot, err2 := hex.DecodeString(p.New.TreeHead.RootHash)
+	if err1 != nil || err2 != nil {
+		return "invalid_root_hash"
+	}
+	if !VerifyConsistency(p.Old.TreeHead.TreeSize, p.New.TreeHead.TreeSize, oldRoot, newRoot, proof) {
+		return "consistency_proof_failed"
+	}
+	return ""
+}
+
+func decodeHexList(in []string) ([][]byte, bool) {
+	out := make([][]byte, len(in))
+	for i, s := range in {
+		b, err := hex.DecodeString(s)
+		if err != nil || len(b) != 32 {
+			return nil, false
+		}
+		out[i] = b
+	}
+	return out, true
+}
+
+// MarshalProof returns indented JSON for proof files.
+func MarshalProof(v any) ([]byte, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
@@ -0,0 +1,96 @@
+package translog
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func testLeaves(n int) [][]byte {
+	out := make([][]byte, n)
+	for i := range out {
+		out[i] = LeafHash([]byte(fmt.Sprintf("leaf-%d", i)))
+	}
+	return out
+}
+
+func TestMerkleProofsAllSizes(t *testing.T) {
+	for n := 1; n <= 33; n++ {
+		leaves := testLeaves(n)
+		root := RootHash(leaves)
+		for m := 0; m < n; m++ {
+			path := InclusionPath(m, leaves)
+			if !VerifyInclusion(uint64(m), uint64(n), leaves[m], path, root) {
+				t.Fatalf("inclusion n=%d m=%d failed", n, m)
+			}
+			if VerifyInclusion(uint64(m), uint64(n), leaves[(m+1)%n], path, root) && n > 1 {
+				t.Fatalf("inclusion n=%d m=%d accepted wrong leaf", n, m)
+			}
+		}
+		for m := 1; m <= n; m++ {
+			proof := ConsistencyPath(m, leaves)
+			oldRoot := RootHash(leaves[:m])
+			if !VerifyConsistency(uint64(m), uint64(n), oldRoot, root, proof) {
+				t.Fatalf("consistency %d->%d failed", m, n)
+			}
+			if m < n && VerifyConsistency(uint64(m), uint64(n), RootHash(testLeaves(m + 1)[1:]), root, proof) {
+				t.Fatalf("consistency %d->%d accepted wrong old root", m, n)
+			}
+		}
+	}
+}
+
+func TestLogAppendAndProofs(t *testing.T) {
+	l, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Now = func() string { return "2026-01-01T00:00:00Z" }
+
+	var proofs []*InclusionProof
+	for i := 0; i < 5; i++ {
+		p, err := l.Append(KindSnapshot, fmt.Sprintf("%064x", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason := VerifyInclusionProof(p, l.PublicKeyHex()); reason != "" {
+			t.Fatalf("leaf %d: %s", i, reason)
+		}
+		proofs = append(proofs, p)
+	}
+
+	// Re-appending an existing ID does not grow the log.
+	again, err := l.Append(KindSnapshot, fmt.Sprintf("%064x", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.LeafIndex != 1 || again.SignedTreeHead.TreeHead.TreeSize != 5 {
+		t.Fatalf("unexpected duplicate proof: index=%d size=%d", again.LeafIndex, again.SignedTreeHead.TreeHead.TreeSize)
+	}
+
+	cp, err := l.ProveConsistency(2, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason := VerifyConsistencyProof(cp, ""); reason != "" {
+		t.Fatalf("consistency: %s", reason)
+	}
+	if cp.Old.TreeHead.RootHash != proofs[1].SignedTreeHead.TreeHead.RootHash {
+		t.Fatalf("old tree head does not match the one issued at append time")
+	}
+
+	// Tampering is detected.
+	bad := *proofs[2]
+	bad.ID = fmt.Sprintf("%064x", 99)
+	if reason := VerifyInclusionProof(&bad, ""); reason != "inclusion_proof_failed" {
+		t.Fatalf("expected inclusion_proof_failed, got %q", reason)
+	}
+	forged := *proofs[2]
+	forged.SignedTreeHead.TreeHead.TimestampUTC = "2025-01-01T00:00:00Z"
+	if reason := VerifyInclusionProof(&forged, ""); reason != "signature_payload_hash_mismatch" {
+		t.Fatalf("expected signature failure, got %q", reason)
+	}
+	if reason := VerifyInclusionProof(proofs[0], hex.EncodeToString(make([]byte, 32))); reason != "untrusted_log_key" {
+		t.Fatalf("expected untrusted_log_key, got %q", reason)
+	}
+}